@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// command runs slash command typed in terminal
+func (r *repl) command(line string) {
+	user, _ := r.store.Get(cliChatID)
+	if !r.commands.Dispatch(r.fake, commandMessage(line), user) {
+		fmt.Fprintln(r.out, "unknown command, type /help")
+	}
+}
+
+// commandMessage wraps terminal line into telegram message, so commands can be handled by command.Registry
+func commandMessage(line string) *tgbotapi.Message {
+	name := strings.Fields(line)[0]
+	return &tgbotapi.Message{
+		Chat:     &tgbotapi.Chat{ID: cliChatID},
+		From:     &tgbotapi.User{ID: cliChatID, UserName: "cli"},
+		Text:     line,
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(name)}},
+	}
+}
+
+func (r *repl) registerCommands() {
+	r.commands.MustRegister(command.Command{
+		Name:        "help",
+		Description: "print this message",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			fmt.Fprintln(r.out, r.commands.HelpText(user))
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "quit",
+		Description: "exit",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			r.quit = true
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "models",
+		Description: "list models of the endpoint",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			for i, model := range langchain.GetModelsList(user.AiSession.GptKey, r.endpoint) {
+				mark := " "
+				if model == user.AiSession.GptModel {
+					mark = "*"
+				}
+				fmt.Fprintf(r.out, "%s %d. %s\n", mark, i+1, model)
+			}
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "model",
+		Description: "switch model, history is kept",
+		Args:        "<number from /models | name>",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			model := strings.TrimSpace(msg.CommandArguments())
+			if n, err := strconv.Atoi(model); err == nil {
+				models := langchain.GetModelsList(user.AiSession.GptKey, r.endpoint)
+				if n < 1 || n > len(models) {
+					fmt.Fprintln(r.out, "no such model, see /models")
+					return
+				}
+				model = models[n-1]
+			}
+			if model == "" {
+				fmt.Fprintln(r.out, "model:", user.AiSession.GptModel)
+				return
+			}
+			r.setModel(model)
+			fmt.Fprintln(r.out, "your session model:", model)
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "reset",
+		Description: "clear conversation history",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			r.store.Update(cliChatID, func(u *database.User) {
+				u.AiSession.DialogThread = database.ChatSessionGraph{}
+			})
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "history",
+		Description: "print conversation history",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			for _, message := range user.AiSession.DialogThread.ConversationBuffer {
+				for _, part := range message.Parts {
+					fmt.Fprintf(r.out, "%s: %v\n", message.Role, part)
+				}
+			}
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "save",
+		Description: "save conversation history to file",
+		Args:        "<file>",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			r.save(strings.TrimSpace(msg.CommandArguments()))
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "load",
+		Description: "load conversation history from file",
+		Args:        "<file>",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			r.load(strings.TrimSpace(msg.CommandArguments()))
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "oneshot",
+		Description: "ask agent without conversation history",
+		Args:        "<prompt>",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			_, answer, err := langchain.RunNewAgent(user.AiSession.GptKey, user.AiSession.GptModel, r.endpoint, msg.CommandArguments())
+			if err != nil {
+				fmt.Fprintln(r.out, "error:", err)
+				return
+			}
+			fmt.Fprintln(r.out, answer)
+		},
+	})
+
+	// the same commands as in the bot
+	r.commands.MustRegister(command.Command{
+		Name:        "image",
+		Description: "generate image",
+		Args:        "[prompt]",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			prompt := msg.CommandArguments()
+			if prompt == "" {
+				prompt = "evangelion, neon, anime"
+			}
+			r.comm.GenerateNewImageLAI_SD(prompt, cliChatID)
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "search_doc",
+		Description: "searching documents",
+		Args:        "<query>",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			r.comm.SearchDocuments(cliChatID, msg.CommandArguments(), 3)
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "setcontext",
+		Description: "use documents collection as context for answers",
+		Args:        "<collection>",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			if err := user.SetContext(msg.CommandArguments(), r.endpoint, r.comm.Config().Database.URL, langchain.HTTPClient(r.endpoint)); err != nil {
+				fmt.Fprintln(r.out, "could not set context:", err)
+				return
+			}
+			r.store.Update(cliChatID, func(u *database.User) {
+				u.VectorStore = user.VectorStore
+			})
+		},
+	})
+	r.commands.MustRegister(command.Command{
+		Name:        "clearcontext",
+		Description: "stop using documents collection",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			r.store.Update(cliChatID, func(u *database.User) {
+				u.ClearContext()
+			})
+		},
+	})
+}
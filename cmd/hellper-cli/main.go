@@ -0,0 +1,237 @@
+// hellper-cli talks to the same agent pipeline as the telegram bot, but from terminal.
+// It is meant for debugging prompts and tools without telegram token.
+//
+//	go run ./cmd/hellper-cli -model tiger-gemma-9b-v1-i1
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
+)
+
+// the only chat of the cli session
+const cliChatID = 1
+
+func main() {
+	// the same settings as the bot ($CONFIG_FILE and env), telegram settings are not needed
+	cfg, err := config.Load("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	endpoint := flag.String("endpoint", cfg.AI.Endpoint, "LocalAI (or OpenAI compatible) endpoint, empty for openai")
+	key := flag.String("key", cfg.AI.APIKey, "api key for the endpoint")
+	model := flag.String("model", "", "model name, first model of the endpoint if empty")
+	history := flag.String("load", "", "load conversation buffer from file")
+	verbose := flag.Bool("v", false, "print logs of the agent")
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	cfg.AI.Endpoint, cfg.AI.APIKey = *endpoint, *key
+	agent.Configure(cfg)
+	langchain.TrustEndpoints(cfg.AI)
+	r := newRepl(os.Stdout, cfg)
+	if *model == "" {
+		models := langchain.GetModelsList(*key, *endpoint)
+		if len(models) == 0 {
+			fmt.Fprintln(os.Stderr, "could not get models list, set model with -model")
+			os.Exit(1)
+		}
+		*model = models[0]
+	}
+	r.setModel(*model)
+	if *history != "" {
+		r.load(*history)
+	}
+
+	fmt.Fprintf(r.out, "model: %s, type /help for commands, /quit or Ctrl+D to exit\n", *model)
+	r.run(os.Stdin)
+}
+
+// repl keeps cli session: a single local user in memory store, and a Commander with fake messenger,
+// so slash commands behave like in the bot and their messages are printed to terminal.
+type repl struct {
+	out      io.Writer
+	endpoint string
+	store    database.UserStore
+	fake     *messenger.Fake
+	comm     *command.Commander
+	commands *command.Registry
+	quit     bool
+}
+
+func newRepl(out io.Writer, cfg *config.Config) *repl {
+	endpoint, key := cfg.AI.Endpoint, cfg.AI.APIKey
+	store := database.NewMemoryStore()
+	store.Save(database.User{
+		ID:           cliChatID,
+		Username:     "cli",
+		DialogStatus: database.StatusDialog,
+		Admin:        true,
+		AiSession: database.AiSession{
+			GptKey:   key,
+			OwnKey:   key,
+			Base_url: endpoint,
+		},
+	})
+
+	fake := messenger.NewFake("hellper-cli")
+	r := &repl{
+		out:      out,
+		endpoint: endpoint,
+		store:    store,
+		fake:     fake,
+		comm:     command.NewCommander(fake, store, context.Background(), cfg),
+		commands: command.NewRegistry(),
+	}
+	fake.OnSend = r.print
+	r.registerCommands()
+	return r
+}
+
+func (r *repl) run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for !r.quit {
+		fmt.Fprint(r.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "/"):
+			r.command(line)
+		default:
+			r.ask(line)
+		}
+	}
+}
+
+// print shows messages sent by commander
+func (r *repl) print(msg messenger.FakeMessage) {
+	switch msg.Kind {
+	case "text":
+		fmt.Fprintln(r.out, msg.Text)
+	default:
+		path, err := saveFile(msg)
+		if err != nil {
+			fmt.Fprintf(r.out, "[%s, could not save: %v]\n", msg.Kind, err)
+			return
+		}
+		fmt.Fprintf(r.out, "[%s saved to %s] %s\n", msg.Kind, path, msg.Text)
+	}
+}
+
+func saveFile(msg messenger.FakeMessage) (string, error) {
+	f, err := os.CreateTemp("", "hellper-cli-*-"+msg.Kind)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = f.Write(msg.File)
+	return f.Name(), err
+}
+
+// ask runs one turn of the dialog, answer is printed while it's generated
+func (r *repl) ask(prompt string) {
+	user, _ := r.store.Get(cliChatID)
+	stream := &terminalStream{out: r.out}
+	ctx := agent.WithImageSender(context.Background(), r.comm.ImageSender(cliChatID))
+	ctx = agent.WithEmbeddings(ctx, r.comm.Embeddings(user))
+	session, answer, err := langchain.ContinueAgent(
+		ctx,
+		cliChatID,
+		user.AiSession.GptKey,
+		user.AiSession.GptModel,
+		r.endpoint,
+		prompt,
+		&user.AiSession.DialogThread,
+		stream,
+	)
+	if err != nil {
+		fmt.Fprintln(r.out, "error:", err)
+		return
+	}
+	if stream.written {
+		fmt.Fprintln(r.out)
+	} else {
+		// endpoint doesn't stream
+		fmt.Fprintln(r.out, answer)
+	}
+	r.store.Update(cliChatID, func(u *database.User) {
+		u.AiSession.DialogThread = *session
+	})
+}
+
+// terminalStream prints llm output as it's generated
+type terminalStream struct {
+	out     io.Writer
+	written bool
+}
+
+func (s *terminalStream) Reset() {
+	// next generation after a tool call, start it from a new line
+	if s.written {
+		fmt.Fprintln(s.out)
+	}
+}
+
+func (s *terminalStream) WriteChunk(chunk []byte) {
+	s.written = true
+	s.out.Write(chunk)
+}
+
+func (r *repl) setModel(model string) {
+	r.store.Update(cliChatID, func(u *database.User) {
+		u.AiSession.GptModel = model
+	})
+}
+
+func (r *repl) save(path string) {
+	user, _ := r.store.Get(cliChatID)
+	data, err := database.EncodeConversation(user.AiSession.DialogThread.ConversationBuffer)
+	if err == nil {
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, "could not save conversation:", err)
+		return
+	}
+	fmt.Fprintf(r.out, "%d messages saved to %s\n", len(user.AiSession.DialogThread.ConversationBuffer), path)
+}
+
+func (r *repl) load(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(r.out, "could not load conversation:", err)
+		return
+	}
+	buffer, err := database.DecodeConversation(data)
+	if err != nil {
+		fmt.Fprintln(r.out, "could not load conversation:", err)
+		return
+	}
+	r.store.Update(cliChatID, func(u *database.User) {
+		u.AiSession.DialogThread.ConversationBuffer = buffer
+	})
+	fmt.Fprintf(r.out, "%d messages loaded from %s\n", len(buffer), path)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/langchain"
+)
+
+// fakeEndpoint serves two models and answers "answer of <model> #<n>" to every chat completion,
+// bodies of chat requests are kept
+type fakeEndpoint struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (e *fakeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/models") {
+		fmt.Fprint(w, `{"data":[{"id":"first","object":"model"},{"id":"second","object":"model"}]}`)
+		return
+	}
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	var body json.RawMessage
+	json.NewDecoder(r.Body).Decode(&body)
+	json.Unmarshal(body, &req)
+	e.mu.Lock()
+	e.requests = append(e.requests, string(body))
+	answer := fmt.Sprintf("answer of %s #%d", req.Model, len(e.requests))
+	e.mu.Unlock()
+
+	if !req.Stream {
+		fmt.Fprintf(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}]}`, answer)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":%q}}]}\n\n", answer)
+	fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func TestRepl(t *testing.T) {
+	endpoint := &fakeEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.AI.Endpoint, cfg.AI.APIKey = server.URL, "key"
+	cfg.Search.Provider = agent.SearchOff
+	agent.Configure(cfg)
+	langchain.TrustEndpoints(cfg.AI)
+
+	var out strings.Builder
+	r := newRepl(&out, cfg)
+	r.setModel("first")
+
+	saved := filepath.Join(t.TempDir(), "chat.json")
+	r.run(strings.NewReader(strings.Join([]string{
+		"hello",
+		"/model 2",
+		"how are you?",
+		"/save " + saved,
+		"/reset",
+		"/load " + saved,
+		"what did I ask?",
+		"/quit",
+		"never asked",
+	}, "\n")))
+
+	for _, want := range []string{
+		"answer of first #1",
+		"your session model: second",
+		"answer of second #2",
+		"4 messages saved to " + saved,
+		"4 messages loaded from " + saved,
+		"answer of second #3",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+
+	if len(endpoint.requests) != 3 {
+		t.Fatalf("expected 3 turns, got %d requests", len(endpoint.requests))
+	}
+	if !strings.Contains(endpoint.requests[1], "answer of first #1") {
+		t.Errorf("second turn must see the first one: %s", endpoint.requests[1])
+	}
+	last := endpoint.requests[2]
+	if !strings.Contains(last, "hello") || !strings.Contains(last, "answer of second #2") {
+		t.Errorf("loaded history must be sent after /reset: %s", last)
+	}
+
+	user, _ := r.store.Get(cliChatID)
+	if user.AiSession.GptModel != "second" || len(user.AiSession.DialogThread.ConversationBuffer) != 6 {
+		t.Errorf("unexpected session: model %q, %d messages", user.AiSession.GptModel, len(user.AiSession.DialogThread.ConversationBuffer))
+	}
+}
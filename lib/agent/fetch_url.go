@@ -0,0 +1,418 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/tmc/langchaingo/documentloaders"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+	"github.com/tmc/langchaingo/textsplitter"
+	"golang.org/x/net/html"
+)
+
+// limits of fetch_url tool if config doesn't set them, see config.Fetch
+const (
+	defaultFetchMaxBytes = 5 << 20
+	defaultFetchMaxChars = 12000
+)
+
+// text longer than this many parts is cut before summarization, so one page doesn't take dozens of model calls
+const maxFetchParts = 8
+
+// timeout of downloading a single url
+const fetchTimeout = 30 * time.Second
+
+// ErrPrivateAddress is returned by Fetcher and PublicClient for urls of loopback and private network addresses
+var ErrPrivateAddress = errors.New("address is not public")
+
+// Page is text of a downloaded url
+type Page struct {
+	URL         string
+	Title       string
+	ContentType string
+	Text        string
+	// Truncated is set when the file is larger than Fetcher.MaxBytes and only its start is read
+	Truncated bool
+}
+
+// Fetcher downloads web pages, plain text and pdf files and extracts their text
+type Fetcher struct {
+	// MaxBytes is the largest file read, defaultFetchMaxBytes if zero
+	MaxBytes int
+	// AllowPrivate allows loopback and private network addresses, they are refused otherwise so users can't reach services next to the bot
+	AllowPrivate bool
+}
+
+func (f Fetcher) client() *http.Client {
+	if !f.AllowPrivate {
+		return PublicClient(fetchTimeout)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return &http.Client{
+		Timeout:   fetchTimeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DialContext: dialer.DialContext},
+	}
+}
+
+// PublicClient returns http client which refuses loopback and private network addresses with ErrPrivateAddress,
+// zero timeout means no timeout. Addresses are checked for every connection after name resolution,
+// so redirects and dns tricks are covered too.
+func PublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: refusePrivate}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DialContext: dialer.DialContext},
+	}
+}
+
+func refusePrivate(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+		return fmt.Errorf("%s: %w", host, ErrPrivateAddress)
+	}
+	return nil
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+}
+
+// CheckPublic resolves host and returns ErrPrivateAddress if any of its addresses is loopback or private,
+// lookup errors are returned as is. It tells users early that PublicClient will refuse the host.
+func CheckPublic(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if isPrivate(addr.IP) {
+			return fmt.Errorf("%s: %w", host, ErrPrivateAddress)
+		}
+	}
+	return nil
+}
+
+// Fetch downloads rawURL and extracts its text: main content of html pages, text of pdf pages, plain text as is
+func (f Fetcher) Fetch(ctx context.Context, rawURL string) (Page, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Page{}, fmt.Errorf("%q is not an http url", rawURL)
+	}
+	page := Page{URL: u.String()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, page.URL, nil)
+	if err != nil {
+		return page, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; hellper bot)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain,application/pdf;q=0.9,*/*;q=0.5")
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return page, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return page, fmt.Errorf("status %s", resp.Status)
+	}
+
+	maxBytes := f.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultFetchMaxBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return page, err
+	}
+	if len(body) > maxBytes {
+		body, page.Truncated = body[:maxBytes], true
+	}
+
+	page.ContentType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if page.ContentType == "" || page.ContentType == "application/octet-stream" {
+		page.ContentType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	switch {
+	case page.ContentType == "text/html" || page.ContentType == "application/xhtml+xml":
+		page.Title, page.Text, err = htmlText(ctx, body)
+	case page.ContentType == "application/pdf":
+		if page.Truncated {
+			return page, fmt.Errorf("pdf is larger than %d bytes", maxBytes)
+		}
+		page.Text, err = pdfText(ctx, body)
+	case strings.HasPrefix(page.ContentType, "text/") || page.ContentType == "application/json" || page.ContentType == "application/xml":
+		page.Text = strings.ToValidUTF8(string(body), "")
+	default:
+		return page, fmt.Errorf("can't read %s files", page.ContentType)
+	}
+	if err != nil {
+		return page, fmt.Errorf("reading %s: %w", page.ContentType, err)
+	}
+	page.Text = cleanText(page.Text)
+	return page, nil
+}
+
+// elements without content of the page
+const htmlNoise = "script, style, noscript, template, iframe, svg, canvas, form, button, nav, header, footer, aside, [role=navigation], [role=banner], [role=contentinfo], [aria-hidden=true]"
+
+// block elements, their text is kept on separate lines
+const htmlBlocks = "p, div, section, article, li, tr, h1, h2, h3, h4, h5, h6, pre, blockquote, br, dt, dd"
+
+// pages without article markup need a block with this much paragraph text to take it as the article
+const minArticleChars = 250
+
+// htmlText returns title and readable text of the main content of a page (article without menus, ads and scripts)
+func htmlText(ctx context.Context, body []byte) (string, string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+	if title == "" {
+		title = strings.TrimSpace(doc.Find("h1").First().Text())
+	}
+	doc.Find(htmlNoise).Remove()
+
+	content := mainContent(doc)
+	content.Find(htmlBlocks).AfterHtml("\n")
+	markup, err := goquery.OuterHtml(content)
+	if err != nil {
+		return title, "", err
+	}
+	// the same loader as for /setcontext documents, it sanitizes text of the page
+	docs, err := documentloaders.NewHTML(strings.NewReader(markup)).Load(ctx)
+	if err != nil || len(docs) == 0 {
+		return title, "", err
+	}
+	return title, html.UnescapeString(docs[0].PageContent), nil
+}
+
+// mainContent picks article of the page: the largest article or main element,
+// or the block with the most paragraph text, or the whole body if there is no such block
+func mainContent(doc *goquery.Document) *goquery.Selection {
+	var best *goquery.Selection
+	bestLen := 0
+	doc.Find("article, main, [role=main]").Each(func(_ int, s *goquery.Selection) {
+		if n := len(strings.TrimSpace(s.Text())); n > bestLen {
+			best, bestLen = s, n
+		}
+	})
+	if best != nil && bestLen >= minArticleChars {
+		return best
+	}
+
+	scores := map[*html.Node]int{}
+	var bestNode *html.Node
+	bestLen = 0
+	doc.Find("p").Each(func(_ int, p *goquery.Selection) {
+		parent := p.Parent().Get(0)
+		scores[parent] += len(strings.TrimSpace(p.Text()))
+		if scores[parent] > bestLen {
+			bestNode, bestLen = parent, scores[parent]
+		}
+	})
+	if bestNode != nil && bestLen >= minArticleChars {
+		return doc.FindNodes(bestNode)
+	}
+	return doc.Find("body")
+}
+
+// pdfText returns text of all pages of pdf file
+func pdfText(ctx context.Context, body []byte) (string, error) {
+	docs, err := documentloaders.NewPDF(bytes.NewReader(body), int64(len(body))).Load(ctx)
+	if err != nil {
+		return "", err
+	}
+	pages := []string{}
+	for _, doc := range docs {
+		pages = append(pages, doc.PageContent)
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+// cleanText collapses spaces inside lines and empty lines between them
+func cleanText(text string) string {
+	lines := []string{}
+	empty := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			empty = len(lines) > 0
+			continue
+		}
+		if empty {
+			lines = append(lines, "")
+			empty = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type modelKey struct{}
+
+// withModel returns context giving model of the turn to tools, fetch_url summarizes long pages with it
+func withModel(ctx context.Context, model openai.LLM) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+func modelFrom(ctx context.Context) (openai.LLM, bool) {
+	model, ok := ctx.Value(modelKey{}).(openai.LLM)
+	return model, ok
+}
+
+// fetchURLTool reads pages by url, pages longer than maxChars are summarized part by part (map) and the summaries are combined (reduce)
+type fetchURLTool struct {
+	fetcher  Fetcher
+	maxChars int
+}
+
+// NewFetchURLTool returns "fetch_url" tool, pages longer than maxChars characters are summarized before they are given to the model
+func NewFetchURLTool(fetcher Fetcher, maxChars int) Tool {
+	if maxChars <= 0 {
+		maxChars = defaultFetchMaxChars
+	}
+	return fetchURLTool{fetcher: fetcher, maxChars: maxChars}
+}
+
+func (fetchURLTool) Name() string { return "fetch_url" }
+
+func (fetchURLTool) Description() string {
+	return "Downloads a web page, text or pdf file by url and returns its text, long pages are summarized. Use it when user gives a link or to read a page found by search"
+}
+
+func (fetchURLTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"url": map[string]any{
+				"type":        "string",
+				"description": "http or https url of the page",
+			},
+			"question": map[string]any{
+				"type":        "string",
+				"description": "What to look for on the page, summary of a long page keeps information about it",
+			},
+		},
+		"required": []string{"url"},
+	}
+}
+
+func (t fetchURLTool) Call(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		URL      string `json:"url"`
+		Question string `json:"question"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("bad arguments: %w", err)
+	}
+	page, err := t.fetcher.Fetch(ctx, args.URL)
+	if err != nil {
+		return "", err
+	}
+	if page.Text == "" {
+		return "", fmt.Errorf("%s has no text", page.URL)
+	}
+	AddSource(ctx, Source{Title: page.Title, URL: page.URL})
+
+	var b strings.Builder
+	if page.Title != "" {
+		fmt.Fprintf(&b, "Title: %s\n", page.Title)
+	}
+	fmt.Fprintf(&b, "URL: %s\n", page.URL)
+	if page.Truncated {
+		b.WriteString("The file is too large, only its start was read.\n")
+	}
+	b.WriteString("\n")
+
+	text := page.Text
+	if utf8.RuneCountInString(text) > t.maxChars {
+		model, ok := modelFrom(ctx)
+		if !ok {
+			b.WriteString(cutText(text, t.maxChars) + "\n[the rest of the page is cut]")
+			return b.String(), nil
+		}
+		summary, err := summarize(ctx, model, page, args.Question, t.maxChars)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("The page is too long to read whole, this is its summary:\n")
+		text = summary
+	}
+	b.WriteString(text)
+	return b.String(), nil
+}
+
+// summarize summarizes every part of the page text separately (map) and combines the summaries into one (reduce)
+func summarize(ctx context.Context, model openai.LLM, page Page, question string, maxChars int) (string, error) {
+	parts, err := textsplitter.NewRecursiveCharacter(
+		textsplitter.WithChunkSize(maxChars),
+		textsplitter.WithChunkOverlap(maxChars/20),
+	).SplitText(page.Text)
+	if err != nil {
+		return "", err
+	}
+	if len(parts) > maxFetchParts {
+		parts = parts[:maxFetchParts]
+	}
+	focus := ""
+	if question != "" {
+		focus = " Keep everything related to: " + question
+	}
+
+	summaries := []string{}
+	for i, part := range parts {
+		prompt := fmt.Sprintf("This is part %d of %d of the page %q (%s). Write a concise summary of it, keep facts, names and numbers.%s\n\n%s", i+1, len(parts), page.Title, page.URL, focus, part)
+		var summary string
+		err := generate(ctx, model, func(model openai.LLM) (err error) {
+			summary, err = llms.GenerateFromSinglePrompt(ctx, &model, prompt)
+			return err
+		})
+		if err != nil {
+			return "", fmt.Errorf("summarizing part %d: %w", i+1, err)
+		}
+		summaries = append(summaries, strings.TrimSpace(summary))
+	}
+	if len(summaries) == 1 {
+		return summaries[0], nil
+	}
+
+	combined := cutText(strings.Join(summaries, "\n\n"), maxChars)
+	prompt := fmt.Sprintf("These are summaries of consecutive parts of the page %q (%s). Combine them into one summary of the page without repetitions.%s\n\n%s", page.Title, page.URL, focus, combined)
+	var summary string
+	err = generate(ctx, model, func(model openai.LLM) (err error) {
+		summary, err = llms.GenerateFromSinglePrompt(ctx, &model, prompt)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("combining summaries: %w", err)
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+// cutText returns first n characters of text
+func cutText(text string, n int) string {
+	for i := range text {
+		if n == 0 {
+			return text[:i]
+		}
+		n--
+	}
+	return text
+}
@@ -0,0 +1,151 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/config"
+)
+
+const articlePage = `<html><head><title>Release notes</title><script>var tracking = 1;</script></head><body>
+<header><nav><a href="/">Home</a> <a href="/blog">Blog</a></nav></header>
+<div class="sidebar"><p>Subscribe to our newsletter</p></div>
+<div class="post">
+<h1>Version 2.0</h1>
+<p>Version 2.0 of the library adds streaming of answers, so users see tokens while the model generates them.</p>
+<p>Tool calls are executed in rounds &amp; the model can call several tools at once, results come back before the next round.</p>
+<p>Configuration moved to a single yaml file, environment variables still override values from the file for old setups.</p>
+</div>
+<footer>Copyright</footer>
+</body></html>`
+
+// minimalPDF returns one page pdf file showing text
+func minimalPDF(text string) []byte {
+	stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	offsets := []int{}
+	for i, object := range objects {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return []byte(b.String())
+}
+
+func newSite(t *testing.T, pages map[string][2]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", page[0])
+		fmt.Fprint(w, page[1])
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetch(t *testing.T) {
+	site := newSite(t, map[string][2]string{
+		"/post":      {"text/html; charset=utf-8", articlePage},
+		"/notes.txt": {"text/plain", "line one\n\n\n\nline   two"},
+		"/doc.pdf":   {"application/pdf", string(minimalPDF("Quarterly report"))},
+		"/logo.png":  {"image/png", "\x89PNG"},
+	})
+	fetcher := agent.Fetcher{AllowPrivate: true}
+
+	page, err := fetcher.Fetch(context.Background(), site.URL+"/post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Version 2.0\n\nVersion 2.0 of the library adds streaming of answers, so users see tokens while the model generates them.\n\nTool calls are executed in rounds & the model"
+	if page.Title != "Release notes" || !strings.HasPrefix(page.Text, want) {
+		t.Errorf("unexpected page %q: %q", page.Title, page.Text)
+	}
+	for _, noise := range []string{"Home", "newsletter", "tracking", "Copyright"} {
+		if strings.Contains(page.Text, noise) {
+			t.Errorf("text must have only the article, got %q", page.Text)
+		}
+	}
+
+	page, err = fetcher.Fetch(context.Background(), site.URL+"/notes.txt")
+	if err != nil || page.Text != "line one\n\nline two" {
+		t.Errorf("unexpected text %q, %v", page.Text, err)
+	}
+	page, err = fetcher.Fetch(context.Background(), site.URL+"/doc.pdf")
+	if err != nil || !strings.Contains(page.Text, "Quarterly report") {
+		t.Errorf("unexpected pdf text %q, %v", page.Text, err)
+	}
+	if _, err := fetcher.Fetch(context.Background(), site.URL+"/logo.png"); err == nil || !strings.Contains(err.Error(), "image/png") {
+		t.Errorf("images must be refused, got %v", err)
+	}
+	if _, err := fetcher.Fetch(context.Background(), "file:///etc/passwd"); err == nil {
+		t.Error("only http urls must be fetched")
+	}
+
+	page, err = agent.Fetcher{AllowPrivate: true, MaxBytes: 8}.Fetch(context.Background(), site.URL+"/notes.txt")
+	if err != nil || !page.Truncated || page.Text != "line one" {
+		t.Errorf("file must be cut at the limit, got %+v, %v", page, err)
+	}
+	if _, err := (agent.Fetcher{}).Fetch(context.Background(), site.URL+"/post"); !errors.Is(err, agent.ErrPrivateAddress) {
+		t.Errorf("local addresses must be refused by default, got %v", err)
+	}
+}
+
+func TestAgentSummarizesLongPage(t *testing.T) {
+	cfg := config.Default()
+	cfg.Fetch = config.Fetch{MaxBytes: 1 << 20, MaxChars: 1000, AllowPrivate: true}
+	agent.Configure(cfg)
+	defer configureAgent(t, 5)
+
+	first, second := strings.Repeat("Alpha paragraph. ", 50), strings.Repeat("Beta paragraph. ", 50)
+	site := newSite(t, map[string][2]string{
+		"/long": {"text/html", "<title>Long read</title><p>" + first + "</p><p>" + second + "</p>"},
+	})
+	model, script := newScriptedModel(t,
+		callsReply([2]string{"fetch_url", fmt.Sprintf(`{"url":%q,"question":"what about beta?"}`, site.URL+"/long")}),
+		textReply("alpha summary"),
+		textReply("beta summary"),
+		textReply("combined summary"),
+		textReply("Beta is described there."),
+	)
+	answer, err := agent.Run("summarize "+site.URL+"/long", model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(script.requests) != 5 {
+		t.Fatalf("expected call, two parts, reduce and answer, got %d requests", len(script.requests))
+	}
+	if !strings.Contains(script.requests[1], "part 1 of 2") || !strings.Contains(script.requests[1], "Alpha paragraph") || !strings.Contains(script.requests[1], "what about beta?") {
+		t.Errorf("first part must be summarized with the question: %s", script.requests[1])
+	}
+	if !strings.Contains(script.requests[3], `alpha summary\n\nbeta summary`) {
+		t.Errorf("summaries of parts must be combined: %s", script.requests[3])
+	}
+	if !strings.Contains(script.requests[4], "combined summary") || strings.Contains(script.requests[4], "Alpha paragraph") {
+		t.Errorf("agent must see the summary instead of the page: %s", script.requests[4])
+	}
+	if want := "Beta is described there.\n\nSources:\n1. [Long read](" + site.URL + "/long)"; answer != want {
+		t.Errorf("answer %q, want %q", answer, want)
+	}
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ImageSender generates image by prompt and sends it to the chat of the dialog as a photo.
+// Errors (e.g. quota of images is used) are given to the model, so it can tell the user.
+type ImageSender func(ctx context.Context, prompt, size string) error
+
+// ErrNoImageSender is returned by generate_image tool if Run context has no ImageSender, e.g. in http api
+var ErrNoImageSender = errors.New("images can't be sent to this chat")
+
+// sizes generate_image accepts, the first one is used by default
+var imageSizes = []string{"256x256", "512x512"}
+
+type imageSenderKey struct{}
+
+// WithImageSender returns context for RunContext in which generate_image tool delivers images with send
+func WithImageSender(ctx context.Context, send ImageSender) context.Context {
+	return context.WithValue(ctx, imageSenderKey{}, send)
+}
+
+type imagesKey struct{}
+
+// imagePrompts are prompts of images sent during Run. History keeps only answers,
+// so prompts are appended to the answer and the model can refine them in next turns.
+type imagePrompts struct {
+	mu   sync.Mutex
+	list []string
+}
+
+// withImagePrompts returns context collecting prompts of sent images
+func withImagePrompts(ctx context.Context) (context.Context, *imagePrompts) {
+	prompts := &imagePrompts{}
+	return context.WithValue(ctx, imagesKey{}, prompts), prompts
+}
+
+func (p *imagePrompts) add(prompt string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.list = append(p.list, prompt)
+}
+
+// appendTo adds prompts of the images to the answer
+func (p *imagePrompts) appendTo(answer string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, prompt := range p.list {
+		// telegram markdown breaks on these
+		prompt = strings.NewReplacer("`", "", "*", "", "_", " ", "[", "(", "]", ")").Replace(prompt)
+		answer += "\n\nImage prompt: " + prompt
+	}
+	return answer
+}
+
+// generateImageTool generates images with ImageSender of the Run context
+type generateImageTool struct{}
+
+func (generateImageTool) Name() string { return "generate_image" }
+
+func (generateImageTool) Description() string {
+	return "Generates an image with stable diffusion and sends it to the user as a photo. To change an image the user already got, call it again with the previous prompt refined"
+}
+
+func (generateImageTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"prompt": map[string]any{
+				"type":        "string",
+				"description": "Detailed description of the image in English: subject, style, colors, composition",
+			},
+			"size": map[string]any{
+				"type":        "string",
+				"enum":        imageSizes,
+				"description": "Size of the image, " + imageSizes[0] + " if not set",
+			},
+		},
+		"required": []string{"prompt"},
+	}
+}
+
+func (generateImageTool) Call(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Prompt string `json:"prompt"`
+		Size   string `json:"size"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("bad arguments: %w", err)
+	}
+	args.Prompt = strings.TrimSpace(args.Prompt)
+	if args.Prompt == "" {
+		return "", fmt.Errorf("prompt is empty")
+	}
+	if args.Size == "" {
+		args.Size = imageSizes[0]
+	}
+	if !slices.Contains(imageSizes, args.Size) {
+		return "", fmt.Errorf("size must be one of %s", strings.Join(imageSizes, ", "))
+	}
+
+	send, ok := ctx.Value(imageSenderKey{}).(ImageSender)
+	if !ok {
+		return "", ErrNoImageSender
+	}
+	if err := send(ctx, args.Prompt, args.Size); err != nil {
+		return "", err
+	}
+	if prompts, ok := ctx.Value(imagesKey{}).(*imagePrompts); ok {
+		prompts.add(args.Prompt)
+	}
+	return "The image is generated and sent to the user as a photo, prompt: " + args.Prompt + "\nThe user already sees it, don't link or describe it in detail, tell briefly what was drawn.", nil
+}
@@ -0,0 +1,67 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/agent"
+)
+
+func TestAgentGeneratesImage(t *testing.T) {
+	configureAgent(t, 5)
+	sent := []string{}
+	ctx := agent.WithImageSender(context.Background(), func(ctx context.Context, prompt, size string) error {
+		if prompt == "fail" {
+			return errors.New("daily limit of 1 images is reached")
+		}
+		sent = append(sent, prompt+" "+size)
+		return nil
+	})
+
+	model, script := newScriptedModel(t,
+		callsReply([2]string{"generate_image", `{"prompt":"a red cat on a roof, watercolor"}`}),
+		textReply("Here is a red cat."),
+	)
+	state, answer, err := agent.RunThread(ctx, "draw me a cat", model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(sent, ",") != "a red cat on a roof, watercolor 256x256" {
+		t.Errorf("unexpected images %v", sent)
+	}
+	if !strings.Contains(script.requests[1], "sent to the user as a photo") {
+		t.Errorf("agent must get confirmation: %s", script.requests[1])
+	}
+	if answer != "Here is a red cat.\n\nImage prompt: a red cat on a roof, watercolor" {
+		t.Errorf("prompt must be kept in the answer, got %q", answer)
+	}
+
+	// next turn refines the prompt it sees in history
+	model, script = newScriptedModel(t,
+		callsReply([2]string{"generate_image", `{"prompt":"a blue cat on a roof, watercolor","size":"512x512"}`}, [2]string{"generate_image", `{"prompt":"fail"}`}),
+		textReply("Now it's blue."),
+	)
+	if _, _, err := agent.RunThread(ctx, "make it blue", model, state...); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script.requests[0], "Image prompt: a red cat on a roof") {
+		t.Errorf("previous prompt must be in history: %s", script.requests[0])
+	}
+	if len(sent) != 2 || sent[1] != "a blue cat on a roof, watercolor 512x512" {
+		t.Errorf("unexpected images %v", sent)
+	}
+	if !strings.Contains(script.requests[1], "error: daily limit of 1 images is reached") {
+		t.Errorf("errors of sender must be given to the model: %s", script.requests[1])
+	}
+
+	// http api has no chat for images
+	model, script = newScriptedModel(t, callsReply([2]string{"generate_image", `{"prompt":"cat"}`}), textReply("Can't draw here."))
+	if _, err := agent.Run("draw a cat", model); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script.requests[1], agent.ErrNoImageSender.Error()) {
+		t.Errorf("model must know images can't be sent: %s", script.requests[1])
+	}
+}
@@ -0,0 +1,177 @@
+package agent_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// scriptedLLM is an openai compatible endpoint answering chat completions with replies in order,
+// the last reply is repeated. Request bodies are kept.
+type scriptedLLM struct {
+	mu       sync.Mutex
+	replies  []string
+	requests []string
+}
+
+func (s *scriptedLLM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply := s.replies[min(len(s.requests), len(s.replies)-1)]
+	s.requests = append(s.requests, string(body))
+	fmt.Fprintf(w, `{"choices":[{"index":0,"message":%s,"finish_reason":"stop"}]}`, reply)
+}
+
+func textReply(content string) string {
+	reply, _ := json.Marshal(map[string]any{"role": "assistant", "content": content})
+	return string(reply)
+}
+
+func callsReply(calls ...[2]string) string {
+	toolCalls := []map[string]any{}
+	for i, c := range calls {
+		toolCalls = append(toolCalls, map[string]any{
+			"id":       fmt.Sprintf("call_%d", i),
+			"type":     "function",
+			"function": map[string]any{"name": c[0], "arguments": c[1]},
+		})
+	}
+	reply, _ := json.Marshal(map[string]any{"role": "assistant", "content": "", "tool_calls": toolCalls})
+	return string(reply)
+}
+
+func newScriptedModel(t *testing.T, replies ...string) (openai.LLM, *scriptedLLM) {
+	script := &scriptedLLM{replies: replies}
+	server := httptest.NewServer(script)
+	t.Cleanup(server.Close)
+	model, err := openai.New(openai.WithToken("key"), openai.WithBaseURL(server.URL), openai.WithModel("llama"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *model, script
+}
+
+func configureAgent(t *testing.T, iterations int) {
+	cfg := config.Default()
+	cfg.AI.AgentMaxIterations = iterations
+	agent.Configure(cfg)
+	agent.DefaultTools.Register(echoTool{name: "echo"})
+}
+
+func TestAgentCallsSeveralToolsInRounds(t *testing.T) {
+	configureAgent(t, 5)
+	model, script := newScriptedModel(t,
+		callsReply([2]string{"echo", `{"q":"a"}`}, [2]string{"echo", `{"q":"b"}`}),
+		callsReply([2]string{"echo", `{"q":"c"}`}),
+		textReply("done"),
+	)
+
+	answer, err := agent.Run("hi", model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "done" || len(script.requests) != 3 {
+		t.Fatalf("answer %q after %d requests", answer, len(script.requests))
+	}
+	for _, want := range []string{`echo {\"q\":\"a\"}`, `echo {\"q\":\"b\"}`} {
+		if !strings.Contains(script.requests[1], want) {
+			t.Errorf("second round must see result %s: %s", want, script.requests[1])
+		}
+	}
+	if !strings.Contains(script.requests[2], `echo {\"q\":\"c\"}`) || !strings.Contains(script.requests[2], `"tools"`) {
+		t.Errorf("third round must see results of both rounds and still have tools: %s", script.requests[2])
+	}
+}
+
+func TestAgentIterationsBudget(t *testing.T) {
+	configureAgent(t, 2)
+	defer configureAgent(t, 5)
+	model, script := newScriptedModel(t,
+		callsReply([2]string{"echo", `{}`}),
+		callsReply([2]string{"echo", `{}`}),
+		textReply("had to answer"),
+	)
+
+	answer, err := agent.Run("loop forever", model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "had to answer" || len(script.requests) != 3 {
+		t.Fatalf("answer %q after %d requests", answer, len(script.requests))
+	}
+	if strings.Contains(script.requests[2], `"tools"`) {
+		t.Error("tools must not be offered after the budget is used")
+	}
+}
+
+func TestAgentParsesToolCallsFromText(t *testing.T) {
+	configureAgent(t, 5)
+	model, script := newScriptedModel(t,
+		textReply("Let me check.\n<tool_call>\n{\"name\": \"echo\", \"arguments\": {\"q\": \"text\"}}\n</tool_call>"),
+		textReply("done"),
+	)
+
+	answer, err := agent.Run("hi", model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "done" || len(script.requests) != 2 {
+		t.Fatalf("answer %q after %d requests", answer, len(script.requests))
+	}
+	if !strings.Contains(script.requests[1], `echo {\"q\": \"text\"}`) {
+		t.Errorf("tool from text must be called: %s", script.requests[1])
+	}
+}
+
+func TestParseToolCalls(t *testing.T) {
+	r := agent.NewRegistry(echoTool{name: "echo"}, echoTool{name: "search"})
+	tests := []struct {
+		text  string
+		calls []string // name(arguments)
+		rest  string
+	}{
+		{`{"name": "echo", "arguments": {"q": 1}}`, []string{`echo({"q": 1})`}, ""},
+		{"Sure.\n```json\n[{\"name\":\"echo\",\"parameters\":{}},{\"function\":{\"name\":\"search\",\"arguments\":\"{\\\"query\\\":\\\"go\\\"}\"}}]\n```", []string{`echo({})`, `search({"query":"go"})`}, "Sure."},
+		{`{"name": "echo"} and {"name": "search", "arguments": null}`, []string{`echo({})`, `search({})`}, "and"},
+		{`Here is JSON you asked for: {"name": "Bob", "arguments": {}}`, nil, `Here is JSON you asked for: {"name": "Bob", "arguments": {}}`},
+		{`[1, 2] {broken`, nil, `[1, 2] {broken`},
+	}
+	for _, tt := range tests {
+		calls, rest := r.ParseToolCalls(tt.text, "text")
+		got := []string{}
+		for i, c := range calls {
+			got = append(got, fmt.Sprintf("%s(%s)", c.FunctionCall.Name, c.FunctionCall.Arguments))
+			if c.ID != fmt.Sprintf("text_%d", i) {
+				t.Errorf("unexpected id %q", c.ID)
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(tt.calls, " ") || rest != tt.rest {
+			t.Errorf("ParseToolCalls(%q) = %v, %q, want %v, %q", tt.text, got, rest, tt.calls, tt.rest)
+		}
+	}
+}
+
+func TestAgentWithoutChoices(t *testing.T) {
+	configureAgent(t, 5)
+	model, _ := newScriptedModel(t, textReply("never read"))
+	// failover which gives up without calling the model leaves no response
+	ctx := agent.WithModelFailover(context.Background(), func(ctx context.Context, call func(model openai.LLM) error) error {
+		return nil
+	})
+
+	_, _, err := agent.RunThread(ctx, "hi", model)
+	if err == nil || !strings.Contains(err.Error(), "no choices") {
+		t.Fatalf("expected error instead of answer, got %v", err)
+	}
+}
@@ -1,16 +1,18 @@
 package agent
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"net/http"
 
-	"github.com/joho/godotenv"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/openai"
 
+	"github.com/JackBekket/hellper/lib/config"
 	"github.com/JackBekket/hellper/lib/embeddings"
 	"github.com/JackBekket/langgraphgo/graph"
 )
@@ -43,295 +45,284 @@ import (
 
 */
 
-// global var
-var Model openai.LLM
-var Tools []llms.Tool
+// settings of the bot, semanticSearch tool takes endpoint, key and embeddings db from here if Run context has no Embeddings
+var settings config.Config
+
+// Embeddings is where semanticSearch tool makes embeddings of the query and looks for documents,
+// empty fields are taken from settings
+type Embeddings struct {
+	Endpoint    string
+	APIKey      string
+	DatabaseURL string
+	// Client sends requests to Endpoint, http.DefaultClient if nil
+	Client *http.Client
+}
 
-// This is the main function for this package
-func OneShotRun(prompt string, model openai.LLM, history_state ...llms.MessageContent) string {
+type embeddingsKey struct{}
 
-	// Operation with message STATE stack
-	agentState := []llms.MessageContent{
-		llms.TextParts(llms.ChatMessageTypeSystem, "You are helpful agent that has access to a semanticSearch tool. Use this tool if user ask to retrive some information from database/collection to provide user with information he/she looking for."),
+// WithEmbeddings returns context for RunContext in which semanticSearch tool uses endpoint and key of the user (e.g. of selected provider)
+func WithEmbeddings(ctx context.Context, e Embeddings) context.Context {
+	return context.WithValue(ctx, embeddingsKey{}, e)
+}
+
+// embeddingsFrom returns Embeddings of the context with empty fields filled from settings
+func embeddingsFrom(ctx context.Context) Embeddings {
+	e, _ := ctx.Value(embeddingsKey{}).(Embeddings)
+	if e.Endpoint == "" {
+		e.Endpoint = settings.AI.Endpoint
 	}
-	intialState := []llms.MessageContent{
-		llms.TextParts(llms.ChatMessageTypeSystem, "Below a current conversation between user and helpful AI assistant. You (assistant) should help user in any task he/she ask you to do."),
+	if e.APIKey == "" {
+		e.APIKey = settings.AI.APIKey
+	}
+	if e.DatabaseURL == "" {
+		e.DatabaseURL = settings.Database.URL
+	}
+	if e.Client == nil {
+		e.Client = http.DefaultClient
 	}
+	return e
+}
 
-	if len(history_state) > 0 { // if there are previouse message state then we first load it into message state
-		// Access the first element of the slice
-		history := history_state
-		// ... use the history variable as needed
-		for _, message := range history {
-			intialState = append(intialState, message) // load history as initial state
-		}
-		intialState = append(
-			intialState,
-			agentState..., // append agent system prompt
-		)
-		intialState = append(
-			intialState,
-			llms.TextParts(llms.ChatMessageTypeHuman, prompt), //append user input (!)
-		)
-	} else {
-		//intialState = agentState    //history is empty -- load agentState as initial_state and append user prompt
-		intialState = append(
-			intialState,
-			llms.TextParts(llms.ChatMessageTypeHuman, prompt),
-		)
+// Configure passes settings loaded at startup to the agent and sets up web search backend and fetch_url limits, call it before running agents
+func Configure(cfg *config.Config) {
+	settings = *cfg
+	switch cfg.Search.Provider {
+	case SearchOff:
+		DefaultTools.Unregister("search")
+	case SearchSearxNG:
+		DefaultTools.Register(NewWebSearchTool(SearxNG{URL: cfg.Search.SearxNGURL}, cfg.Search.Results))
+	default:
+		DefaultTools.Register(NewWebSearchTool(DuckDuckGo{}, cfg.Search.Results))
+	}
+	DefaultTools.Register(NewFetchURLTool(Fetcher{MaxBytes: cfg.Fetch.MaxBytes, AllowPrivate: cfg.Fetch.AllowPrivate}, cfg.Fetch.MaxChars))
+}
 
+// This is the main function for this package, errors are returned as text of the answer (see Run)
+func OneShotRun(prompt string, model openai.LLM, history_state ...llms.MessageContent) string {
+	result, err := Run(prompt, model, history_state...)
+	if err != nil {
+		return fmt.Sprintf("error :%v", err)
 	}
+	return result
+}
 
-	// toolS definition interfaces
-	tools := []llms.Tool{
-		{
-			Type: "function",
-			Function: &llms.FunctionDefinition{
-				Name:        "search",
-				Description: "Preforms Duck Duck Go web search",
-				Parameters: map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"query": map[string]any{
-							"type":        "string",
-							"description": "The search query",
-						},
-					},
-				},
-			},
-		},
-		{
-			Type: "function",
-			Function: &llms.FunctionDefinition{
-				Name:        "semanticSearch",
-				Description: "Performs semantic search using a vector store",
-				Parameters: map[string]any{
-					"type": "object",
-					"properties": map[string]any{
-						"query": map[string]any{
-							"type":        "string",
-							"description": "The search query",
-						},
-						"collection": map[string]any{ //TODO: there should NOT exist arguments which called NAME cause it cause COLLISION with actual function name.    .....more like confusion then collision so there are no error
-							"type":        "string",
-							"description": "name of collection store in which we perform the search",
-						},
-					},
-				},
-			},
-		},
+// Run works like OneShotRun, but returns error of the graph (e.g. endpoint is unreachable), so caller can retry it
+func Run(prompt string, model openai.LLM, history_state ...llms.MessageContent) (string, error) {
+	return RunContext(context.Background(), prompt, model, history_state...)
+}
+
+// RunContext is Run with context passed to tools, e.g. WithImageSender lets generate_image deliver images to the chat
+func RunContext(ctx context.Context, prompt string, model openai.LLM, history_state ...llms.MessageContent) (string, error) {
+
+	// Operation with message STATE stack
+	agentState := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "You are helpful agent that has access to tools:\n"+DefaultTools.Describe()+"Call tools when the answer needs them, you can call several tools at once and call tools again after you see their results. Use semanticSearch if user ask to retrive some information from database/collection to provide user with information he/she looking for. Use fetch_url to read links user gives you. Use generate_image if user asks to draw something. Answer without tools if you can."),
+	}
+	intialState := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "Below a current conversation between user and helpful AI assistant. You (assistant) should help user in any task he/she ask you to do."),
 	}
 
-	Tools = tools
-	Model = model
+	// history (if any) goes first, then agent system prompt and user input
+	intialState = append(intialState, history_state...)
+	intialState = append(intialState, agentState...)
+	intialState = append(
+		intialState,
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt), //append user input (!)
+	)
 
 	// MAIN WORKFLOW
 	workflow := graph.NewMessageGraph()
 
-	workflow.AddNode("agent", agent)                   // see agent function
-	workflow.AddNode("semanticSearch", semanticSearch) // see semantic search function
+	workflow.AddNode("agent", newAgent(model, DefaultTools, maxIterations())) // see newAgent function
+	workflow.AddNode("tools", DefaultTools.Node())                            // executes tool calls of the agent, see Registry.Call
 
-	workflow.SetEntryPoint("agent")                             // we start with agent
-	workflow.AddConditionalEdge("agent", shouldSearchDocuments) // if agent decide and called semamnticSearch, then this function will handle call, and make an actual tool call
-	workflow.AddEdge("semanticSearch", "agent")                 // return result of the search back to agent
+	workflow.SetEntryPoint("agent")                       // we start with agent
+	workflow.AddConditionalEdge("agent", shouldCallTools) // if agent called tools, "tools" node makes actual calls
+	workflow.AddEdge("tools", "agent")                    // return results of the tools back to agent
 
 	app, err := workflow.Compile()
 	if err != nil {
 		log.Printf("error: %v", err)
-		return fmt.Sprintf("error :%v", err)
+		return "", err
 	}
 
-	response, err := app.Invoke(context.Background(), intialState)
+	// tools put web pages they used into sources and prompts of sent images into images, both are appended to the answer
+	ctx, sources := withSources(withModel(ctx, model))
+	ctx, images := withImagePrompts(ctx)
+	response, err := app.Invoke(ctx, intialState)
 	if err != nil {
 		log.Printf("error: %v", err)
-		return fmt.Sprintf("error :%v", err)
+		return "", err
 	}
 
 	lastMsg := response[len(response)-1]
 	log.Printf("last msg: %v", lastMsg.Parts[0])
 	result := lastMsg.Parts[0]
 	result_str := fmt.Sprintf("%v", result)
-	return result_str
+	return sources.appendTo(images.appendTo(result_str)), nil
 }
 
-// AGENT NODE
-/** We are telling agent, that it should response withTools, giving it function signatures defined earlier.
-  if agent get response from conditional edge like 'yes, use x function with this signatures and this json object as input parameters -- it will match with predefined pointer to semanticSearch function and it will make a toolCall
-  then it will append toolCall to message state.
-  Agent will recive current stake, make consideration whether or not to use tool and make a call for it
-  `shouldSearchDocuments` func will handle this tool call -- it will call semanticSearch function
-  Then result of the search tool will go back to agent as a toolResonse in the messages state
-*/
-func agent(ctx context.Context, state []llms.MessageContent) ([]llms.MessageContent, error) {
+// default limit of tool rounds in one turn, see config.AI.AgentMaxIterations
+const defaultMaxIterations = 5
 
-	agentState := []llms.MessageContent{
-		llms.TextParts(llms.ChatMessageTypeSystem, "You are helpful agent that has access to a semanticSearch tool. Use this tool if user ask to retrive some information from database/collection to provide user with information he/she looking for."),
+func maxIterations() int {
+	if settings.AI.AgentMaxIterations > 0 {
+		return settings.AI.AgentMaxIterations
 	}
-	model := Model // global... should be .env or getting from user context I guess.
-	tools := Tools
+	return defaultMaxIterations
+}
 
-	consideration_query := []llms.MessageContent{
-		llms.TextParts(llms.ChatMessageTypeSystem, "You are decision making agent, which can reply ONLY 'true' or 'false'.Your task is to determine whether or not to call semanticSearch function based on human input. If you see a basic question, return false. If user specified that he desires to use that function, return true. You should ONLY return 'true' or 'false'."),
+// toolRounds counts agent messages with tool calls after the last user message
+func toolRounds(state []llms.MessageContent) int {
+	rounds := 0
+	for i := len(state) - 1; i >= 0 && state[i].Role != llms.ChatMessageTypeHuman; i-- {
+		if state[i].Role == llms.ChatMessageTypeAI && len(toolCalls(state[i])) > 0 {
+			rounds++
+		}
 	}
+	return rounds
+}
+
+// AGENT NODE
+/** ReAct loop: agent calls the model with tool definitions from the registry. If the model calls tools (natively in ToolCalls,
+  or as JSON in text for LocalAI models which don't support tools, see Registry.ParseToolCalls), calls are put into the message state
+  and "tools" node executes them, then results come back to the agent as tool responses for the next round.
+  Several tools can be called at once. After maxIterations rounds tools are not offered anymore, so the model has to answer.
+  Graph ends when the model answers without tool calls.
+*/
+func newAgent(model openai.LLM, tools *Registry, maxIterations int) func(ctx context.Context, state []llms.MessageContent) ([]llms.MessageContent, error) {
+	return func(ctx context.Context, state []llms.MessageContent) ([]llms.MessageContent, error) {
+		rounds := toolRounds(state)
+		options := streamingOptions(model)
+		messages := state
+		if rounds < maxIterations {
+			options = append(options, llms.WithTools(tools.Definitions()))
+		} else {
+			log.Printf("agent used %d tool rounds, asking for the answer", rounds)
+			messages = append(messages[:len(messages):len(messages)], llms.TextParts(llms.ChatMessageTypeSystem, "Tools are not available anymore. Answer the user with information you already have."))
+		}
 
-	lastMsg := state[len(state)-1]
-	if lastMsg.Role == "tool" { // If we catch response from tool then it's second iteration and we simply need to give answer to user using this result
-		state = append(state, lastMsg)
-		response, err := model.GenerateContent(ctx, state)
+		var response *llms.ContentResponse
+		err := generate(ctx, model, func(model openai.LLM) (err error) {
+			response, err = model.GenerateContent(ctx, messages, options...)
+			return err
+		})
 		if err != nil {
 			return state, err
 		}
-		msg := llms.TextParts(llms.ChatMessageTypeAI, response.Choices[0].Content)
-		state = append(state, msg)
-		return state, nil
-
-	} else { // If it is not tool response
-
-		if lastMsg.Role == "human" { //                                            any user request
-			//state
-			consideration_stack := append(consideration_query, lastMsg)
-			//consideration_stack := append(consideration_query, state...)  // this is appending current state, but we actually need only last message here.
-			check, err := model.GenerateContent(ctx, consideration_stack) // one punch which determine wheter or not call tools. this is hardcode and probably should be separate part of the graph.
-			if err != nil {
-				return state, err
-			}
-			check_txt := fmt.Sprintf(check.Choices[0].Content)
-			log.Println("check result: ", check_txt)
-
-			if check_txt == "true" { // tool call required by one-shot agent
-				state = append(state, agentState...)
-				state = append(state, lastMsg)
-				response, err := model.GenerateContent(ctx, state, llms.WithTools(tools)) // AI call tool function.. in this step it just put call in messages stack
-				if err != nil {
-					return state, err
-				}
-				msg := llms.TextParts(llms.ChatMessageTypeAI, response.Choices[0].Content)
-
-				if len(response.Choices[0].ToolCalls) > 0 {
-					for _, toolCall := range response.Choices[0].ToolCalls {
-						if toolCall.FunctionCall.Name == "semanticSearch" { // AI catch that there is a function call in messages, so *now* it actually calls the function.
-
-							msg.Parts = append(msg.Parts, toolCall) // Add result to messages stack
-
-						}
-					}
-					state = append(state, msg)
-					return state, nil
-				}
-			} else { // proceed without tools
-				response, err := model.GenerateContent(ctx, state)
-				if err != nil {
-					return state, err
-				}
-				msg := llms.TextParts(llms.ChatMessageTypeAI, response.Choices[0].Content)
-				state = append(state, msg)
-				return state, nil
-			}
-		} // end if human
-		return state, nil
-	} // end if not tool response
+		// failover may return without calling the model, endpoints may answer without choices
+		if response == nil || len(response.Choices) == 0 {
+			return state, errors.New("model returned no choices")
+		}
+		choice := response.Choices[0]
+		content, calls := choice.Content, choice.ToolCalls
+		if len(calls) == 0 && rounds < maxIterations {
+			calls, content = tools.ParseToolCalls(content, fmt.Sprintf("call_%d", rounds))
+		}
+
+		msg := llms.TextParts(llms.ChatMessageTypeAI, content)
+		for _, toolCall := range calls { // AI put calls in messages stack, "tools" node actually calls the functions
+			msg.Parts = append(msg.Parts, toolCall)
+		}
+		return append(state, msg), nil
+	}
 }
 
-// this function is only HANDLES tool calls, so this is a handler, not a deciding mechanism. agent decide whether or not to call tool in agent func and this func is handling tool call here.
-func shouldSearchDocuments(ctx context.Context, state []llms.MessageContent) string {
-	// this function (I suppose) can be reworked to work with a *set* of a functions, not just one func.
+// ModelFailover makes call with the model of the turn or, while it fails, with models of other endpoints.
+// Only requests to the model are retried this way, so tools with side effects (e.g. generate_image) are not called again.
+type ModelFailover func(ctx context.Context, call func(model openai.LLM) error) error
 
-	lastMsg := state[len(state)-1]
-	for _, part := range lastMsg.Parts {
-		toolCall, ok := part.(llms.ToolCall)
+type failoverKey struct{}
 
-		if ok && toolCall.FunctionCall.Name == "semanticSearch" {
-			log.Printf("agent should use SemanticSearch (embeddings similarity search aka DocumentsSearch)")
-			return "semanticSearch"
-		}
-	}
+// WithModelFailover returns context for RunContext in which every request to the model goes through failover
+func WithModelFailover(ctx context.Context, failover ModelFailover) context.Context {
+	return context.WithValue(ctx, failoverKey{}, failover)
+}
 
-	return graph.END // never reach this point, should be removed?
+// generate makes call with the model, through ModelFailover of the context if it has one
+func generate(ctx context.Context, model openai.LLM, call func(model openai.LLM) error) error {
+	if failover, ok := ctx.Value(failoverKey{}).(ModelFailover); ok {
+		return failover(ctx, call)
+	}
+	return call(model)
 }
 
-// This function is performing similarity search in our db vectorstore.
-func semanticSearch(ctx context.Context, state []llms.MessageContent) ([]llms.MessageContent, error) {
-	lastMsg := state[len(state)-1]
-
-	for _, part := range lastMsg.Parts {
-		toolCall, ok := part.(llms.ToolCall)
-		if ok && toolCall.FunctionCall.Name == "semanticSearch" {
-
-			// TODO: Extract query and store parameters from the arguments
-			// (logic to extract necessary values for SemanticSearch call)
-			var args struct {
-				Query string `json:"query"`
-				//Store string `json:"store"`
-				//Options []map[string]any `json:"options"`
-				Collection string `json:"collection"` //TODO: ALWAYS CHECK THIS JSON REFERENCE WHEN ALTERING VARS
-			}
-			if err := json.Unmarshal([]byte(toolCall.FunctionCall.Arguments), &args); err != nil {
-				// Handle any errors in deserializing the arguments
-				log.Println("error unmurshal json")
-				return state, err
-			}
-			// Extract query from the args structure
-			searchQuery := args.Query
-
-			//get env
-			_ = godotenv.Load()
-			ai_url := os.Getenv("AI_ENDPOINT") // there are global, there might be resetting.
-			api_token := os.Getenv("OPENAI_API_KEY")
-			db_link := os.Getenv("EMBEDDINGS_DB_URL")
-
-			log.Println("Collection Name: ", args.Collection)
-			log.Println("db_link: ", db_link)
-
-			// Retrieve your vector store based on the store value in the args
-			// You'll likely need to have a method for getting the vector store based
-			// on the store string ("store" value in the args)
-			store, err := embeddings.GetVectorStoreWithOptions(ai_url, api_token, db_link, args.Collection) // TODO: changed argument 'Name' to 'CollectionName' or something like that
-			if err != nil {
-				// Handle errors in retrieving the vector store
-				log.Println("error getting store")
-				return state, err
+// streamingOptions makes model stream answer tokens into its callbacks handler (HandleStreamingFunc), so user can see the answer while it's generated.
+// Tool call deltas are not passed to the handler, they are not meant for the user.
+func streamingOptions(model openai.LLM) []llms.CallOption {
+	if model.CallbacksHandler == nil {
+		return nil
+	}
+	return []llms.CallOption{
+		llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			if !isToolCallChunk(chunk) {
+				model.CallbacksHandler.HandleStreamingFunc(ctx, chunk)
 			}
+			return nil
+		}),
+	}
+}
+
+// isToolCallChunk reports whether streamed chunk is a tool call delta (openai client streams them as JSON array)
+func isToolCallChunk(chunk []byte) bool {
+	var deltas []struct {
+		Function *json.RawMessage `json:"function"`
+	}
+	return bytes.HasPrefix(chunk, []byte("[{")) && json.Unmarshal(chunk, &deltas) == nil && len(deltas) > 0 && deltas[0].Function != nil
+}
 
-			log.Println("store:", store) // actually return empty store in case of error (!)
+// semanticSearchTool performs similarity search in our db vectorstore (embeddings of documents, see /setcontext)
+type semanticSearchTool struct{}
 
-			maxResults := 1 // Set your desired maxResults here
-			//options := args.Options // Pass in any additional options as needed
+func (semanticSearchTool) Name() string { return "semanticSearch" }
 
-			// Call *real* SemanticSearch function
-			searchResults, err := embeddings.SemanticSearch(
-				searchQuery,
-				maxResults,
-				store,
-				// options, // Pass in any additional options you need
-			)
+func (semanticSearchTool) Description() string {
+	return "Performs semantic search using a vector store"
+}
 
-			if err != nil {
-				log.Printf("semantic search error: %v", err)
-				return state, err
-			}
+func (semanticSearchTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{
+				"type":        "string",
+				"description": "The search query",
+			},
+			"collection": map[string]any{ //TODO: there should NOT exist arguments which called NAME cause it cause COLLISION with actual function name.    .....more like confusion then collision so there are no error
+				"type":        "string",
+				"description": "name of collection store in which we perform the search",
+			},
+		},
+	}
+}
+
+func (semanticSearchTool) Call(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Query      string `json:"query"`
+		Collection string `json:"collection"` //TODO: ALWAYS CHECK THIS JSON REFERENCE WHEN ALTERING VARS
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("bad arguments: %w", err)
+	}
 
-			// Format and return search results
-			// ... (process and format search results from SemanticSearch)
-			//toolResponse := []string{} // Initialize an empty slice to store extracted text
-			toolResponse := ""
-			for _, result := range searchResults {
-				//toolResponse = append(toolResponse, result.PageContent)
-				toolResponse += result.PageContent + "\n"
+	e := embeddingsFrom(ctx)
 
-			}
+	log.Println("Collection Name: ", args.Collection)
 
-			msg := llms.MessageContent{
-				Role: llms.ChatMessageTypeTool,
-				Parts: []llms.ContentPart{
-					llms.ToolCallResponse{
-						ToolCallID: toolCall.ID,
-						Name:       toolCall.FunctionCall.Name,
-						Content:    toolResponse,
-					},
-				},
-			}
-			state = append(state, msg)
-		}
+	store, err := embeddings.GetVectorStoreWithOptions(e.Endpoint, e.APIKey, e.DatabaseURL, args.Collection, e.Client)
+	if err != nil {
+		return "", fmt.Errorf("getting store: %w", err)
+	}
+
+	maxResults := 1 // Set your desired maxResults here
+	searchResults, err := embeddings.SemanticSearch(args.Query, maxResults, store)
+	if err != nil {
+		return "", fmt.Errorf("semantic search: %w", err)
+	}
+
+	toolResponse := ""
+	for _, result := range searchResults {
+		toolResponse += result.PageContent + "\n"
 	}
-	return state, nil
+	return toolResponse, nil
 }
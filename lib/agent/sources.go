@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// how many source links are appended to the answer
+const maxSources = 5
+
+// Source is a web page the answer is based on. Tools add sources with AddSource during Run,
+// Run appends links to them to the answer.
+type Source struct {
+	Title string
+	URL   string
+}
+
+type sourcesKey struct{}
+
+type sourceList struct {
+	mu   sync.Mutex
+	list []Source
+}
+
+// withSources returns context collecting sources added by tools
+func withSources(ctx context.Context) (context.Context, *sourceList) {
+	sources := &sourceList{}
+	return context.WithValue(ctx, sourcesKey{}, sources), sources
+}
+
+// AddSource adds source of the answer, sources with the same url are added once.
+// Nothing happens if ctx doesn't come from Run.
+func AddSource(ctx context.Context, source Source) {
+	sources, ok := ctx.Value(sourcesKey{}).(*sourceList)
+	if !ok || source.URL == "" {
+		return
+	}
+	sources.mu.Lock()
+	defer sources.mu.Unlock()
+	for _, s := range sources.list {
+		if s.URL == source.URL {
+			return
+		}
+	}
+	sources.list = append(sources.list, source)
+}
+
+// appendTo adds markdown links to sources not mentioned in the answer yet
+func (l *sourceList) appendTo(answer string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lines := []string{}
+	for _, s := range l.list {
+		if len(lines) == maxSources {
+			break
+		}
+		if strings.Contains(answer, s.URL) {
+			continue
+		}
+		// telegram markdown breaks on these in link text
+		title := strings.TrimSpace(strings.NewReplacer("[", "", "]", "", "*", "", "_", " ", "`", "").Replace(s.Title))
+		if title == "" {
+			title = s.URL
+		}
+		lines = append(lines, fmt.Sprintf("%d. [%s](%s)", len(lines)+1, title, s.URL))
+	}
+	if len(lines) == 0 {
+		return answer
+	}
+	return answer + "\n\nSources:\n" + strings.Join(lines, "\n")
+}
@@ -2,10 +2,9 @@
 package agent
 
 import (
+	"context"
 	"log"
-	"os"
 
-	"github.com/joho/godotenv"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/openai"
 )
@@ -13,29 +12,33 @@ import (
 // This function fire One-Shot agent without history context
 func OnePunch(prompt string) {
 
- llm := CreateGenericLLM()
+ llm := CreateGenericLLM(settings.AI.Endpoint, settings.AdminKey())
  call := OneShotRun(prompt,*&llm)
  log.Println(call)
 }
 
 
 // this function recive previouse history message state and append new user prompt, than run agent
-func RunThread(prompt string, model openai.LLM, history ...llms.MessageContent) ([]llms.MessageContent, string){
+// history is returned unchanged if agent failed, ctx is passed to tools (see RunContext)
+func RunThread(ctx context.Context, prompt string, model openai.LLM, history ...llms.MessageContent) ([]llms.MessageContent, string, error){
 	
 	//model := createGenericLLM()
-	call := OneShotRun(prompt, model, history...)
+	call, err := RunContext(ctx, prompt, model, history...)
+	if err != nil {
+		return history, "", err
+	}
 	log.Println(call)
 	lastResponse := CreateMessageContentAi(call)
 	if len(history) > 0 { 
 		user_msg := CreateMessageContentHuman(prompt)
 		state := append(history,user_msg[0])
 		state = append(state, lastResponse...)
-		return state,call
+		return state,call,nil
 	} else {
 		user_msg := CreateMessageContentHuman(prompt)
 		state := user_msg
 		state = append(state, lastResponse...)
-		return state,call
+		return state,call,nil
 	}
 }
 
@@ -55,12 +58,12 @@ func CreateMessageContentHuman (content string) []llms.MessageContent{
 }
 
 
-func CreateGenericLLM() openai.LLM{
-	model_name := "tiger-gemma-9b-v1-i1"    // should be settable?
-	_ = godotenv.Load()
-			ai_url := os.Getenv("AI_ENDPOINT")          //TODO: should be global?
-			api_token := os.Getenv("ADNIN_KEY")
-			//db_link := os.Getenv("EMBEDDINGS_DB_URL")
+// GenericModel is the model of CreateGenericLLM
+const GenericModel = "tiger-gemma-9b-v1-i1" // should be settable?
+
+// ai_url is AI endpoint, api_token is admin key (config.AdminKey)
+func CreateGenericLLM(ai_url, api_token string) openai.LLM{
+	model_name := GenericModel
 	model, err := openai.New(
 	  openai.WithToken(api_token),
 	  //openai.WithBaseURL("http://localhost:8080"),
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/JackBekket/langgraphgo/graph"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Tool is a function the agent can call. Tools from DefaultTools are offered to the model by OneShotRun
+// and executed by the "tools" node of the graph, so new tool doesn't need changes of the graph.
+type Tool interface {
+	// Name is the function name model calls, it must be unique in the registry
+	Name() string
+	Description() string
+	// Parameters is JSON schema of the arguments object
+	Parameters() map[string]any
+	// Call runs the tool with arguments as JSON, the result is given to the model as tool response
+	Call(ctx context.Context, arguments string) (string, error)
+}
+
+// Registry is an ordered set of tools
+type Registry struct {
+	mu    sync.RWMutex
+	tools []Tool
+}
+
+// NewRegistry returns registry with tools, tool with the same name replaces the previous one
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{}
+	for _, t := range tools {
+		r.Register(t)
+	}
+	return r
+}
+
+// DefaultTools are tools of the dialog agent
+var DefaultTools = NewRegistry(semanticSearchTool{}, NewWebSearchTool(DuckDuckGo{}, defaultSearchResults), NewFetchURLTool(Fetcher{}, defaultFetchMaxChars), generateImageTool{})
+
+// Register adds tool or replaces tool with the same name
+func (r *Registry) Register(t Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.tools {
+		if r.tools[i].Name() == t.Name() {
+			r.tools[i] = t
+			return
+		}
+	}
+	r.tools = append(r.tools, t)
+}
+
+// Unregister removes tool by name
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.tools {
+		if r.tools[i].Name() == name {
+			r.tools = append(r.tools[:i], r.tools[i+1:]...)
+			return
+		}
+	}
+}
+
+// Get returns tool by name
+func (r *Registry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range r.tools {
+		if t.Name() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Definitions returns function definitions of the tools for llms.WithTools
+func (r *Registry) Definitions() []llms.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	definitions := make([]llms.Tool, 0, len(r.tools))
+	for _, t := range r.tools {
+		definitions = append(definitions, llms.Tool{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        t.Name(),
+				Description: t.Description(),
+				Parameters:  t.Parameters(),
+			},
+		})
+	}
+	return definitions
+}
+
+// Describe lists tools with descriptions for system prompts, one per line
+func (r *Registry) Describe() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var b strings.Builder
+	for _, t := range r.tools {
+		fmt.Fprintf(&b, "- %s: %s\n", t.Name(), t.Description())
+	}
+	return b.String()
+}
+
+// Call runs the tool call and returns tool response message.
+// Errors (unknown tool, bad arguments, failed tool) are given to the model as response text, so it can answer anyway.
+func (r *Registry) Call(ctx context.Context, toolCall llms.ToolCall) llms.MessageContent {
+	var result string
+	t, ok := r.Get(toolCall.FunctionCall.Name)
+	if !ok {
+		result = fmt.Sprintf("error: there is no tool %q", toolCall.FunctionCall.Name)
+	} else {
+		log.Printf("agent calls %s with %s", toolCall.FunctionCall.Name, toolCall.FunctionCall.Arguments)
+		var err error
+		result, err = t.Call(ctx, toolCall.FunctionCall.Arguments)
+		if err != nil {
+			log.Printf("tool %s error: %v", toolCall.FunctionCall.Name, err)
+			result = "error: " + err.Error()
+		}
+	}
+	return llms.MessageContent{
+		Role: llms.ChatMessageTypeTool,
+		Parts: []llms.ContentPart{
+			llms.ToolCallResponse{
+				ToolCallID: toolCall.ID,
+				Name:       toolCall.FunctionCall.Name,
+				Content:    result,
+			},
+		},
+	}
+}
+
+// textCall is a tool call written as JSON in text: {"name": ..., "arguments": {...}},
+// "parameters" instead of "arguments" and {"function": {...}} wrapper are used by some models as well
+type textCall struct {
+	Name       string          `json:"name"`
+	Arguments  json.RawMessage `json:"arguments"`
+	Parameters json.RawMessage `json:"parameters"`
+	Function   *textCall       `json:"function"`
+}
+
+// leftovers of tool calls formatting removed from the text
+var toolCallMarkup = regexp.MustCompile("(?s)</?tool_call>|```(json)?\\s*```")
+
+// ParseToolCalls finds tool calls written as JSON in the text, it's a fallback for LocalAI models
+// which don't return structured tool calls. Objects, arrays of them, <tool_call> tags and ```json fences are recognized,
+// only calls of registered tools are taken. Calls get ids made of idPrefix, text is returned without the calls.
+func (r *Registry) ParseToolCalls(text, idPrefix string) ([]llms.ToolCall, string) {
+	calls := []llms.ToolCall{}
+	var rest strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] == '{' || text[i] == '[' {
+			dec := json.NewDecoder(strings.NewReader(text[i:]))
+			var raw json.RawMessage
+			if dec.Decode(&raw) == nil {
+				if found := r.textCalls(raw); len(found) > 0 {
+					calls = append(calls, found...)
+					i += int(dec.InputOffset())
+					continue
+				}
+			}
+		}
+		rest.WriteByte(text[i])
+		i++
+	}
+	if len(calls) == 0 {
+		return calls, text
+	}
+	for i := range calls {
+		calls[i].ID = fmt.Sprintf("%s_%d", idPrefix, i)
+	}
+	log.Printf("parsed %d tool calls from text", len(calls))
+	return calls, strings.TrimSpace(toolCallMarkup.ReplaceAllString(rest.String(), ""))
+}
+
+// textCalls returns calls of JSON object or array, nil if it has anything but calls of registered tools
+func (r *Registry) textCalls(raw json.RawMessage) []llms.ToolCall {
+	var parsed []textCall
+	if raw[0] == '[' {
+		if json.Unmarshal(raw, &parsed) != nil {
+			return nil
+		}
+	} else {
+		var one textCall
+		if json.Unmarshal(raw, &one) != nil {
+			return nil
+		}
+		parsed = append(parsed, one)
+	}
+
+	calls := []llms.ToolCall{}
+	for _, c := range parsed {
+		if c.Function != nil {
+			c = *c.Function
+		}
+		if _, ok := r.Get(c.Name); !ok {
+			return nil
+		}
+		args := c.Arguments
+		if len(args) == 0 {
+			args = c.Parameters
+		}
+		arguments := string(args)
+		// arguments can be JSON encoded into a string, like in openai api
+		if err := json.Unmarshal(args, &arguments); err != nil {
+			arguments = string(args)
+		}
+		if strings.TrimSpace(arguments) == "" || arguments == "null" {
+			arguments = "{}"
+		}
+		calls = append(calls, llms.ToolCall{
+			Type:         "function",
+			FunctionCall: &llms.FunctionCall{Name: c.Name, Arguments: arguments},
+		})
+	}
+	return calls
+}
+
+// toolCalls returns tool calls of the message
+func toolCalls(msg llms.MessageContent) []llms.ToolCall {
+	calls := []llms.ToolCall{}
+	for _, part := range msg.Parts {
+		if toolCall, ok := part.(llms.ToolCall); ok && toolCall.FunctionCall != nil {
+			calls = append(calls, toolCall)
+		}
+	}
+	return calls
+}
+
+// Node returns graph node which executes tool calls of the last message, each response is a separate message
+func (r *Registry) Node() func(ctx context.Context, state []llms.MessageContent) ([]llms.MessageContent, error) {
+	return func(ctx context.Context, state []llms.MessageContent) ([]llms.MessageContent, error) {
+		for _, toolCall := range toolCalls(state[len(state)-1]) {
+			state = append(state, r.Call(ctx, toolCall))
+		}
+		return state, nil
+	}
+}
+
+// shouldCallTools is the condition after agent node: "tools" if the model called any tool, END otherwise
+func shouldCallTools(ctx context.Context, state []llms.MessageContent) string {
+	if len(toolCalls(state[len(state)-1])) > 0 {
+		return "tools"
+	}
+	return graph.END
+}
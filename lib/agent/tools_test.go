@@ -0,0 +1,81 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// echoTool returns its arguments or err
+type echoTool struct {
+	name string
+	err  error
+}
+
+func (t echoTool) Name() string               { return t.name }
+func (t echoTool) Description() string        { return "echoes arguments" }
+func (t echoTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+
+func (t echoTool) Call(ctx context.Context, arguments string) (string, error) {
+	return "echo " + arguments, t.err
+}
+
+func call(id, name, arguments string) llms.ToolCall {
+	return llms.ToolCall{ID: id, Type: "function", FunctionCall: &llms.FunctionCall{Name: name, Arguments: arguments}}
+}
+
+func TestRegistryDefinitions(t *testing.T) {
+	r := agent.NewRegistry(echoTool{name: "echo"}, echoTool{name: "fail"})
+	r.Register(echoTool{name: "echo", err: errors.New("replaced")})
+
+	definitions := r.Definitions()
+	if len(definitions) != 2 || definitions[0].Function.Name != "echo" || definitions[1].Function.Name != "fail" {
+		t.Fatalf("tools must keep registration order, got %+v", definitions)
+	}
+	if tool, _ := r.Get("echo"); tool.(echoTool).err == nil {
+		t.Error("tool with the same name must replace the previous one")
+	}
+	if !strings.Contains(r.Describe(), "- fail: echoes arguments\n") {
+		t.Errorf("unexpected description %q", r.Describe())
+	}
+
+	names := []string{}
+	for _, d := range agent.DefaultTools.Definitions() {
+		names = append(names, d.Function.Name)
+	}
+	// agent tests register more tools
+	if len(names) < 2 || strings.Join(names[:2], " ") != "semanticSearch search" {
+		t.Errorf("unexpected default tools %v", names)
+	}
+}
+
+func TestRegistryNode(t *testing.T) {
+	r := agent.NewRegistry(echoTool{name: "echo"}, echoTool{name: "fail", err: errors.New("boom")})
+	msg := llms.TextParts(llms.ChatMessageTypeAI, "")
+	msg.Parts = append(msg.Parts, call("1", "echo", `{"a":1}`), call("2", "fail", `{}`), call("3", "missing", `{}`))
+	state := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "hi"), msg}
+
+	state, err := r.Node()(context.Background(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ id, content string }{
+		{"1", `echo {"a":1}`},
+		{"2", "error: boom"},
+		{"3", `error: there is no tool "missing"`},
+	}
+	if len(state) != 2+len(want) {
+		t.Fatalf("every call must get its own response message, got %d messages", len(state))
+	}
+	for i, w := range want {
+		msg := state[2+i]
+		response, ok := msg.Parts[0].(llms.ToolCallResponse)
+		if msg.Role != llms.ChatMessageTypeTool || !ok || response.ToolCallID != w.id || response.Content != w.content {
+			t.Errorf("response %d = %+v, want %+v", i, msg, w)
+		}
+	}
+}
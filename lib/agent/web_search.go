@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// SearchResult is a web page found by SearchProvider
+type SearchResult struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// SearchProvider is a web search backend of the search tool
+type SearchProvider interface {
+	Search(ctx context.Context, query string, maxResults int) ([]SearchResult, error)
+}
+
+// web search backends, see config.Search
+const (
+	SearchDuckDuckGo = "duckduckgo"
+	SearchSearxNG    = "searxng"
+	SearchOff        = "off"
+)
+
+// how many results search tool gives to the model if config doesn't set it
+const defaultSearchResults = 3
+
+// timeout of a single search request
+const searchTimeout = 15 * time.Second
+
+// DuckDuckGo searches with html version of Duck Duck Go, it needs no key
+type DuckDuckGo struct {
+	// URL is the search page, https://html.duckduckgo.com/html/ if empty
+	URL       string
+	UserAgent string
+}
+
+func (d DuckDuckGo) Search(ctx context.Context, query string, maxResults int) ([]SearchResult, error) {
+	base := d.URL
+	if base == "" {
+		base = "https://html.duckduckgo.com/html/"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"?q="+url.QueryEscape(query), nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := d.UserAgent
+	if userAgent == "" {
+		userAgent = "Mozilla/5.0 (compatible; hellper bot)"
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := (&http.Client{Timeout: searchTimeout}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("duckduckgo: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("duckduckgo: status %s", resp.Status)
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("duckduckgo: %w", err)
+	}
+
+	results := []SearchResult{}
+	doc.Find(".web-result").EachWithBreak(func(i int, node *goquery.Selection) bool {
+		link := node.Find(".result__a").First()
+		href, _ := link.Attr("href")
+		// links go through duckduckgo redirect with real url in uddg parameter
+		if u, err := url.Parse(href); err == nil && u.Query().Get("uddg") != "" {
+			href = u.Query().Get("uddg")
+		}
+		if href != "" {
+			results = append(results, SearchResult{
+				Title:   strings.TrimSpace(link.Text()),
+				URL:     href,
+				Snippet: strings.TrimSpace(node.Find(".result__snippet").Text()),
+			})
+		}
+		return len(results) < maxResults
+	})
+	return results, nil
+}
+
+// SearxNG searches with a SearxNG instance, json format must be enabled in its settings
+type SearxNG struct {
+	URL string
+}
+
+func (s SearxNG) Search(ctx context.Context, query string, maxResults int) ([]SearchResult, error) {
+	searchURL, err := url.JoinPath(s.URL, "search")
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{"q": {query}, "format": {"json"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: searchTimeout}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("searxng: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("searxng: status %s", resp.Status)
+	}
+	var body struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("searxng: %w", err)
+	}
+	results := []SearchResult{}
+	for _, r := range body.Results {
+		if len(results) == maxResults {
+			break
+		}
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return results, nil
+}
+
+// FakeSearch returns results by query, it's used in tests instead of real search
+type FakeSearch struct {
+	Results map[string][]SearchResult
+	// Queries are queries in order of calls
+	Queries []string
+}
+
+func (f *FakeSearch) Search(ctx context.Context, query string, maxResults int) ([]SearchResult, error) {
+	f.Queries = append(f.Queries, query)
+	results := f.Results[query]
+	if len(results) > maxResults {
+		results = results[:maxResults]
+	}
+	return results, nil
+}
+
+// FormatSearchResults formats results for the model: numbered titles with urls and snippets
+func FormatSearchResults(results []SearchResult) string {
+	if len(results) == 0 {
+		return "nothing found"
+	}
+	var b strings.Builder
+	for i, r := range results {
+		fmt.Fprintf(&b, "%d. %s\nURL: %s\n%s\n\n", i+1, r.Title, r.URL, r.Snippet)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// webSearchTool searches the web with SearchProvider, found pages become sources of the answer
+type webSearchTool struct {
+	provider   SearchProvider
+	maxResults int
+}
+
+// NewWebSearchTool returns "search" tool backed by provider
+func NewWebSearchTool(provider SearchProvider, maxResults int) Tool {
+	if maxResults < 1 {
+		maxResults = 1
+	}
+	return webSearchTool{provider: provider, maxResults: maxResults}
+}
+
+func (webSearchTool) Name() string { return "search" }
+
+func (webSearchTool) Description() string {
+	return "Searches the web, returns titles, urls and snippets of found pages. Use it for recent events and facts you are not sure about"
+}
+
+func (webSearchTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{
+				"type":        "string",
+				"description": "The search query",
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t webSearchTool) Call(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("bad arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return "", fmt.Errorf("query is empty")
+	}
+	results, err := t.provider.Search(ctx, args.Query, t.maxResults)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range results {
+		AddSource(ctx, Source{Title: r.Title, URL: r.URL})
+	}
+	return FormatSearchResults(results), nil
+}
@@ -0,0 +1,92 @@
+package agent_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/agent"
+)
+
+func TestDuckDuckGo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") != "golang generics" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `<html><body>
+<div class="result web-result"><a class="result__a" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fgo.dev%2Fdoc%2Ftutorial%2Fgenerics&rut=x">Tutorial: Getting started with generics</a>
+<a class="result__snippet">This tutorial introduces the basics of generics in Go.</a></div>
+<div class="result web-result"><a class="result__a" href="https://example.com/direct">Direct link</a><a class="result__snippet">second</a></div>
+<div class="result web-result"><a class="result__a" href="https://example.com/third">Third</a></div>
+</body></html>`)
+	}))
+	defer server.Close()
+
+	results, err := agent.DuckDuckGo{URL: server.URL}.Search(context.Background(), "golang generics", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []agent.SearchResult{
+		{Title: "Tutorial: Getting started with generics", URL: "https://go.dev/doc/tutorial/generics", Snippet: "This tutorial introduces the basics of generics in Go."},
+		{Title: "Direct link", URL: "https://example.com/direct", Snippet: "second"},
+	}
+	if fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Errorf("got %+v, want %+v", results, want)
+	}
+}
+
+func TestSearxNG(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" || r.URL.Query().Get("format") != "json" || r.URL.Query().Get("q") != "hellper" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprint(w, `{"results":[{"title":"Hellper","url":"https://github.com/JackBekket/Hellper","content":"telegram bot"},{"title":"Other","url":"https://example.com","content":""}]}`)
+	}))
+	defer server.Close()
+
+	results, err := agent.SearxNG{URL: server.URL}.Search(context.Background(), "hellper", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0] != (agent.SearchResult{Title: "Hellper", URL: "https://github.com/JackBekket/Hellper", Snippet: "telegram bot"}) {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if got := agent.FormatSearchResults(results); got != "1. Hellper\nURL: https://github.com/JackBekket/Hellper\ntelegram bot" {
+		t.Errorf("unexpected format %q", got)
+	}
+}
+
+func TestAgentAppendsSearchSources(t *testing.T) {
+	configureAgent(t, 5)
+	search := &agent.FakeSearch{Results: map[string][]agent.SearchResult{
+		"world cup winner": {
+			{Title: "2022 FIFA World Cup [final]", URL: "https://example.com/final", Snippet: "Argentina won"},
+			{Title: "Messi", URL: "https://example.com/messi", Snippet: "captain"},
+		},
+	}}
+	agent.DefaultTools.Register(agent.NewWebSearchTool(search, 3))
+	defer agent.DefaultTools.Register(agent.NewWebSearchTool(agent.DuckDuckGo{}, 3))
+
+	model, script := newScriptedModel(t,
+		callsReply([2]string{"search", `{"query":"world cup winner"}`}),
+		textReply("Argentina won, see https://example.com/messi"),
+	)
+	answer, err := agent.Run("who won the last world cup?", model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(search.Queries, ",") != "world cup winner" {
+		t.Errorf("unexpected queries %v", search.Queries)
+	}
+	if !strings.Contains(script.requests[1], "URL: https://example.com/final") {
+		t.Errorf("model must see urls of results: %s", script.requests[1])
+	}
+	// source mentioned in the answer is not repeated, markdown is removed from titles
+	want := "Argentina won, see https://example.com/messi\n\nSources:\n1. [2022 FIFA World Cup final](https://example.com/final)"
+	if answer != want {
+		t.Errorf("answer %q, want %q", answer, want)
+	}
+}
@@ -0,0 +1,212 @@
+package command
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	db "github.com/JackBekket/hellper/lib/database"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// allowedByPolicy reports whether new chat can start onboarding without approval.
+// Chat approved before (by admin or invite) is allowed, its user row could be deleted by /restart or /reset.
+func (c *Commander) allowedByPolicy(chatID int64) bool {
+	if c.cfg.Access.Mode != config.AccessOpen {
+		approved, err := c.invites.Approved(chatID)
+		if err != nil {
+			log.Println("could not check approval:", err)
+		}
+		if approved {
+			return true
+		}
+	}
+	switch c.cfg.Access.Mode {
+	case config.AccessAllowlist:
+		return slices.Contains(c.cfg.Access.Allowlist, chatID)
+	case config.AccessInvite:
+		return false
+	default:
+		return true
+	}
+}
+
+// inviteCode returns code of t.me/<bot>?start=<code> link, telegram sends it as "/start <code>"
+func inviteCode(msg *tgbotapi.Message) string {
+	if msg.Command() != "start" {
+		return ""
+	}
+	return strings.TrimSpace(msg.CommandArguments())
+}
+
+// redeemInvite counts use of the code, user is told if the code is not valid
+func (c *Commander) redeemInvite(chatID int64, code string) bool {
+	invite, err := c.invites.UseInvite(code)
+	switch {
+	case errors.Is(err, db.ErrInviteNotFound):
+		c.send(chatID, msgTemplates["invite_invalid"])
+		return false
+	case errors.Is(err, db.ErrInviteUsedUp):
+		c.send(chatID, msgTemplates["invite_used"])
+		return false
+	case err != nil:
+		log.Println("could not use invite:", err)
+		c.send(chatID, msgTemplates["invite_invalid"])
+		return false
+	}
+	log.Printf("user %d joined by invite %s of admin %d (%d uses)\n", chatID, invite.Code, invite.CreatedBy, invite.Uses)
+	c.approve(chatID)
+	return true
+}
+
+// approve remembers that the chat is let in, so it's not asked for approval again after its user is deleted
+func (c *Commander) approve(chatID int64) {
+	if err := c.invites.Approve(chatID); err != nil {
+		log.Println("could not save approval:", err)
+	}
+}
+
+// askApproval tells pending user what to do. In allowlist mode admins get approve/reject buttons,
+// in invite mode the only way in is an invite.
+func (c *Commander) askApproval(user db.User) {
+	if c.cfg.Access.Mode != config.AccessAllowlist {
+		c.send(user.ID, msgTemplates["invite_only"])
+		return
+	}
+	c.send(user.ID, msgTemplates["pending_approval"])
+
+	approve, err := CallbackData(CallbackAccess, "approve:"+strconv.FormatInt(user.ID, 10))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	reject, _ := CallbackData(CallbackAccess, "reject:"+strconv.FormatInt(user.ID, 10))
+	for _, admin := range c.cfg.Admins.List {
+		if !c.admins.Can(admin.ID, PermApprove) {
+			continue
+		}
+		_, err := c.bot.SendText(messenger.Text{
+			ChatID: admin.ID,
+			Text:   fmt.Sprintf(msgTemplates["access_request"], user.Username, user.ID),
+			Keyboard: messenger.InlineKeyboard(messenger.Row(
+				messenger.Button{Text: "Approve", Data: approve},
+				messenger.Button{Text: "Reject", Data: reject},
+			)),
+		})
+		if err != nil {
+			log.Printf("could not send access request to admin %d: %v\n", admin.ID, err)
+		}
+	}
+}
+
+// PendingResponse answers messages of pending user
+func (c *Commander) PendingResponse(updateMessage *tgbotapi.Message) {
+	if c.cfg.Access.Mode == config.AccessAllowlist {
+		c.send(updateMessage.Chat.ID, msgTemplates["pending_approval"])
+		return
+	}
+	c.send(updateMessage.Chat.ID, msgTemplates["invite_only"])
+}
+
+// Start handles /start of known user. Pending user can send invite code this way,
+// others get the list of commands.
+//
+// StatusPending -> StatusNew
+func (c *Commander) Start(updateMessage *tgbotapi.Message, user db.User) {
+	if user.DialogStatus != db.StatusPending {
+		c.HelpCommandMessage(updateMessage)
+		return
+	}
+	code := inviteCode(updateMessage)
+	if code == "" {
+		c.PendingResponse(updateMessage)
+		return
+	}
+	if c.redeemInvite(user.ID, code) && c.ChangeDialogStatus(user.ID, db.StatusNew) == nil {
+		c.greet(user.ID)
+	}
+}
+
+// HandleAccessDecision handles CallbackAccess buttons sent to admins, payload is "approve:<chat id>" or "reject:<chat id>".
+// Rejected user is banned, so it can't ask again.
+//
+// StatusPending -> StatusNew
+func (c *Commander) HandleAccessDecision(query *tgbotapi.CallbackQuery, payload string) string {
+	if !c.admins.Can(query.From.ID, PermApprove) {
+		return msgTemplates["admin_only"]
+	}
+	decision, idText, _ := strings.Cut(payload, ":")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil || (decision != "approve" && decision != "reject") {
+		return msgTemplates["outdated_button"]
+	}
+	user, ok := c.store.Get(id)
+	if !ok || user.DialogStatus != db.StatusPending || user.Banned {
+		return msgTemplates["access_decided"]
+	}
+
+	result := "approved"
+	if decision == "approve" {
+		if err := c.ChangeDialogStatus(id, db.StatusNew); err != nil {
+			return err.Error()
+		}
+		c.approve(id)
+		c.greet(id)
+	} else {
+		result = "rejected"
+		c.UpdateUser(id, func(user *db.User) {
+			user.Banned = true
+		})
+		c.send(id, msgTemplates["access_denied"])
+	}
+	log.Printf("admin %d %s access of user %d\n", query.From.ID, result, id)
+
+	if query.Message != nil {
+		text := fmt.Sprintf(msgTemplates["access_request"], user.Username, user.ID) + "\n" + result + " by @" + query.From.UserName
+		if err := c.bot.EditText(query.Message.Chat.ID, query.Message.MessageID, text, messenger.ModePlain); err != nil {
+			log.Println("could not edit access request:", err)
+		}
+	}
+	return result
+}
+
+// CreateInvite creates invite code and sends t.me link with it to the admin.
+// args is number of uses, 1 by default, 0 for unlimited.
+func (c *Commander) CreateInvite(adminID int64, args string) {
+	uses := 1
+	if args = strings.TrimSpace(args); args != "" {
+		var err error
+		uses, err = strconv.Atoi(args)
+		if err != nil || uses < 0 {
+			c.send(adminID, "usage: /invite [uses], 1 by default, 0 for unlimited")
+			return
+		}
+	}
+	b := make([]byte, 6)
+	rand.Read(b)
+	invite := db.Invite{
+		Code:      hex.EncodeToString(b),
+		MaxUses:   uses,
+		CreatedBy: adminID,
+		CreatedAt: time.Now(),
+	}
+	if err := c.invites.SaveInvite(invite); err != nil {
+		c.send(adminID, "could not save invite: "+err.Error())
+		return
+	}
+	limit := "single-use"
+	if uses == 0 {
+		limit = "unlimited"
+	} else if uses > 1 {
+		limit = fmt.Sprintf("%d uses", uses)
+	}
+	c.send(adminID, fmt.Sprintf("invite (%s): https://t.me/%s?start=%s", limit, c.bot.BotUsername(), invite.Code))
+}
@@ -0,0 +1,172 @@
+package command_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func newAccessCommander(mode string) (*command.Commander, *messenger.Fake, *database.MemoryStore) {
+	fake := messenger.NewFake("hellper_bot")
+	store := database.NewMemoryStore()
+	cfg := config.Default()
+	cfg.Access = config.Access{Mode: mode, Allowlist: []int64{2}}
+	cfg.Admins.List = []config.Admin{{ID: 10, Role: config.RoleModerator}}
+	comm := command.NewCommander(fake, store, context.Background(), cfg)
+	comm.Callbacks().Handle(command.CallbackAccess, comm.HandleAccessDecision)
+	return comm, fake, store
+}
+
+func status(store database.UserStore, id int64) database.DialogStatus {
+	user, _ := store.Get(id)
+	return user.DialogStatus
+}
+
+// press clicks inline button of the message as the chat
+func press(comm *command.Commander, fake *messenger.Fake, msg messenger.FakeMessage, chatID int64, button string) string {
+	for _, row := range msg.Keyboard.Rows {
+		for _, b := range row {
+			if b.Text == button {
+				query := &tgbotapi.CallbackQuery{
+					ID:      button + msg.Text,
+					From:    &tgbotapi.User{ID: chatID, UserName: "moderator"},
+					Message: &tgbotapi.Message{MessageID: msg.ID, Chat: &tgbotapi.Chat{ID: msg.ChatID}},
+					Data:    b.Data,
+				}
+				comm.Callbacks().Route(fake, query)
+				answer, _ := fake.Answer(query.ID)
+				return answer
+			}
+		}
+	}
+	return ""
+}
+
+func TestAllowlistApproval(t *testing.T) {
+	comm, fake, store := newAccessCommander(config.AccessAllowlist)
+
+	comm.AddNewUserToMap(commandMessage(2, "/start"))
+	if status(store, 2) != database.StatusNew {
+		t.Fatal("user from allowlist must start onboarding")
+	}
+
+	comm.AddNewUserToMap(commandMessage(5, "/start"))
+	comm.AddNewUserToMap(commandMessage(6, "/start"))
+	if status(store, 5) != database.StatusPending || status(store, 6) != database.StatusPending {
+		t.Fatal("users not in allowlist must wait for approval")
+	}
+	requests := fake.Messages(10)
+	if len(requests) != 2 || !strings.Contains(requests[0].Text, "(5) asks for access") {
+		t.Fatalf("unexpected requests to admin: %+v", requests)
+	}
+
+	if answer := press(comm, fake, requests[0], 5, "Approve"); answer != "This command is available for admins only" {
+		t.Fatalf("user approved itself: %q", answer)
+	}
+	if answer := press(comm, fake, requests[0], 10, "Approve"); answer != "approved" {
+		t.Fatalf("unexpected answer %q", answer)
+	}
+	if answer := press(comm, fake, requests[1], 10, "Reject"); answer != "rejected" {
+		t.Fatalf("unexpected answer %q", answer)
+	}
+	if answer := press(comm, fake, requests[0], 10, "Reject"); answer != "Request is already handled" {
+		t.Fatalf("decision was changed: %q", answer)
+	}
+
+	if status(store, 5) != database.StatusNew {
+		t.Fatal("approved user must start onboarding")
+	}
+	if greeting := fake.Messages(5); greeting[len(greeting)-1].Text != "Hey, this bot is working with local ai node." {
+		t.Fatalf("approved user is not greeted: %+v", greeting)
+	}
+	if rejected, _ := store.Get(6); !rejected.Banned {
+		t.Fatal("rejected user must be banned")
+	}
+	if edited := fake.Messages(10)[0]; !strings.HasSuffix(edited.Text, "approved by @moderator") {
+		t.Fatalf("request is not marked: %q", edited.Text)
+	}
+
+	// /restart and /reset delete the user, approval must stay
+	store.Delete(5)
+	comm.AddNewUserToMap(commandMessage(5, "/start"))
+	if status(store, 5) != database.StatusNew || len(fake.Messages(10)) != 2 {
+		t.Fatal("approved user must not wait for approval again")
+	}
+
+	// chat banned before it came must not skip approval after unban
+	comm.SetBanned(10, "7", true)
+	comm.SetBanned(10, "7", false)
+	if status(store, 7) != database.StatusPending {
+		t.Fatalf("unbanned unknown chat must wait for approval, status %s", status(store, 7))
+	}
+	if requests := fake.Messages(10); !strings.Contains(requests[len(requests)-1].Text, "(7) asks for access") {
+		t.Fatalf("admins must get request of unbanned chat: %+v", requests)
+	}
+	// chat from allowlist doesn't need approval
+	store.Delete(2)
+	comm.SetBanned(10, "2", true)
+	if status(store, 2) != database.StatusNew {
+		t.Fatalf("chat from allowlist must not be pending, status %s", status(store, 2))
+	}
+}
+
+func TestInviteCodes(t *testing.T) {
+	comm, fake, store := newAccessCommander(config.AccessInvite)
+
+	comm.CreateInvite(10, "")
+	comm.CreateInvite(10, "0")
+	var codes []string
+	for _, msg := range fake.Messages(10) {
+		_, code, ok := strings.Cut(msg.Text, "https://t.me/hellper_bot?start=")
+		if !ok {
+			t.Fatalf("no invite link in %q", msg.Text)
+		}
+		codes = append(codes, code)
+	}
+	single, unlimited := codes[0], codes[1]
+
+	comm.AddNewUserToMap(commandMessage(1, "/start"))
+	comm.AddNewUserToMap(commandMessage(2, "/start"))
+	comm.AddNewUserToMap(commandMessage(6, "/start "+single))
+	comm.AddNewUserToMap(commandMessage(3, "/start "+single))
+	comm.AddNewUserToMap(commandMessage(4, "/start "+unlimited))
+	comm.AddNewUserToMap(commandMessage(5, "/start "+unlimited))
+
+	want := map[int64]database.DialogStatus{
+		1: database.StatusPending,
+		// allowlist is not used in invite mode
+		2: database.StatusPending,
+		6: database.StatusNew,
+		3: database.StatusPending,
+		4: database.StatusNew,
+		5: database.StatusNew,
+	}
+	for id, s := range want {
+		if got := status(store, id); got != s {
+			t.Errorf("user %d: status %s, want %s", id, got, s)
+		}
+	}
+	if msgs := fake.Messages(3); msgs[0].Text != "This invite is already used" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+
+	// pending user opens a valid link later
+	user, _ := store.Get(1)
+	comm.Start(commandMessage(1, "/start "+unlimited), user)
+	if status(store, 1) != database.StatusNew {
+		t.Fatal("pending user is not let in by invite")
+	}
+
+	// single-use invite is spent, user deleted by /restart must still get in
+	store.Delete(6)
+	comm.AddNewUserToMap(commandMessage(6, "/start"))
+	if status(store, 6) != database.StatusNew {
+		t.Fatal("user joined by invite must not be locked out after reset")
+	}
+}
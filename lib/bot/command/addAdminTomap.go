@@ -4,37 +4,34 @@ import (
 	"log"
 
 	db "github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// AddAdminToMap creates admin with preset key and shows models menu right away
+//
+// StatusAuthorized -> StatusAwaitingModel
 func (c *Commander) AddAdminToMap(
 	adminKey string,
 	updateMessage *tgbotapi.Message,
 
 ) {
 	chatID := updateMessage.Chat.ID
-	db.UsersMap[chatID] = db.User{
+	admin := db.User{
 		ID:           chatID,
 		Username:     updateMessage.From.UserName,
-		DialogStatus: 2,
+		DialogStatus: db.StatusAuthorized,
 		Admin:        true,
 		AiSession: db.AiSession{
 			GptKey: adminKey,
+			OwnKey: adminKey,
 		},
 	}
-
-	admin := db.UsersMap[chatID]
+	c.SaveUser(admin)
 	log.Printf("%s authorized\n", admin.Username)
 
-	msg := tgbotapi.NewMessage(admin.ID, "authorized: "+admin.Username)
-	c.bot.Send(msg)
+	c.send(admin.ID, "authorized: "+admin.Username)
 
-	msg = tgbotapi.NewMessage(admin.ID, msgTemplates["case1"])
-	msg.ReplyMarkup = tgbotapi.NewOneTimeReplyKeyboard(
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("GPT-3.5")),
-		//tgbotapi.NewKeyboardButton("GPT-4"),
-		//tgbotapi.NewKeyboardButton("Codex")),
-	)
-	c.bot.Send(msg)
+	c.RenderModelMenuLAI(chatID, langchain.GetModelsList(adminKey, c.cfg.AI.Endpoint))
+	c.ChangeDialogStatus(chatID, db.StatusAwaitingModel)
 }
@@ -3,35 +3,46 @@ package command
 import (
 	"log"
 
+	"github.com/JackBekket/hellper/lib/bot/messenger"
 	"github.com/JackBekket/hellper/lib/database"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// Adds a new user to the database and assigns "Dialog_status" = 0.
+// Adds a new user to the database and assigns database.StatusNew.
+//
+// If access mode is not open and user is neither in allowlist nor came with valid invite (/start <code>),
+// user gets database.StatusPending and waits for admin approval.
 func (c *Commander) AddNewUserToMap(updateMessage *tgbotapi.Message) {
 	chatID := updateMessage.Chat.ID
 	user := database.User{
 		ID:           chatID,
 		Username:     updateMessage.From.UserName,
-		DialogStatus: 0,
+		DialogStatus: database.StatusNew,
 		Admin:        false,
 	}
 
-	database.AddUser(user)
+	pending := !c.allowedByPolicy(chatID)
+	if code := inviteCode(updateMessage); pending && code != "" {
+		pending = !c.redeemInvite(chatID, code)
+	}
+	if pending {
+		user.DialogStatus = database.StatusPending
+	}
+
+	c.SaveUser(user)
 
-	//user := c.usersDb[chatID]
 	log.Printf(
-		"Add new user to database: id: %v, username: %s\n",
+		"Add new user to database: id: %v, username: %s, status: %s\n",
 		user.ID,
 		user.Username,
+		user.DialogStatus,
 	)
 
-	msg := tgbotapi.NewMessage(user.ID, msgTemplates["hello"])
-	msg.ReplyMarkup = tgbotapi.NewOneTimeReplyKeyboard(
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Start!")),
-	)
-	c.bot.Send(msg)
+	if pending {
+		c.askApproval(user)
+		return
+	}
+	c.greet(user.ID)
 
 	// check for registration
 	//	registred := IsAlreadyRegistred(session, chatID)
@@ -41,3 +52,12 @@ func (c *Commander) AddNewUserToMap(updateMessage *tgbotapi.Message) {
 		}
 	*/
 }
+
+// greet sends the first message of onboarding
+func (c *Commander) greet(chatID int64) {
+	c.bot.SendText(messenger.Text{
+		ChatID:   chatID,
+		Text:     msgTemplates["hello"],
+		Keyboard: messenger.ReplyKeyboard(messenger.Row(messenger.Button{Text: "Start!"})),
+	})
+}
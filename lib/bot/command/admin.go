@@ -0,0 +1,228 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	db "github.com/JackBekket/hellper/lib/database"
+)
+
+// telegram allows about 30 messages per second to different chats, broadcast stays below it
+const broadcastInterval = 50 * time.Millisecond
+
+// telegram limit of message length
+const maxMessageLength = 4096
+
+// ListUsers sends list of users with their model and dialog status to the admin
+func (c *Commander) ListUsers(adminID int64) {
+	users, err := c.store.List()
+	if err != nil {
+		c.send(adminID, "could not list users: "+err.Error())
+		return
+	}
+	active := 0
+	lines := []string{}
+	for _, user := range users {
+		if user.DialogStatus == db.StatusDialog && !user.Banned {
+			active++
+		}
+		line := fmt.Sprintf("%d @%s -- %s", user.ID, user.Username, user.DialogStatus)
+		if user.AiSession.GptModel != "" {
+			line += ", " + user.AiSession.GptModel
+		}
+		if user.Admin {
+			line += " [admin]"
+		}
+		if user.Banned {
+			line += " [banned]"
+		}
+		lines = append(lines, line)
+	}
+	c.sendLong(adminID, fmt.Sprintf(msgTemplates["users_header"], len(users), active), lines)
+}
+
+// sendLong sends header and lines split into messages fitting telegram limit
+func (c *Commander) sendLong(chatID int64, header string, lines []string) {
+	text := header
+	for _, line := range lines {
+		if len(text)+len(line)+1 > maxMessageLength {
+			c.send(chatID, text)
+			text = ""
+		}
+		if text != "" {
+			text += "\n"
+		}
+		text += line
+	}
+	if text != "" {
+		c.send(chatID, text)
+	}
+}
+
+// parseChatID reads chat id from command arguments
+func parseChatID(args string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("chat id must be a number, e.g. /ban 123456789")
+	}
+	return id, nil
+}
+
+// SetBanned bans or unbans chat from command arguments. Unknown chat is banned too, so it can't start onboarding,
+// it's stored as pending unless access policy lets it in. Admins from config can't be banned.
+func (c *Commander) SetBanned(adminID int64, args string, banned bool) {
+	id, err := parseChatID(args)
+	if err != nil {
+		c.send(adminID, err.Error())
+		return
+	}
+	if _, ok := c.admins.Get(id); ok && banned {
+		c.send(adminID, "admins can't be banned, remove them from config first")
+		return
+	}
+	user, err := c.store.Update(id, func(user *db.User) {
+		user.Banned = banned
+	})
+	if err == db.ErrUserNotFound && banned {
+		// after unban the chat must pass access policy like any new user
+		user = db.User{ID: id, DialogStatus: db.StatusNew, Banned: true}
+		if !c.allowedByPolicy(id) {
+			user.DialogStatus = db.StatusPending
+		}
+		err = c.store.Save(user)
+	}
+	if err == db.ErrUserNotFound {
+		c.send(adminID, fmt.Sprintf("user %d not found", id))
+		return
+	}
+	if err != nil {
+		c.send(adminID, "could not update user: "+err.Error())
+		return
+	}
+	log.Printf("admin %d set banned=%v for user %d\n", adminID, banned, id)
+	if banned {
+		c.send(adminID, fmt.Sprintf("user %d is banned", id))
+		return
+	}
+	c.send(adminID, fmt.Sprintf("user %d is unbanned", id))
+	if user.DialogStatus == db.StatusPending {
+		// pending chat still needs approval or invite
+		c.askApproval(user)
+	}
+}
+
+// ResetUser deletes session of the user from command arguments, next message starts onboarding again
+func (c *Commander) ResetUser(adminID int64, args string) {
+	id, err := parseChatID(args)
+	if err != nil {
+		c.send(adminID, err.Error())
+		return
+	}
+	user, ok := c.store.Get(id)
+	if !ok {
+		c.send(adminID, fmt.Sprintf("user %d not found", id))
+		return
+	}
+	if user.Banned {
+		// deleting banned user would unban it
+		c.send(adminID, fmt.Sprintf("user %d is banned, /unban first", id))
+		return
+	}
+	c.DeleteUser(id)
+	log.Printf("admin %d reset session of user %d\n", adminID, id)
+	c.send(id, msgTemplates["session_reset"])
+	c.send(adminID, fmt.Sprintf("session of user %d is reset", id))
+}
+
+// Broadcast sends text to every user except banned ones.
+// It blocks until all messages are sent, one message per broadcastInterval, so run it in a goroutine.
+func (c *Commander) Broadcast(adminID int64, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		c.send(adminID, "usage: /broadcast <message>")
+		return
+	}
+	users, err := c.store.List()
+	if err != nil {
+		c.send(adminID, "could not list users: "+err.Error())
+		return
+	}
+	c.send(adminID, fmt.Sprintf("sending to %d users...", len(users)))
+
+	ticker := time.NewTicker(broadcastInterval)
+	defer ticker.Stop()
+	sent, failed := 0, 0
+	for _, user := range users {
+		if user.Banned {
+			continue
+		}
+		<-ticker.C
+		if _, err := c.bot.SendText(messenger.Text{ChatID: user.ID, Text: text}); err != nil {
+			log.Printf("broadcast to %d failed: %v\n", user.ID, err)
+			failed++
+			continue
+		}
+		sent++
+	}
+	log.Printf("admin %d broadcast a message: %d sent, %d failed\n", adminID, sent, failed)
+	c.send(adminID, fmt.Sprintf("broadcast is done: %d sent, %d failed", sent, failed))
+}
+
+// Stats sends usage of all users for the period from arguments (all time by default) from the usage ledger,
+// it's not affected by sessions deleted with /restart or /reset
+func (c *Commander) Stats(adminID int64, args string) {
+	period, since, err := parsePeriod(args, "all")
+	if err != nil {
+		c.send(adminID, err.Error())
+		return
+	}
+	users, err := c.store.List()
+	if err != nil {
+		c.send(adminID, "could not list users: "+err.Error())
+		return
+	}
+	records, err := c.usage.ListUsage(0, since)
+	if err != nil {
+		c.send(adminID, "could not read usage: "+err.Error())
+		return
+	}
+	statuses := map[db.DialogStatus]int{}
+	for _, user := range users {
+		statuses[user.DialogStatus]++
+	}
+	var total db.UsageRecord
+	chats := map[int64]bool{}
+	byModel := map[string]int{}
+	for _, record := range records {
+		chats[record.ChatID] = true
+		total.Requests += record.Requests
+		total.PromptTokens += record.PromptTokens
+		total.CompletionTokens += record.CompletionTokens
+		total.TotalTokens += record.TotalTokens
+		if record.Model != "" {
+			byModel[record.Model] += record.TotalTokens
+		}
+	}
+
+	lines := []string{
+		fmt.Sprintf("users: %d, in dialog: %d, active: %d", len(users), statuses[db.StatusDialog], len(chats)),
+		fmt.Sprintf("requests: %d", total.Requests),
+		fmt.Sprintf("promt tokens: %d", total.PromptTokens),
+		fmt.Sprintf("completion tokens: %d", total.CompletionTokens),
+		fmt.Sprintf("total tokens: %d", total.TotalTokens),
+	}
+	models := make([]string, 0, len(byModel))
+	for model := range byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		lines = append(lines, fmt.Sprintf("%s: %d tokens", model, byModel[model]))
+	}
+	c.sendLong(adminID, fmt.Sprintf(msgTemplates["stats_header"], usagePeriods[period]), lines)
+}
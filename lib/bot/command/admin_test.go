@@ -0,0 +1,79 @@
+package command_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+)
+
+func TestAdminCommands(t *testing.T) {
+	fake := messenger.NewFake("hellper_bot")
+	store := database.NewMemoryStore()
+	cfg := config.Default()
+	cfg.Admins.List = []config.Admin{{ID: 10, Role: config.RoleAdmin}}
+	comm := command.NewCommander(fake, store, context.Background(), cfg)
+
+	store.Save(database.User{ID: 10, Username: "admin", Admin: true, DialogStatus: database.StatusDialog})
+	store.Save(database.User{ID: 1, Username: "alice", DialogStatus: database.StatusDialog, AiSession: database.AiSession{
+		GptModel: "tiger-gemma",
+		Usage:    map[string]int{"Promt": 10, "Completion": 5, "Total": 15},
+	}})
+	store.AddUsage(database.UsageRecord{ChatID: 1, Day: database.Day(time.Now()), Model: "tiger-gemma", Feature: database.FeatureChat, Requests: 2, PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	store.Save(database.User{ID: 2, Username: "bob", DialogStatus: database.StatusAwaitingKey})
+
+	comm.SetBanned(10, "2", true)
+	comm.SetBanned(10, "10", true)
+	comm.SetBanned(10, "3", true)
+	if bob, _ := store.Get(2); !bob.Banned {
+		t.Fatal("bob is not banned")
+	}
+	if admin, _ := store.Get(10); admin.Banned {
+		t.Fatal("admin is banned")
+	}
+	if unknown, ok := store.Get(3); !ok || !unknown.Banned {
+		t.Fatal("unknown chat must be stored as banned")
+	}
+	comm.SetBanned(10, "3", false)
+
+	comm.ListUsers(10)
+	comm.Broadcast(10, "maintenance at 23:00")
+	comm.ResetUser(10, "1")
+	if _, ok := store.Get(1); ok {
+		t.Fatal("session of alice is not reset")
+	}
+	// usage stays in the ledger after reset
+	comm.Stats(10, "")
+
+	if got := fake.Messages(2); len(got) != 0 {
+		t.Fatalf("banned user got messages: %+v", got)
+	}
+	alice := fake.Messages(1)
+	if len(alice) != 2 || alice[0].Text != "maintenance at 23:00" || !strings.Contains(alice[1].Text, "reset by admin") {
+		t.Fatalf("unexpected messages of alice: %+v", alice)
+	}
+
+	admin := []string{}
+	for _, msg := range fake.Messages(10) {
+		admin = append(admin, msg.Text)
+	}
+	report := strings.Join(admin, "\n")
+	for _, want := range []string{
+		"admins can't be banned",
+		"1 @alice -- dialog, tiger-gemma",
+		"2 @bob -- awaiting_key [banned]",
+		"broadcast is done: 3 sent, 0 failed",
+		"requests: 2",
+		"total tokens: 15",
+		"tiger-gemma: 15 tokens",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("admin report doesn't contain %q:\n%s", want, report)
+		}
+	}
+}
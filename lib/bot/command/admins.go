@@ -0,0 +1,78 @@
+package command
+
+import (
+	"github.com/JackBekket/hellper/lib/config"
+)
+
+// Permission is an action available only to some admin roles
+type Permission string
+
+const (
+	// list users with their model and dialog status
+	PermUsers Permission = "users"
+	// ban and unban users
+	PermBan Permission = "ban"
+	// reset session of another user
+	PermReset Permission = "reset"
+	// send a message to all users
+	PermBroadcast Permission = "broadcast"
+	// see usage of all users
+	PermStats Permission = "stats"
+	// approve new users and create invites
+	PermApprove Permission = "approve"
+	// add and switch provider profiles of other users, profiles can contain keys
+	PermProviders Permission = "providers"
+)
+
+var rolePermissions = map[string][]Permission{
+	config.RoleAdmin:     {PermUsers, PermBan, PermReset, PermBroadcast, PermStats, PermApprove, PermProviders},
+	config.RoleModerator: {PermUsers, PermBan, PermReset, PermStats, PermApprove},
+}
+
+// Admins is a list of admins loaded from config at startup.
+// It is the only source of admin rights: database.User.Admin is set on creation, but revoking admin in config
+// takes effect without touching the database.
+type Admins struct {
+	cfg  *config.Config
+	byID map[int64]config.Admin
+}
+
+func NewAdmins(cfg *config.Config) *Admins {
+	a := &Admins{cfg: cfg, byID: make(map[int64]config.Admin)}
+	for _, admin := range cfg.Admins.List {
+		a.byID[admin.ID] = admin
+	}
+	return a
+}
+
+// Get returns admin by chat id, ok is false if chat is not an admin
+func (a *Admins) Get(id int64) (config.Admin, bool) {
+	admin, ok := a.byID[id]
+	return admin, ok
+}
+
+// Key returns api key preset for the admin, empty if there is no key in config
+func (a *Admins) Key(id int64) string {
+	admin, ok := a.byID[id]
+	if !ok {
+		return ""
+	}
+	return a.cfg.KeyOf(admin)
+}
+
+// Can reports whether the chat is an admin with the permission, empty permission means any admin
+func (a *Admins) Can(id int64, perm Permission) bool {
+	admin, ok := a.byID[id]
+	if !ok {
+		return false
+	}
+	if perm == "" {
+		return true
+	}
+	for _, p := range rolePermissions[admin.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
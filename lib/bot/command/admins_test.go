@@ -0,0 +1,67 @@
+package command_test
+
+import (
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func testAdmins() *command.Admins {
+	cfg := config.Default()
+	cfg.AI.APIKey = "bot-key"
+	cfg.Admins.List = []config.Admin{
+		{ID: 10, Role: config.RoleAdmin, Key: "own-key"},
+		{ID: 20, Role: config.RoleModerator},
+	}
+	return command.NewAdmins(cfg)
+}
+
+func TestAdminsPermissions(t *testing.T) {
+	admins := testAdmins()
+	if !admins.Can(10, command.PermBroadcast) || !admins.Can(20, command.PermBan) {
+		t.Fatal("role permissions are not applied")
+	}
+	if admins.Can(20, command.PermBroadcast) {
+		t.Fatal("moderator can broadcast")
+	}
+	if admins.Can(30, "") {
+		t.Fatal("chat which is not in config is admin")
+	}
+	if admins.Key(10) != "own-key" || admins.Key(20) != "bot-key" || admins.Key(30) != "" {
+		t.Fatalf("unexpected keys: %q %q %q", admins.Key(10), admins.Key(20), admins.Key(30))
+	}
+}
+
+func TestRegistryChecksPermissions(t *testing.T) {
+	r := command.NewRegistry()
+	r.SetAdmins(testAdmins())
+	ran := map[int64]bool{}
+	r.MustRegister(command.Command{
+		Name:        "broadcast",
+		Description: "send message to all users",
+		Permission:  command.PermBroadcast,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			ran[user.ID] = true
+		},
+	})
+
+	fake := messenger.NewFake("hellper_bot")
+	for _, user := range []database.User{
+		{ID: 10},
+		{ID: 20, Admin: true},
+		// admin flag is left from a previous config, admins list wins
+		{ID: 30, Admin: true},
+	} {
+		r.Dispatch(fake, commandMessage(user.ID, "/broadcast hi"), user)
+	}
+	if !ran[10] || ran[20] || ran[30] {
+		t.Fatalf("unexpected runs: %v", ran)
+	}
+	if got := fake.Messages(20); len(got) != 1 {
+		t.Fatalf("denied admin must get explanation, got %v", got)
+	}
+}
@@ -0,0 +1,44 @@
+package command
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	db "github.com/JackBekket/hellper/lib/database"
+)
+
+// prefix makes hellper keys distinguishable from openai/localai keys
+const apiKeyPrefix = "hlp-"
+
+func newAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// IssueAPIKey generates a new http api key for the user, previous key stops working.
+// Requests with the key use user's ai session (key and model), so the session has to be set up first.
+func (c *Commander) IssueAPIKey(chatID int64) {
+	key, err := newAPIKey()
+	if err != nil {
+		log.Println("could not generate api key:", err)
+		c.send(chatID, "could not generate api key, try again later")
+		return
+	}
+	if _, err := c.store.Update(chatID, func(user *db.User) {
+		user.APIKey = key
+	}); err != nil {
+		log.Println("could not save api key:", err)
+		c.send(chatID, "could not save api key, try again later")
+		return
+	}
+	c.bot.SendText(messenger.Text{
+		ChatID:    chatID,
+		Text:      "Your API key (previous key is revoked):\n`" + key + "`\n\n" + msgTemplates["api_usage"],
+		ParseMode: messenger.ModeMarkdown,
+	})
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegram rejects inline buttons with callback data longer than 64 bytes
+const callbackDataLimit = 64
+
+// callback prefixes of inline keyboards rendered by commander
+const (
+	CallbackModel    = "model"
+	CallbackLanguage = "lang"
+	// approve/reject buttons of access requests sent to admins
+	CallbackAccess = "access"
+	// provider menu of onboarding and /provider, payload is provider name
+	CallbackProvider = "provider"
+)
+
+// CallbackHandler processes inline button press, payload is callback data without prefix.
+// Returned text is shown to the user as callback answer, empty text just stops loading animation.
+type CallbackHandler func(query *tgbotapi.CallbackQuery, payload string) string
+
+// CallbackRouter routes callback queries by prefix of their data, e.g. "model:gpt-4" goes to handler of "model".
+type CallbackRouter struct {
+	handlers map[string]CallbackHandler
+}
+
+func NewCallbackRouter() *CallbackRouter {
+	return &CallbackRouter{
+		handlers: make(map[string]CallbackHandler),
+	}
+}
+
+// Handle registers handler for the prefix, prefix must not contain ':'.
+func (r *CallbackRouter) Handle(prefix string, handler CallbackHandler) {
+	if prefix == "" || strings.Contains(prefix, ":") {
+		panic(fmt.Sprintf("invalid callback prefix %q", prefix))
+	}
+	if _, ok := r.handlers[prefix]; ok {
+		panic(fmt.Sprintf("callback prefix %q is already registered", prefix))
+	}
+	r.handlers[prefix] = handler
+}
+
+// CallbackData builds callback data for inline button, returns error if it doesn't fit telegram limit.
+func CallbackData(prefix, payload string) (string, error) {
+	data := prefix + ":" + payload
+	if len(data) > callbackDataLimit {
+		return "", fmt.Errorf("callback data %q is %d bytes long, telegram allows %d", data, len(data), callbackDataLimit)
+	}
+	return data, nil
+}
+
+// Route calls handler registered for the query prefix and acknowledges the query.
+// Buttons with unknown prefix (e.g. sent by older version of the bot) are acknowledged with a notice.
+func (r *CallbackRouter) Route(bot messenger.Messenger, query *tgbotapi.CallbackQuery) {
+	prefix, payload, _ := strings.Cut(query.Data, ":")
+	answer := msgTemplates["outdated_button"]
+	if handler, ok := r.handlers[prefix]; ok {
+		answer = handler(query, payload)
+	} else {
+		log.Printf("no callback handler for %q", query.Data)
+	}
+	if err := bot.AnswerCallback(query.ID, answer); err != nil {
+		log.Println("could not answer callback query:", err)
+	}
+}
@@ -0,0 +1,22 @@
+package command_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+)
+
+func TestCallbackDataLimit(t *testing.T) {
+	data, err := command.CallbackData(command.CallbackModel, "llama-3-8b")
+	if err != nil || data != "model:llama-3-8b" {
+		t.Fatalf("unexpected callback data %q, err %v", data, err)
+	}
+	// "model:" + 58 bytes is exactly 64 bytes
+	if _, err := command.CallbackData(command.CallbackModel, strings.Repeat("a", 58)); err != nil {
+		t.Fatalf("64 bytes should fit: %v", err)
+	}
+	if _, err := command.CallbackData(command.CallbackModel, strings.Repeat("a", 59)); err == nil {
+		t.Fatal("65 bytes should not fit")
+	}
+}
@@ -2,17 +2,18 @@ package command
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
+	"github.com/JackBekket/hellper/lib/agent"
 	db "github.com/JackBekket/hellper/lib/database"
 	"github.com/JackBekket/hellper/lib/langchain"
 	"github.com/JackBekket/hellper/lib/localai"
 	stt "github.com/JackBekket/hellper/lib/localai/audioRecognition"
 	imgrec "github.com/JackBekket/hellper/lib/localai/imageRecognition"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/joho/godotenv"
 )
 
 type contextKey string
@@ -21,58 +22,65 @@ const UserKey contextKey = "user"
 
 // Message:	case0 - "Input your openAI API key. It can be created at https://platform.openai.com/accousernamet/api-keys".
 //
-//	DialogStatus 2 -> 3
+//	StatusNew, StatusStarted, StatusAuthorized -> StatusAwaitingKey
 func (c *Commander) InputYourAPIKey(updateMessage *tgbotapi.Message) {
 	updateMessage.Text = strings.ReplaceAll(updateMessage.Text, " ", "")
 	chatID := updateMessage.Chat.ID
-	user := db.UsersMap[chatID]
 
-	msg := tgbotapi.NewMessage(
-		user.ID,
-		msgTemplates["case0"],
-	)
-	c.bot.Send(msg)
+	user, _ := c.store.Get(chatID)
+	if len(c.cfg.AI.Providers) > 0 || len(user.Providers) > 0 {
+		c.RenderProviderMenu(chatID, msgTemplates["provider_menu"])
+	} else {
+		c.send(chatID, msgTemplates["case0"])
+	}
 
-	user.DialogStatus = 3
-	db.UsersMap[chatID] = user
+	c.ChangeDialogStatus(chatID, db.StatusAwaitingKey)
 }
 
-// update Dialog_Status 3 -> 4
-func (c *Commander) ChooseModel(updateMessage *tgbotapi.Message, ai_endpoint string) {
+// StatusAwaitingKey -> StatusAwaitingModel
+//
+// Models are listed from endpoint of the provider chosen by user, the default one if user didn't choose.
+func (c *Commander) ChooseModel(updateMessage *tgbotapi.Message) {
 	updateMessage.Text = strings.TrimSpace(updateMessage.Text)
 	chatID := updateMessage.Chat.ID
 	gptKey := updateMessage.Text // handling previouse message
-	user := db.UsersMap[chatID]
 
 	// I can't validate key at this stage. The only way to validate key is to send test sequence (see case 3)
 	// Since this part is oftenly get an usernamecaught exeption, we debug what user input as key. It's bad, I know, but usernametil we got key validation we need this part.
 	log.Println("Key promt: ", gptKey)
-	user.AiSession.GptKey = gptKey // store key in memory
 
-	c.RenderModelMenuLAI(chatID, langchain.GetModelsList(gptKey, ai_endpoint))
-	user.DialogStatus = 4
-	db.UsersMap[chatID] = user
+	user, err := c.store.Update(chatID, func(user *db.User) {
+		user.AiSession.GptKey = gptKey // store key in memory
+		user.AiSession.OwnKey = gptKey
+	})
+	if err != nil {
+		log.Println("error updating user:", err)
+		return
+	}
+
+	c.RenderModelMenuLAI(chatID, langchain.GetModelsList(gptKey, c.Endpoint(user)))
+	c.ChangeDialogStatus(chatID, db.StatusAwaitingModel)
 }
 
-// DialogStatus 4 -> 5
-func (c *Commander) HandleModelChoose(updateMessage *tgbotapi.CallbackQuery) {
+// StatusAwaitingModel -> StatusAwaitingLanguage
+//
+// Handles CallbackModel buttons, model_name is callback payload.
+func (c *Commander) HandleModelChoose(updateMessage *tgbotapi.CallbackQuery, model_name string) string {
 	chatID := updateMessage.Message.Chat.ID
 	messageID := updateMessage.Message.MessageID
-	model_name := updateMessage.Data
-	user := db.UsersMap[chatID]
+
+	user, ok := c.store.Get(chatID)
+	if !ok || user.DialogStatus != db.StatusAwaitingModel {
+		return msgTemplates["outdated_button"]
+	}
 
 	c.attachModel(model_name, chatID)
 	c.RenderLanguage(chatID)
 
-	user.AiSession.GptModel = model_name
-	user.DialogStatus = 5
-	db.UsersMap[chatID] = user
-
-	callbackResponse := tgbotapi.NewCallback(updateMessage.ID, "🐈💨")
-	c.bot.Send(callbackResponse)
+	c.ChangeDialogStatus(chatID, db.StatusAwaitingLanguage)
 
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, messageID)
-	c.bot.Send(deleteMsg)
+	c.bot.Delete(chatID, messageID)
+	return "🐈💨"
 }
 
 // low level attach model name to user profile
@@ -81,112 +89,131 @@ func (c *Commander) attachModel(model_name string, chatID int64) {
 	// TODO: Write down user choice
 	log.Printf("Model selected: %s\n", model_name)
 
-	user := db.UsersMap[chatID]
-
 	modelName := model_name
-	user.AiSession.GptModel = modelName
-	msg := tgbotapi.NewMessage(user.ID, "your session model: "+modelName)
-	c.bot.Send(msg)
-	db.UsersMap[chatID] = user
+	c.UpdateUser(chatID, func(user *db.User) {
+		user.AiSession.GptModel = modelName
+	})
+	c.send(chatID, "your session model: "+modelName)
 }
 
 // internal for attach api key to a user
 func (c *Commander) AttachKey(gpt_key string, chatID int64) {
 	log.Println("Key promt: ", gpt_key)
-	user := db.UsersMap[chatID]
-	user.AiSession.GptKey = gpt_key // store key in memory
-	db.UsersMap[chatID] = user
+	c.UpdateUser(chatID, func(user *db.User) {
+		user.AiSession.GptKey = gpt_key // store key in memory
+		user.AiSession.OwnKey = gpt_key
+	})
 }
 
-// Dangerouse! NOTE -- probably work only internal
-func (c *Commander) ChangeDialogStatus(chatID int64, ds int8) {
-	user := db.UsersMap[chatID]
-	old_status := user.DialogStatus
-	log.Println("dialog status changed, old status is ", old_status)
-	log.Println("new status is ", ds)
-	user.DialogStatus = ds
+// ChangeDialogStatus moves user to the next dialog status and saves it.
+// Returns *db.InvalidTransitionError if the transition is not declared in db transitions table.
+func (c *Commander) ChangeDialogStatus(chatID int64, next db.DialogStatus) error {
+	var transitionErr error
+	var old_status db.DialogStatus
+	_, err := c.store.Update(chatID, func(user *db.User) {
+		old_status = user.DialogStatus
+		transitionErr = user.SetDialogStatus(next)
+	})
+	if err != nil {
+		log.Println("error changing dialog status:", err)
+		return err
+	}
+	if transitionErr != nil {
+		log.Println(transitionErr)
+		return transitionErr
+	}
+	log.Printf("dialog status of %d changed: %s -> %s\n", chatID, old_status, next)
+	return nil
 }
 
 func (c *Commander) WrongResponse(updateMessage *tgbotapi.Message) {
 	chatID := updateMessage.Chat.ID
-	user := db.UsersMap[chatID]
+	user, _ := c.store.Get(chatID)
 
-	msg := tgbotapi.NewMessage(user.ID, "Please use provided keyboard")
-	c.bot.Send(msg)
+	c.send(user.ID, "Please use provided keyboard")
 
 }
 
-// update update Dialog_Status 5 -> 6
-func (c *Commander) ConnectingToAiWithLanguage(updateMessage *tgbotapi.CallbackQuery, ai_endpoint string) {
-	_ = godotenv.Load()
+// StatusAwaitingLanguage -> StatusDialog (set by langchain.SetupSequenceWithKey when session is ready),
+// StatusAwaitingLanguage -> StatusAwaitingLanguage (endpoints are down, language menu is sent again)
+//
+// Handles CallbackLanguage buttons, language is callback payload.
+func (c *Commander) ConnectingToAiWithLanguage(updateMessage *tgbotapi.CallbackQuery, language string) string {
 	messageID := updateMessage.Message.MessageID
 	chatID := updateMessage.Message.Chat.ID
-	language := updateMessage.Data
-	user := db.UsersMap[chatID]
+	user, ok := c.store.Get(chatID)
+	if !ok || user.DialogStatus != db.StatusAwaitingLanguage {
+		return msgTemplates["outdated_button"]
+	}
 	log.Println("check gpt key exist:", user.AiSession.GptKey)
 
 	//network := user.Network
 
-	msg := tgbotapi.NewMessage(user.ID, "connecting to ai node")
-	c.bot.Send(msg)
+	c.send(user.ID, "connecting to ai node")
 
 	ctx := context.WithValue(c.ctx, "user", user)
+	ai_endpoint := c.Endpoint(user)
 	log.Println("local-ai endpoint is: ", ai_endpoint)
-	go langchain.SetupSequenceWithKey(c.bot, user, language, ctx, ai_endpoint) //local-ai
-
-	callbackResponse := tgbotapi.NewCallback(updateMessage.ID, "🐈💨")
-	c.bot.Send(callbackResponse)
-
-	deleteMsg := tgbotapi.NewDeleteMessage(chatID, messageID)
-	c.bot.Send(deleteMsg)
+	c.enqueueGeneration(chatID, func() {
+		err := langchain.SetupSequenceWithKey(c.bot, c.store, user, language, ctx, ai_endpoint) //local-ai
+		if errors.Is(err, langchain.ErrEndpointsDown) {
+			// user is still in StatusAwaitingLanguage, its keyboard is deleted below
+			c.RenderLanguage(chatID)
+		}
+	})
 
+	c.bot.Delete(chatID, messageID)
+	return "🐈💨"
 }
 
 // Generates an image with the /image command.
 //
 // Generates and sends text to the user. This is *main loop*
 //
-// update Dialog_Status 6 -> 6 (loop),
-func (c *Commander) DialogSequence(updateMessage *tgbotapi.Message, ai_endpoint string) {
+// StatusDialog -> StatusDialog (loop),
+func (c *Commander) DialogSequence(updateMessage *tgbotapi.Message) {
 	chatID := updateMessage.Chat.ID
-	user := db.UsersMap[chatID]
+	user, _ := c.store.Get(chatID)
+	ai_endpoint := c.Endpoint(user)
+	ai := c.AI(user)
 
 	if updateMessage != nil {
 
 		if updateMessage.Text != "" && updateMessage.Photo == nil {
 			promt := updateMessage.Text
+			if err := c.limiter.AllowRequest(chatID); err != nil {
+				c.send(chatID, err.Error())
+				return
+			}
 			ctx := context.WithValue(c.ctx, "user", user)
-			go langchain.StartDialogSequence(c.bot, chatID, promt, ctx, ai_endpoint)
+			// the agent can draw images for the chat with generate_image tool
+			ctx = agent.WithImageSender(ctx, c.ImageSender(chatID))
+			ctx = agent.WithEmbeddings(ctx, c.Embeddings(user))
+			c.enqueueGeneration(chatID, func() {
+				langchain.StartDialogSequence(c.bot, c.store, chatID, promt, ctx, ai_endpoint)
+				c.addTurnUsage(chatID, user.AiSession.GptModel)
+			})
 		} else if updateMessage.Voice != nil {
-			voicePath, err := stt.HandleVoiceMessage(updateMessage, *c.bot)
+			voicePath, err := stt.HandleVoiceMessage(updateMessage, c.bot)
 			if err != nil {
 				log.Println(err)
 			}
-			url, model := stt.GetEnvsForSST()
-			transcription, err := localai.TranscribeWhisper(url, model, voicePath)
+			service := ai.VoiceRecognition
+			transcription, err := localai.TranscribeWhisper(ai.URL(service), service.Model, ai.APIKey, voicePath, langchain.HTTPClient(ai.Endpoint))
 			if err != nil {
 				log.Println(err)
+			} else {
+				c.recordRequest(chatID, service.Model, db.FeatureTranscription)
 			}
-			msg := tgbotapi.NewMessage(chatID, transcription)
-			c.bot.Send(msg)
+			c.send(chatID, transcription)
 			DeleteFile(voicePath)
 		} else if updateMessage.Photo != nil {
-			response, err := imgrec.RecognizeImage(c.bot, updateMessage)
+			service := ai.ImageRecognition
+			response, err := imgrec.RecognizeImage(c.bot, updateMessage, ai.URL(service), service.Model, ai.APIKey, langchain.HTTPClient(ai.Endpoint))
 			if err != nil {
 				log.Println(err)
 			}
-			msg := tgbotapi.NewMessage(chatID, response)
-			c.bot.Send(msg)
+			c.send(chatID, response)
 		}
 	}
 }
-
-func (c *Commander) GetUsersDb() map[int64]db.User {
-	data_base := db.UsersMap
-	return data_base
-}
-
-func (c *Commander) GetUser(id int64) db.User {
-	user := db.UsersMap[id]
-	return user
-}
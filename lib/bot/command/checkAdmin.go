@@ -1,33 +1,20 @@
 package command
 
 import (
-	"fmt"
-
-	"github.com/JackBekket/hellper/lib/bot/env"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-// Updates "dialogStatus" in the database. Admins - 2, other users - 0.
-//
-// Loads the key from env into the database.
-func (c *Commander) CheckAdmin(adminData map[string]env.AdminData, updateMessage *tgbotapi.Message) {
+// CheckAdmin creates a new user. Admins from config skip key entry (StatusAuthorized -> StatusAwaitingModel),
+// other users start onboarding with StatusNew.
+func (c *Commander) CheckAdmin(updateMessage *tgbotapi.Message) {
 	chatID := updateMessage.Chat.ID
-	for evn, admin := range adminData {
-		if admin.ID == chatID {
-			if admin.GPTKey != "" {
-				c.AddAdminToMap(admin.GPTKey, updateMessage)
-				return
-			} else {
-				msg := tgbotapi.NewMessage(
-					chatID,
-					fmt.Sprintf("env \"%s\" is missing.", evn),
-				)
-				c.bot.Send(msg)
-				// Directs to case 0
-				c.AddNewUserToMap(updateMessage)
-				return
-			}
+	if _, ok := c.admins.Get(chatID); ok {
+		if key := c.admins.Key(chatID); key != "" {
+			c.AddAdminToMap(key, updateMessage)
+			return
 		}
+		c.send(chatID, "admin key is missing in config (admins.key, ADMIN_KEY or OPENAI_API_KEY), enter it as a usual user.")
 	}
+	// Directs to case 0
 	c.AddNewUserToMap(updateMessage)
 }
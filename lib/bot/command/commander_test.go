@@ -0,0 +1,78 @@
+package command_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func commandMessage(chatID int64, text string) *tgbotapi.Message {
+	name := strings.Fields(text)[0]
+	return &tgbotapi.Message{
+		Chat:     &tgbotapi.Chat{ID: chatID},
+		From:     &tgbotapi.User{ID: chatID, UserName: "tester"},
+		Text:     text,
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(name)}},
+	}
+}
+
+func TestCommanderWithFakeMessenger(t *testing.T) {
+	fake := messenger.NewFake("hellper_bot")
+	store := database.NewMemoryStore()
+	comm := command.NewCommander(fake, store, context.Background(), config.Default())
+
+	comm.Commands().MustRegister(command.Command{
+		Name:        "help",
+		Description: "print this message",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.HelpCommandMessage(msg)
+		},
+	})
+	comm.Commands().MustRegister(command.Command{
+		Name:        "usage",
+		Description: "show tokens",
+		States:      []database.DialogStatus{database.StatusDialog},
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			t.Fatal("/usage should not run before setup")
+		},
+	})
+
+	comm.AddNewUserToMap(commandMessage(1, "/start"))
+	user, ok := comm.GetUser(1)
+	if !ok || user.DialogStatus != database.StatusNew {
+		t.Fatalf("user is not created: %+v", user)
+	}
+	if !comm.Commands().Dispatch(fake, commandMessage(1, "/help"), user) {
+		t.Fatal("/help is not dispatched")
+	}
+	comm.Commands().Dispatch(fake, commandMessage(1, "/usage"), user)
+	if comm.Commands().Dispatch(fake, commandMessage(1, "/unknown"), user) {
+		t.Fatal("unknown command is dispatched")
+	}
+
+	messages := fake.Messages(1)
+	if len(messages) != 3 {
+		t.Fatalf("expected greeting, help and setup notice, got %+v", messages)
+	}
+	if messages[0].Keyboard == nil || messages[0].Keyboard.Inline {
+		t.Fatalf("greeting should have reply keyboard: %+v", messages[0])
+	}
+	if !strings.Contains(messages[1].Text, "/usage -- show tokens (after setup)") {
+		t.Fatalf("unexpected help: %q", messages[1].Text)
+	}
+	if !strings.HasPrefix(messages[2].Text, "Finish setup first") {
+		t.Fatalf("unexpected reply to /usage: %q", messages[2].Text)
+	}
+
+	// buttons of removed features are still answered, so telegram client stops spinner
+	comm.Callbacks().Route(fake, &tgbotapi.CallbackQuery{ID: "q1", Data: "settings:old"})
+	if answer, ok := fake.Answer("q1"); !ok || answer == "" {
+		t.Fatalf("callback is not answered: %q", answer)
+	}
+}
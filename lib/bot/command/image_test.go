@@ -0,0 +1,77 @@
+package command_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
+)
+
+func TestImageSender(t *testing.T) {
+	// images are downloaded into ./tmp before they are sent
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	var request struct{ Model, Prompt, Size string }
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/images/generations":
+			json.NewDecoder(r.Body).Decode(&request)
+			fmt.Fprintf(w, `{"data":[{"url":%q}]}`, server.URL+"/generated/cat.png")
+		case "/generated/cat.png":
+			fmt.Fprint(w, "png bytes")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fake := messenger.NewFake("hellper_bot")
+	store := database.NewMemoryStore()
+	cfg := config.Default()
+	cfg.AI.Endpoint, cfg.AI.APIKey = server.URL, "key"
+	cfg.Quotas.Default.ImagesPerDay = 1
+	comm := command.NewCommander(fake, store, context.Background(), cfg)
+	langchain.TrustEndpoints(cfg.AI)
+	defer langchain.TrustEndpoints(config.AI{})
+	store.Save(database.User{ID: 1, DialogStatus: database.StatusDialog})
+
+	send := comm.ImageSender(1)
+	if err := send(context.Background(), "a red cat", "512x512"); err != nil {
+		t.Fatal(err)
+	}
+	if request.Model != "stablediffusion" || request.Prompt != "a red cat" || request.Size != "512x512" {
+		t.Errorf("unexpected generation request %+v", request)
+	}
+	messages := fake.Messages(1)
+	if len(messages) != 1 || messages[0].Kind != "photo" || string(messages[0].File) != "png bytes" {
+		t.Fatalf("expected the photo, got %+v", messages)
+	}
+	records, _ := store.ListUsage(1, time.Time{})
+	if len(records) != 1 || records[0].Feature != database.FeatureImage {
+		t.Errorf("image must be counted in usage, got %+v", records)
+	}
+
+	var quotaErr *command.QuotaError
+	if err := send(context.Background(), "a blue cat", "256x256"); !errors.As(err, &quotaErr) {
+		t.Errorf("quota of images must be checked, got %v", err)
+	}
+	if len(fake.Messages(1)) != 1 {
+		t.Error("nothing must be sent over quota")
+	}
+}
@@ -0,0 +1,58 @@
+package command_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
+)
+
+func TestLanguageMenuIsBackWhileEndpointsAreDown(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	fake := messenger.NewFake("hellper_bot")
+	store := database.NewMemoryStore()
+	cfg := config.Default()
+	cfg.AI.Endpoint = down.URL
+	cfg.AI.Failover = config.Failover{Retries: 0, Backoff: time.Millisecond, HealthInterval: time.Minute}
+	langchain.SetEndpointPool(langchain.NewEndpointPool(cfg.AI))
+	defer langchain.SetEndpointPool(nil)
+
+	comm := command.NewCommander(fake, store, context.Background(), cfg)
+	comm.Callbacks().Handle(command.CallbackLanguage, comm.ConnectingToAiWithLanguage)
+	store.Save(database.User{ID: 1, DialogStatus: database.StatusAwaitingLanguage, AiSession: database.AiSession{GptKey: "key", GptModel: "llama"}})
+
+	comm.RenderLanguage(1)
+	menus := make(chan messenger.FakeMessage, 1)
+	fake.OnSend = func(msg messenger.FakeMessage) {
+		if msg.Keyboard != nil && strings.HasPrefix(msg.Text, "Choose a language") {
+			menus <- msg
+		}
+	}
+	pressButton(comm, fake, 1, "English")
+
+	select {
+	case <-menus:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("language menu is not sent again, messages %+v", fake.Messages(1))
+	}
+	if status(store, 1) != database.StatusAwaitingLanguage {
+		t.Errorf("user must stay in language choice, status %s", status(store, 1))
+	}
+	messages := fake.Messages(1)
+	if len(messages) < 2 || !strings.Contains(messages[len(messages)-2].Text, "choose a language again") {
+		t.Errorf("user must be told to choose again, messages %+v", messages)
+	}
+	if last := messages[len(messages)-1]; last.Keyboard == nil {
+		t.Errorf("language menu must be the last message, got %+v", last)
+	}
+}
@@ -1,9 +1,35 @@
 package command
 
 var msgTemplates = map[string]string{
-	"hello":      "Hey, this bot is working with local ai node.",
-	"case0":      "Input local-ai api_key",
-	"await":      "Awaiting",
-	"case1":      "Choose model to use. ",
-	"help_command" : "Authorize for additional commands: /help -- print this message, /restart -- restart session (if you want to switch between local-ai and openai chatGPT), /search_doc -- searching documents, /rag -- process Retrival-Augmented Generation, /instruct -- use system promt template instead of langchain (higher priority, see examples), /image -- generate image ....all funcs are experimental so bot can halt and catch fire",
+	"hello":             "Hey, this bot is working with local ai node.",
+	"case0":             "Input local-ai api_key",
+	"await":             "Awaiting",
+	"case1":             "Choose model to use. ",
+	"queue":             "AI node is busy, you are #%d in queue",
+	"help_header":       "Available commands (all funcs are experimental so bot can halt and catch fire):",
+	"help_after_setup":  "(after setup)",
+	"admin_only":        "This command is available for admins only",
+	"api_usage":         "Use it as bearer token with OpenAI compatible clients: POST /v1/chat/completions, GET /v1/models",
+	"outdated_button":   "This button is outdated",
+	"finish_setup":      "Finish setup first: choose model and language, then try again. /help -- list of commands",
+	"session_reset":     "Your session was reset by admin, type any key to start again",
+	"users_header":      "users: %d, in dialog: %d",
+	"stats_header":      "Usage of all users %s, /usage_csv for details:",
+	"pending_approval":  "Access to this bot is limited. Your request is sent to admins, wait for approval.",
+	"invite_only":       "This bot is invite-only. Open invite link from admin to start.",
+	"invite_invalid":    "Invite code is not valid",
+	"invite_used":       "This invite is already used",
+	"access_request":    "@%s (%d) asks for access",
+	"access_decided":    "Request is already handled",
+	"access_denied":     "Your access request is rejected",
+	"provider_menu":     "Input local-ai api_key or choose a provider:",
+	"provider_key":      "Input api key for %s",
+	"provider_switched": "Switched to %s, model %s. History is kept.",
+	"provider_saved":    "Provider %s is saved, switch to it with /provider",
+	"provider_unknown":  "No such provider, see /provider",
+	"provider_header":   "Current provider: %s. Providers:",
+	"usage_header":      "Your usage %s:",
+	"quota_tokens":      "You have used your daily limit of %d tokens. It resets in %s (at %s).",
+	"quota_requests":    "Slow down: you can send %d requests per minute. Try again in %s (at %s).",
+	"quota_images":      "You have used your daily limit of %d images. It resets in %s (at %s).",
 }
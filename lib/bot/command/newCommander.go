@@ -2,27 +2,138 @@ package command
 
 import (
 	"context"
+	"log"
+	"time"
 
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
 	"github.com/JackBekket/hellper/lib/database"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/JackBekket/hellper/lib/langchain"
 )
 
 type Commander struct {
-	bot     *tgbotapi.BotAPI
-	usersDb map[int64]database.User
-	ctx     context.Context
+	bot   messenger.Messenger
+	store database.UserStore
+	// invite codes, kept by the same store
+	invites database.InviteStore
+	// usage ledger, kept by the same store
+	usage database.UsageStore
+	ctx   context.Context
+	cfg   *config.Config
+	// generation queue shared by all users
+	scheduler *langchain.Scheduler
+	// admins from config, the same list checks admin-only commands
+	admins *Admins
+	// quotas of users, checked before generations
+	limiter *Limiter
+	// bot commands, filled by dialog package
+	commands *Registry
+	// inline keyboard handlers, filled by dialog package
+	callbacks *CallbackRouter
 }
 
 func NewCommander(
-	bot *tgbotapi.BotAPI,
-	usersDb map[int64]database.User,
+	bot messenger.Messenger,
+	store database.UserStore,
 	ctx context.Context,
+	cfg *config.Config,
 ) *Commander {
+	// both stores keep invites, others get in-memory ones
+	invites, ok := store.(database.InviteStore)
+	if !ok {
+		invites = database.NewMemoryStore()
+	}
+	usage, ok := store.(database.UsageStore)
+	if !ok {
+		usage = database.NewMemoryStore()
+	}
+	admins := NewAdmins(cfg)
+	commands := NewRegistry()
+	commands.SetAdmins(admins)
 	return &Commander{
-		bot:     bot,
-		usersDb: usersDb,
-		ctx:     ctx,
+		bot:       bot,
+		store:     store,
+		invites:   invites,
+		usage:     usage,
+		ctx:       ctx,
+		cfg:       cfg,
+		scheduler: langchain.NewScheduler(cfg.AI.GenerationWorkers),
+		admins:    admins,
+		limiter:   NewLimiter(cfg, admins, usage, time.Now),
+		commands:  commands,
+		callbacks: NewCallbackRouter(),
+	}
+}
+
+// GetUser returns user from the store, ok is false for unknown user
+func (c *Commander) GetUser(id int64) (database.User, bool) {
+	return c.store.Get(id)
+}
+
+// FindUser returns user from the store, database.ErrUserNotFound for unknown user and other errors if the store can't be read
+func (c *Commander) FindUser(id int64) (database.User, error) {
+	return c.store.Find(id)
+}
+
+// SaveUser writes user back to the store
+func (c *Commander) SaveUser(user database.User) {
+	if err := c.store.Save(user); err != nil {
+		log.Println("error saving user:", err)
+	}
+}
+
+// UpdateUser atomically changes stored user, prefer it over GetUser+SaveUser
+func (c *Commander) UpdateUser(id int64, fn func(user *database.User)) {
+	if _, err := c.store.Update(id, fn); err != nil {
+		log.Println("error updating user:", err)
 	}
 }
 
+// DeleteUser removes user from the store, next message will start onboarding again
+func (c *Commander) DeleteUser(id int64) {
+	if err := c.store.Delete(id); err != nil {
+		log.Println("error deleting user:", err)
+	}
+}
+
+// GetStore returns underlying user store
+func (c *Commander) GetStore() database.UserStore {
+	return c.store
+}
+
+// Config returns settings loaded at startup
+func (c *Commander) Config() *config.Config {
+	return c.cfg
+}
+
+// Scheduler returns generation queue, other frontends (e.g. http api) share it with the bot
+func (c *Commander) Scheduler() *langchain.Scheduler {
+	return c.scheduler
+}
+
+// Admins returns admins loaded from config
+func (c *Commander) Admins() *Admins {
+	return c.admins
+}
+
+// Limiter returns quotas of users
+func (c *Commander) Limiter() *Limiter {
+	return c.limiter
+}
+
+// Commands returns registry of bot commands
+func (c *Commander) Commands() *Registry {
+	return c.commands
+}
+
+// Callbacks returns router of inline keyboard callbacks
+func (c *Commander) Callbacks() *CallbackRouter {
+	return c.callbacks
+}
+
+// send sends plain text to the chat, errors are logged
+func (c *Commander) send(chatID int64, text string) {
+	messenger.Say(c.bot, chatID, text)
+}
+
 //func GetCommander()
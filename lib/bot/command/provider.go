@@ -0,0 +1,287 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	db "github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// AI returns ai settings of the user: the default ones from config or services of the selected provider with its key.
+func (c *Commander) AI(user db.User) config.AI {
+	ai := c.cfg.AI
+	switch {
+	case user.AiSession.Provider == "":
+		return ai
+	case user.Network == db.ProviderOpenAI:
+		return config.OpenAI(user.AiSession.GptKey)
+	default:
+		ai.Endpoint = user.AiSession.Base_url
+		ai.APIKey = user.AiSession.GptKey
+		return ai
+	}
+}
+
+// Embeddings returns endpoint and key of the user for semanticSearch tool of the agent
+func (c *Commander) Embeddings(user db.User) agent.Embeddings {
+	ai := c.AI(user)
+	return agent.Embeddings{Endpoint: ai.Endpoint, APIKey: ai.APIKey, DatabaseURL: c.cfg.Database.URL, Client: langchain.HTTPClient(ai.Endpoint)}
+}
+
+// Endpoint returns chat endpoint of the user, empty for openai
+func (c *Commander) Endpoint(user db.User) string {
+	return user.Endpoint(c.cfg.AI.Endpoint)
+}
+
+// providers returns profiles available to the user: default, shared from config and own ones.
+// Own profile hides shared one with the same name.
+func (c *Commander) providers(user db.User) []db.Provider {
+	list := []db.Provider{{Name: config.DefaultProvider}}
+	for _, p := range c.cfg.AI.Providers {
+		if _, own := user.FindProvider(p.Name); !own {
+			list = append(list, db.Provider(p))
+		}
+	}
+	return append(list, user.Providers...)
+}
+
+// findProvider returns profile available to the user by name, the default one has empty name
+func (c *Commander) findProvider(user db.User, name string) (db.Provider, bool) {
+	if name == config.DefaultProvider {
+		return db.Provider{}, true
+	}
+	for _, p := range c.providers(user) {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return db.Provider{}, false
+}
+
+// providerName returns name of the selected provider for messages
+func providerName(user db.User) string {
+	if user.AiSession.Provider == "" {
+		return config.DefaultProvider
+	}
+	return user.AiSession.Provider
+}
+
+// RenderProviderMenu sends buttons to switch provider, current one is marked
+func (c *Commander) RenderProviderMenu(chatID int64, text string) {
+	user, _ := c.store.Get(chatID)
+	buttons := [][]messenger.Button{}
+	for _, p := range c.providers(user) {
+		data, err := CallbackData(CallbackProvider, p.Name)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		title := p.Name
+		if p.Name == providerName(user) {
+			title = "✅ " + title
+		}
+		buttons = append(buttons, messenger.Row(messenger.Button{Text: title, Data: data}))
+	}
+	c.bot.SendText(messenger.Text{
+		ChatID:   chatID,
+		Text:     text,
+		Keyboard: messenger.InlineKeyboard(buttons...),
+	})
+}
+
+// HandleProviderChoose handles CallbackProvider buttons, payload is provider name.
+// During onboarding provider with key skips key entry, in dialog it switches the session.
+//
+// StatusAwaitingKey -> StatusAwaitingModel (provider has key)
+//
+// StatusDialog -> StatusAwaitingKey (neither provider nor user has a key)
+//
+// StatusDialog -> StatusAwaitingModel (provider has no model)
+func (c *Commander) HandleProviderChoose(query *tgbotapi.CallbackQuery, name string) string {
+	chatID := query.Message.Chat.ID
+	user, ok := c.store.Get(chatID)
+	if !ok || (user.DialogStatus != db.StatusAwaitingKey && user.DialogStatus != db.StatusDialog) {
+		return msgTemplates["outdated_button"]
+	}
+	p, ok := c.findProvider(user, name)
+	if !ok {
+		return msgTemplates["provider_unknown"]
+	}
+	c.bot.Delete(chatID, query.Message.MessageID)
+	c.switchProvider(chatID, p)
+	return "🐈💨"
+}
+
+// switchProvider selects provider of the user and continues onboarding or dialog with it
+func (c *Commander) switchProvider(chatID int64, p db.Provider) {
+	user, err := c.store.Update(chatID, func(user *db.User) {
+		user.UseProvider(p)
+	})
+	if err != nil {
+		log.Println("error switching provider:", err)
+		return
+	}
+	log.Printf("user %d switched to provider %q\n", chatID, providerName(user))
+
+	switch user.DialogStatus {
+	case db.StatusAwaitingKey:
+		if user.AiSession.GptKey == "" {
+			c.send(chatID, fmt.Sprintf(msgTemplates["provider_key"], providerName(user)))
+			return
+		}
+		c.RenderModelMenuLAI(chatID, langchain.GetModelsList(user.AiSession.GptKey, c.Endpoint(user)))
+		c.ChangeDialogStatus(chatID, db.StatusAwaitingModel)
+	case db.StatusDialog:
+		if user.AiSession.GptKey == "" {
+			// key of the previous provider must not go to this one
+			c.send(chatID, fmt.Sprintf(msgTemplates["provider_key"], providerName(user)))
+			c.ChangeDialogStatus(chatID, db.StatusAwaitingKey)
+			return
+		}
+		if p.Model == "" {
+			// models of another endpoint differ, history is kept until language is chosen again
+			c.RenderModelMenuLAI(chatID, langchain.GetModelsList(user.AiSession.GptKey, c.Endpoint(user)))
+			c.ChangeDialogStatus(chatID, db.StatusAwaitingModel)
+			return
+		}
+		c.send(chatID, fmt.Sprintf(msgTemplates["provider_switched"], providerName(user), user.AiSession.GptModel))
+	}
+}
+
+// parseProvider parses "<name> <localai|openai> <endpoint|-> [key|-] [model]"
+func parseProvider(args string) (db.Provider, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 3 || len(fields) > 5 {
+		return db.Provider{}, fmt.Errorf("use: /provider add <name> <localai|openai> <endpoint|-> [key|-] [model]")
+	}
+	for len(fields) < 5 {
+		fields = append(fields, "-")
+	}
+	for i := range fields {
+		if fields[i] == "-" {
+			fields[i] = ""
+		}
+	}
+	p := db.Provider{Name: fields[0], Type: strings.ToLower(fields[1]), Endpoint: fields[2], Key: fields[3], Model: fields[4]}
+	if p.Name == config.DefaultProvider {
+		return p, fmt.Errorf("%q is the endpoint from config, choose another name", config.DefaultProvider)
+	}
+	if len(p.Name) > callbackDataLimit-len(CallbackProvider)-1 {
+		return p, fmt.Errorf("provider name is too long")
+	}
+	return p, p.Validate()
+}
+
+// checkEndpoint refuses own provider on loopback or private network address unless it's trusted (see langchain.TrustEndpoints),
+// requests to it would fail anyway. Hosts which can't be resolved now are saved.
+func (c *Commander) checkEndpoint(p db.Provider) error {
+	if p.Endpoint == "" || langchain.Trusted(p.Endpoint) {
+		return nil
+	}
+	u, err := url.Parse(p.Endpoint)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, 5*time.Second)
+	defer cancel()
+	if err := agent.CheckPublic(ctx, u.Hostname()); errors.Is(err, agent.ErrPrivateAddress) {
+		return fmt.Errorf("endpoint %s is on a private network address, only endpoints from config can be there", u.Host)
+	}
+	return nil
+}
+
+// ManageProviders runs /provider for the chat: without arguments it shows provider menu,
+// "add", "remove" and "use" change own profiles of the chat.
+// Admins run it for other users with /provider_for, then actorID differs from chatID.
+func (c *Commander) ManageProviders(actorID, chatID int64, args string) {
+	action, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+	user, ok := c.store.Get(chatID)
+	if !ok {
+		c.send(actorID, fmt.Sprintf("user %d not found", chatID))
+		return
+	}
+
+	switch action {
+	case "":
+		if actorID != chatID {
+			c.send(actorID, c.describeProviders(user))
+			return
+		}
+		c.RenderProviderMenu(chatID, c.describeProviders(user))
+	case "add":
+		p, err := parseProvider(rest)
+		if err == nil {
+			err = c.checkEndpoint(p)
+		}
+		if err != nil {
+			c.send(actorID, err.Error())
+			return
+		}
+		c.UpdateUser(chatID, func(user *db.User) {
+			user.SaveProvider(p)
+		})
+		c.send(actorID, fmt.Sprintf(msgTemplates["provider_saved"], p.Name))
+	case "remove":
+		if providerName(user) == rest {
+			c.send(actorID, "switch to another provider before removing it")
+			return
+		}
+		removed := false
+		c.UpdateUser(chatID, func(user *db.User) {
+			removed = user.RemoveProvider(rest)
+		})
+		if !removed {
+			c.send(actorID, msgTemplates["provider_unknown"])
+			return
+		}
+		c.send(actorID, fmt.Sprintf("provider %s is removed", rest))
+	case "use":
+		p, ok := c.findProvider(user, rest)
+		if !ok {
+			c.send(actorID, msgTemplates["provider_unknown"])
+			return
+		}
+		if user.DialogStatus != db.StatusDialog && user.DialogStatus != db.StatusAwaitingKey {
+			c.send(actorID, msgTemplates["finish_setup"])
+			return
+		}
+		c.switchProvider(chatID, p)
+		if actorID != chatID {
+			c.send(actorID, fmt.Sprintf("user %d switched to %s", chatID, rest))
+		}
+	default:
+		c.send(actorID, "use: /provider [add|remove|use] ...")
+	}
+}
+
+// describeProviders lists providers available to the user, keys are not shown
+func (c *Commander) describeProviders(user db.User) string {
+	lines := []string{fmt.Sprintf(msgTemplates["provider_header"], providerName(user))}
+	for _, p := range c.providers(user) {
+		line := "- " + p.Name
+		switch {
+		case p.Name == config.DefaultProvider:
+			line += " (from config)"
+		case p.Type == db.ProviderOpenAI:
+			line += " (openai)"
+		default:
+			line += " (" + p.Type + " " + p.Endpoint + ")"
+		}
+		if p.Model != "" {
+			line += ", model " + p.Model
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,182 @@
+package command_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// pressButton clicks inline button of the last message of the chat
+func pressButton(comm *command.Commander, fake *messenger.Fake, chatID int64, button string) string {
+	messages := fake.Messages(chatID)
+	return press(comm, fake, messages[len(messages)-1], chatID, button)
+}
+
+func newProviderCommander() (*command.Commander, *messenger.Fake, *database.MemoryStore) {
+	fake := messenger.NewFake("hellper_bot")
+	store := database.NewMemoryStore()
+	cfg := config.Default()
+	cfg.AI.Endpoint = "http://127.0.0.1:1"
+	cfg.AI.Providers = []config.Provider{
+		{Name: "team", Type: database.ProviderLocalAI, Endpoint: "http://127.0.0.1:2", Key: "team-key", Model: "tiger-gemma"},
+	}
+	comm := command.NewCommander(fake, store, context.Background(), cfg)
+	comm.Callbacks().Handle(command.CallbackProvider, comm.HandleProviderChoose)
+	langchain.TrustEndpoints(cfg.AI)
+	return comm, fake, store
+}
+
+func TestProviderDuringOnboarding(t *testing.T) {
+	comm, fake, store := newProviderCommander()
+	store.Save(database.User{ID: 1, DialogStatus: database.StatusNew})
+
+	comm.InputYourAPIKey(&tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, Text: "Start!"})
+	if answer := pressButton(comm, fake, 1, "team"); answer == "" {
+		t.Fatal("provider button is not handled")
+	}
+
+	user, _ := store.Get(1)
+	if user.DialogStatus != database.StatusAwaitingModel {
+		t.Fatalf("provider with key must skip key entry, status %s", user.DialogStatus)
+	}
+	if user.AiSession.GptKey != "team-key" || user.AiSession.GptModel != "tiger-gemma" || user.Network != database.ProviderLocalAI {
+		t.Errorf("provider is not applied: %+v", user.AiSession)
+	}
+	if comm.Endpoint(user) != "http://127.0.0.1:2" {
+		t.Errorf("unexpected endpoint %q", comm.Endpoint(user))
+	}
+	ai := comm.AI(user)
+	if ai.URL(ai.ImageGeneration) != "http://127.0.0.1:2/v1/images/generations" || ai.APIKey != "team-key" {
+		t.Errorf("images must use the provider: %+v", ai)
+	}
+	if e := comm.Embeddings(user); e.Endpoint != "http://127.0.0.1:2" || e.APIKey != "team-key" {
+		t.Errorf("embeddings of the agent must use the provider: %+v", e)
+	}
+}
+
+func TestProviderCommand(t *testing.T) {
+	comm, fake, store := newProviderCommander()
+	store.Save(database.User{ID: 1, DialogStatus: database.StatusDialog, AiSession: database.AiSession{GptKey: "own", OwnKey: "own", GptModel: "local-model"}})
+
+	comm.ManageProviders(1, 1, "add work openai - sk-work gpt-4o")
+	comm.ManageProviders(1, 1, "add broken ftp ftp://example.com")
+	comm.ManageProviders(1, 1, "")
+	messages := fake.Messages(1)
+	menu := messages[len(messages)-1].Text
+	for _, want := range []string{"Current provider: default", "- team (localai http://127.0.0.1:2), model tiger-gemma", "- work (openai), model gpt-4o"} {
+		if !strings.Contains(menu, want) {
+			t.Errorf("menu must contain %q:\n%s", want, menu)
+		}
+	}
+	if answer := pressButton(comm, fake, 1, "work"); answer == "" {
+		t.Fatal("provider button is not handled")
+	}
+
+	user, _ := store.Get(1)
+	if user.DialogStatus != database.StatusDialog || user.AiSession.GptModel != "gpt-4o" || user.AiSession.GptKey != "sk-work" {
+		t.Fatalf("provider with model must switch the session in place: %+v", user)
+	}
+	if comm.Endpoint(user) != "" || user.AiSession.AI_Type != database.AITypeOpenAI {
+		t.Errorf("openai provider must use openai endpoint, got %q", comm.Endpoint(user))
+	}
+	if ai := comm.AI(user); ai.URL(ai.VoiceRecognition) != "https://api.openai.com/v1/audio/transcriptions" || ai.APIKey != "sk-work" {
+		t.Errorf("transcription must use openai: %+v", ai)
+	}
+
+	// admin switches the user back, default provider has no model so user picks it again
+	comm.ManageProviders(10, 1, "use default")
+	user, _ = store.Get(1)
+	if user.DialogStatus != database.StatusAwaitingModel || comm.Endpoint(user) != "http://127.0.0.1:1" {
+		t.Errorf("expected model choice on default endpoint, got %s %q", user.DialogStatus, comm.Endpoint(user))
+	}
+	if user.AiSession.GptKey != "own" {
+		t.Errorf("default provider must use own key of the user, got %q", user.AiSession.GptKey)
+	}
+
+	report := []string{}
+	for _, msg := range fake.Messages(1) {
+		report = append(report, msg.Text)
+	}
+	text := strings.Join(report, "\n")
+	for _, want := range []string{
+		"Provider work is saved",
+		"unknown provider type",
+		"Switched to work, model gpt-4o",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("messages must contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "sk-work") {
+		t.Error("keys must not be shown")
+	}
+	if msgs := fake.Messages(10); len(msgs) != 1 || !strings.Contains(msgs[0].Text, "switched to default") {
+		t.Errorf("admin must get confirmation, got %+v", msgs)
+	}
+}
+
+func TestProviderKeysDontLeak(t *testing.T) {
+	comm, fake, store := newProviderCommander()
+	store.Save(database.User{ID: 1, DialogStatus: database.StatusDialog, AiSession: database.AiSession{GptKey: "own", OwnKey: "own", GptModel: "local-model"}})
+	store.Save(database.User{ID: 2, DialogStatus: database.StatusDialog, AiSession: database.AiSession{GptModel: "local-model"}})
+
+	for _, id := range []int64{1, 2} {
+		comm.ManageProviders(id, id, "use team")
+		comm.ManageProviders(id, id, "add mine localai http://203.0.113.3 - tiger-gemma")
+		comm.ManageProviders(id, id, "use mine")
+	}
+
+	user, _ := store.Get(1)
+	if user.AiSession.GptKey != "own" || user.DialogStatus != database.StatusDialog {
+		t.Errorf("provider without key must use own key of the user, got %q %s", user.AiSession.GptKey, user.DialogStatus)
+	}
+	if e := comm.Embeddings(user); e.Endpoint != "http://203.0.113.3" || e.APIKey != "own" {
+		t.Errorf("embeddings of the agent must use the provider: %+v", e)
+	}
+	user, _ = store.Get(2)
+	if user.AiSession.GptKey != "" || user.DialogStatus != database.StatusAwaitingKey {
+		t.Errorf("user without own key must be asked for it, got %q %s", user.AiSession.GptKey, user.DialogStatus)
+	}
+	messages := fake.Messages(2)
+	if last := messages[len(messages)-1].Text; last != "Input api key for mine" {
+		t.Errorf("unexpected message %q", last)
+	}
+}
+
+func TestPrivateProviderIsRefused(t *testing.T) {
+	comm, fake, store := newProviderCommander()
+	defer langchain.TrustEndpoints(config.AI{})
+	store.Save(database.User{ID: 1, DialogStatus: database.StatusDialog, AiSession: database.AiSession{GptKey: "own", OwnKey: "own", GptModel: "local-model"}})
+
+	comm.ManageProviders(1, 1, "add lan localai http://127.0.0.1:8080 - tiger-gemma")
+	messages := fake.Messages(1)
+	if last := messages[len(messages)-1].Text; !strings.Contains(last, "private network address") {
+		t.Errorf("private endpoint must be refused, got %q", last)
+	}
+	// endpoints from config are trusted
+	comm.ManageProviders(1, 1, "add team-own localai http://127.0.0.1:2 - tiger-gemma")
+	user, _ := store.Get(1)
+	if _, ok := user.FindProvider("lan"); ok {
+		t.Error("private provider must not be saved")
+	}
+	if _, ok := user.FindProvider("team-own"); !ok {
+		t.Error("provider on endpoint from config must be saved")
+	}
+	if client := comm.Embeddings(user).Client; client != http.DefaultClient {
+		t.Error("default endpoint from config must use default client")
+	}
+
+	comm.ManageProviders(1, 1, "use team-own")
+	user, _ = store.Get(1)
+	if client := comm.Embeddings(user).Client; client != http.DefaultClient {
+		t.Error("endpoint from config must use default client")
+	}
+}
@@ -0,0 +1,42 @@
+package command
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/langchain"
+)
+
+// enqueueGeneration puts generation job into the scheduler.
+// While job is waiting user sees "you are #N in queue" message, which is edited as queue moves and removed when generation starts.
+func (c *Commander) enqueueGeneration(chatID int64, run func()) {
+	// admins from config go first
+	_, admin := c.admins.Get(chatID)
+
+	// callbacks are called from a single scheduler goroutine, no locking needed
+	statusMessageID := 0
+	c.scheduler.Submit(langchain.Job{
+		ChatID:   chatID,
+		Priority: admin,
+		Run:      run,
+		OnPosition: func(position int) {
+			text := fmt.Sprintf(msgTemplates["queue"], position)
+			if statusMessageID == 0 {
+				sent, err := c.bot.SendText(messenger.Text{ChatID: chatID, Text: text})
+				if err != nil {
+					log.Println("could not send queue status:", err)
+					return
+				}
+				statusMessageID = sent
+				return
+			}
+			c.bot.EditText(chatID, statusMessageID, text, messenger.ModePlain)
+		},
+		OnStart: func() {
+			if statusMessageID != 0 {
+				c.bot.Delete(chatID, statusMessageID)
+			}
+		},
+	})
+}
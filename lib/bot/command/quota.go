@@ -0,0 +1,173 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/config"
+	db "github.com/JackBekket/hellper/lib/database"
+)
+
+// QuotaError tells user which limit is exceeded and when it resets
+type QuotaError struct {
+	// Limit is "tokens", "requests" or "images"
+	Limit string
+	// Max is the limit from config
+	Max     int
+	ResetAt time.Time
+	// now is time of the check, reset is shown relative to it
+	now time.Time
+}
+
+func (e *QuotaError) Error() string {
+	wait := e.ResetAt.Sub(e.now).Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return fmt.Sprintf(msgTemplates["quota_"+e.Limit], e.Max, wait, e.ResetAt.UTC().Format("15:04:05 UTC"))
+}
+
+// quotaUsage is what the chat used today and during the last minute
+type quotaUsage struct {
+	// day is start of the day (UTC) counters belong to
+	day    time.Time
+	tokens int
+	images int
+	// requests are times of requests made during the last minute
+	requests []time.Time
+}
+
+// Limiter enforces quotas from config. Counters are kept in memory, daily ones are read from the usage ledger
+// the first time a chat is seen that day, so a restart doesn't reset them. Requests per minute start from zero.
+// Tokens are taken from session usage after generation, so the request that crosses the limit is still answered.
+type Limiter struct {
+	mu     sync.Mutex
+	cfg    *config.Config
+	admins *Admins
+	ledger db.UsageStore
+	now    func() time.Time
+	usage  map[int64]*quotaUsage
+}
+
+// NewLimiter creates limiter, ledger (can be nil) has usage recorded before start, now is a clock (time.Now except tests)
+func NewLimiter(cfg *config.Config, admins *Admins, ledger db.UsageStore, now func() time.Time) *Limiter {
+	return &Limiter{
+		cfg:    cfg,
+		admins: admins,
+		ledger: ledger,
+		now:    now,
+		usage:  make(map[int64]*quotaUsage),
+	}
+}
+
+// Quota returns limits of the chat
+func (l *Limiter) Quota(chatID int64) config.Quota {
+	role := ""
+	if admin, ok := l.admins.Get(chatID); ok {
+		role = admin.Role
+	}
+	return l.cfg.Quotas.For(chatID, role)
+}
+
+// current returns counters of the chat, daily counters are read from the ledger when day changes. l.mu must be held.
+func (l *Limiter) current(chatID int64, now time.Time) *quotaUsage {
+	day := db.Day(now)
+	u, ok := l.usage[chatID]
+	if !ok || !u.day.Equal(day) {
+		if !ok {
+			u = &quotaUsage{}
+			l.usage[chatID] = u
+		}
+		u.day = day
+		u.tokens, u.images = l.usedOn(chatID, day)
+	}
+	minuteAgo := now.Add(-time.Minute)
+	for len(u.requests) > 0 && !u.requests[0].After(minuteAgo) {
+		u.requests = u.requests[1:]
+	}
+	return u
+}
+
+// usedOn returns tokens and images the chat used on the day according to the ledger
+func (l *Limiter) usedOn(chatID int64, day time.Time) (tokens, images int) {
+	if l.ledger == nil {
+		return 0, 0
+	}
+	records, err := l.ledger.ListUsage(chatID, day)
+	if err != nil {
+		log.Printf("could not read usage of chat %d, daily quota starts from zero: %v\n", chatID, err)
+		return 0, 0
+	}
+	for _, record := range records {
+		if !record.Day.Equal(day) {
+			continue
+		}
+		tokens += record.TotalTokens
+		if record.Feature == db.FeatureImage {
+			images += record.Requests
+		}
+	}
+	return tokens, images
+}
+
+// requestsError returns error if chat made too many requests during the last minute
+func requestsError(u *quotaUsage, quota config.Quota, now time.Time) error {
+	if quota.RequestsPerMinute > 0 && len(u.requests) >= quota.RequestsPerMinute {
+		return &QuotaError{Limit: "requests", Max: quota.RequestsPerMinute, ResetAt: u.requests[0].Add(time.Minute), now: now}
+	}
+	return nil
+}
+
+// AllowRequest counts a dialog request, *QuotaError is returned if the chat is out of quota
+func (l *Limiter) AllowRequest(chatID int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	u := l.current(chatID, now)
+	quota := l.Quota(chatID)
+	if quota.TokensPerDay > 0 && u.tokens >= quota.TokensPerDay {
+		return &QuotaError{Limit: "tokens", Max: quota.TokensPerDay, ResetAt: u.day.Add(24 * time.Hour), now: now}
+	}
+	if err := requestsError(u, quota, now); err != nil {
+		return err
+	}
+	u.requests = append(u.requests, now)
+	return nil
+}
+
+// AllowImage counts image generation, it is a request too. *QuotaError is returned if the chat is out of quota.
+func (l *Limiter) AllowImage(chatID int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	u := l.current(chatID, now)
+	quota := l.Quota(chatID)
+	if quota.ImagesPerDay > 0 && u.images >= quota.ImagesPerDay {
+		return &QuotaError{Limit: "images", Max: quota.ImagesPerDay, ResetAt: u.day.Add(24 * time.Hour), now: now}
+	}
+	if err := requestsError(u, quota, now); err != nil {
+		return err
+	}
+	u.images++
+	u.requests = append(u.requests, now)
+	return nil
+}
+
+// AddTokens counts tokens spent by generation
+func (l *Limiter) AddTokens(chatID int64, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current(chatID, l.now()).tokens += tokens
+}
+
+// TokensToday returns tokens spent by the chat today
+func (l *Limiter) TokensToday(chatID int64) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current(chatID, l.now()).tokens
+}
@@ -0,0 +1,160 @@
+package command_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newLimiter(quotas config.Quotas) (*command.Limiter, *clock) {
+	cfg := config.Default()
+	cfg.Quotas = quotas
+	cfg.Admins.List = []config.Admin{{ID: 10, Role: config.RoleAdmin}, {ID: 11, Role: config.RoleModerator}}
+	clk := &clock{now: time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)}
+	return command.NewLimiter(cfg, command.NewAdmins(cfg), nil, clk.Now), clk
+}
+
+func TestRequestsPerMinute(t *testing.T) {
+	limiter, clk := newLimiter(config.Quotas{Default: config.Quota{RequestsPerMinute: 2}})
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.AllowRequest(1); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		clk.now = clk.now.Add(10 * time.Second)
+	}
+	err := limiter.AllowRequest(1)
+	var quotaErr *command.QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Limit != "requests" {
+		t.Fatalf("third request must be refused, got %v", err)
+	}
+	// the first request leaves the window 60s after it was made
+	if !strings.Contains(err.Error(), "40s") {
+		t.Errorf("message must tell when to retry: %q", err)
+	}
+	// admins without role quota are not limited
+	for i := 0; i < 5; i++ {
+		if err := limiter.AllowRequest(10); err != nil {
+			t.Fatal("admin must not be limited:", err)
+		}
+	}
+
+	clk.now = clk.now.Add(40 * time.Second)
+	if err := limiter.AllowRequest(1); err != nil {
+		t.Fatal("request must be allowed after the window moved:", err)
+	}
+}
+
+func TestDailyQuotas(t *testing.T) {
+	limiter, clk := newLimiter(config.Quotas{
+		Default: config.Quota{TokensPerDay: 100, ImagesPerDay: 1},
+		Roles:   map[string]config.Quota{config.RoleModerator: {ImagesPerDay: 2}},
+	})
+
+	if err := limiter.AllowRequest(1); err != nil {
+		t.Fatal(err)
+	}
+	// the answer that crosses the limit is still delivered, next request is refused
+	limiter.AddTokens(1, 150)
+	err := limiter.AllowRequest(1)
+	if err == nil || !strings.Contains(err.Error(), "100 tokens") || !strings.Contains(err.Error(), "2h0m0s") {
+		t.Fatalf("expected token limit with reset at midnight UTC, got %v", err)
+	}
+
+	if err := limiter.AllowImage(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.AllowImage(1); err == nil {
+		t.Fatal("second image must be refused")
+	}
+	for i := 0; i < 2; i++ {
+		if err := limiter.AllowImage(11); err != nil {
+			t.Fatal("moderator quota must be used:", err)
+		}
+	}
+
+	clk.now = clk.now.Add(2 * time.Hour)
+	if err := limiter.AllowRequest(1); err != nil {
+		t.Fatal("tokens must reset at midnight:", err)
+	}
+	if err := limiter.AllowImage(1); err != nil {
+		t.Fatal("images must reset at midnight:", err)
+	}
+	if limiter.TokensToday(1) != 0 {
+		t.Errorf("tokens of new day = %d", limiter.TokensToday(1))
+	}
+}
+
+func TestDailyQuotasSurviveRestart(t *testing.T) {
+	cfg := config.Default()
+	cfg.Quotas.Default = config.Quota{TokensPerDay: 100, ImagesPerDay: 1}
+	clk := &clock{now: time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)}
+	ledger := database.NewMemoryStore()
+	today, yesterday := database.Day(clk.now), database.Day(clk.now.Add(-24*time.Hour))
+	for _, record := range []database.UsageRecord{
+		{ChatID: 1, Day: yesterday, Model: "llama", Feature: database.FeatureChat, Requests: 9, TotalTokens: 1000},
+		{ChatID: 1, Day: today, Model: "llama", Feature: database.FeatureChat, Requests: 2, TotalTokens: 80},
+		{ChatID: 1, Day: today, Model: "stablediffusion", Feature: database.FeatureImage, Requests: 1},
+		{ChatID: 2, Day: today, Model: "llama", Feature: database.FeatureChat, Requests: 5, TotalTokens: 500},
+	} {
+		ledger.AddUsage(record)
+	}
+
+	// limiter of the restarted bot
+	limiter := command.NewLimiter(cfg, command.NewAdmins(cfg), ledger, clk.Now)
+	if limiter.TokensToday(1) != 80 {
+		t.Errorf("tokens used today before restart = %d", limiter.TokensToday(1))
+	}
+	if err := limiter.AllowImage(1); err == nil {
+		t.Error("image used before restart must count")
+	}
+	if err := limiter.AllowRequest(1); err != nil {
+		t.Fatal(err)
+	}
+	limiter.AddTokens(1, 30)
+	if err := limiter.AllowRequest(1); err == nil || !strings.Contains(err.Error(), "100 tokens") {
+		t.Errorf("tokens used before and after restart must add up, got %v", err)
+	}
+
+	clk.now = clk.now.Add(2 * time.Hour)
+	if limiter.TokensToday(1) != 0 {
+		t.Errorf("tokens of new day = %d", limiter.TokensToday(1))
+	}
+}
+
+func TestDialogRefusedOverQuota(t *testing.T) {
+	fake := messenger.NewFake("hellper_bot")
+	store := database.NewMemoryStore()
+	cfg := config.Default()
+	cfg.Quotas.Default.TokensPerDay = 10
+	comm := command.NewCommander(fake, store, context.Background(), cfg)
+	store.Save(database.User{ID: 1, DialogStatus: database.StatusDialog})
+	comm.Limiter().AddTokens(1, 10)
+
+	comm.DialogSequence(&tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, Text: "hello"})
+	// commands generating without the dialog are limited too
+	comm.RAG(1, "hello", 1)
+	comm.Instruct(1, "hello")
+
+	messages := fake.Messages(1)
+	if len(messages) != 3 {
+		t.Fatalf("expected refusals, got %+v", messages)
+	}
+	for _, msg := range messages {
+		if !strings.Contains(msg.Text, "daily limit of 10 tokens") {
+			t.Errorf("expected refusal, got %q", msg.Text)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package command
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/database"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegram accepts only lowercase latin letters, digits and underscores in command names
+var commandNameRe = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// Command is a bot command, e.g. /image.
+// The same description is used for /help and for the command menu in telegram clients.
+type Command struct {
+	// Name without slash, lowercase
+	Name        string
+	Description string
+	// Args describes arguments syntax for /help, e.g. "<prompt>", empty if command takes no arguments
+	Args string
+	// States in which command is available, empty means any status
+	States    []database.DialogStatus
+	AdminOnly bool
+	// Permission restricts command to admin roles having it, implies AdminOnly
+	Permission Permission
+	Handler    func(msg *tgbotapi.Message, user database.User)
+}
+
+func (cmd Command) availableIn(status database.DialogStatus) bool {
+	if len(cmd.States) == 0 {
+		return true
+	}
+	for _, s := range cmd.States {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (cmd Command) adminOnly() bool {
+	return cmd.AdminOnly || cmd.Permission != ""
+}
+
+// allowedFor checks admin rights by admins list, without the list (cli, tests) database.User.Admin is trusted
+func (cmd Command) allowedFor(user database.User, admins *Admins) bool {
+	if !cmd.adminOnly() {
+		return true
+	}
+	if admins == nil {
+		return user.Admin
+	}
+	return admins.Can(user.ID, cmd.Permission)
+}
+
+// Registry keeps bot commands in registration order.
+type Registry struct {
+	commands []Command
+	byName   map[string]int
+	admins   *Admins
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]int),
+	}
+}
+
+// SetAdmins sets admins list used to check admin-only commands
+func (r *Registry) SetAdmins(admins *Admins) {
+	r.admins = admins
+}
+
+// Register adds command, returns error for invalid or duplicate name.
+func (r *Registry) Register(cmd Command) error {
+	if !commandNameRe.MatchString(cmd.Name) {
+		return fmt.Errorf("invalid command name %q", cmd.Name)
+	}
+	if _, ok := r.byName[cmd.Name]; ok {
+		return fmt.Errorf("command /%s is already registered", cmd.Name)
+	}
+	if cmd.Handler == nil {
+		return fmt.Errorf("command /%s has no handler", cmd.Name)
+	}
+	r.byName[cmd.Name] = len(r.commands)
+	r.commands = append(r.commands, cmd)
+	return nil
+}
+
+// MustRegister is like Register but panics on error, use it for commands known at compile time.
+func (r *Registry) MustRegister(cmd Command) {
+	if err := r.Register(cmd); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup finds command by name, case insensitive, so /setContext and /setcontext are the same command.
+func (r *Registry) Lookup(name string) (Command, bool) {
+	i, ok := r.byName[strings.ToLower(name)]
+	if !ok {
+		return Command{}, false
+	}
+	return r.commands[i], true
+}
+
+// Commands returns all registered commands
+func (r *Registry) Commands() []Command {
+	return append([]Command(nil), r.commands...)
+}
+
+// HelpText renders list of commands visible for the user.
+// Commands not available in current dialog status are listed too, so user knows what setup unlocks.
+func (r *Registry) HelpText(user database.User) string {
+	var sb strings.Builder
+	sb.WriteString(msgTemplates["help_header"])
+	for _, cmd := range r.commands {
+		if !cmd.allowedFor(user, r.admins) {
+			continue
+		}
+		sb.WriteString("\n/" + cmd.Name)
+		if cmd.Args != "" {
+			sb.WriteString(" " + cmd.Args)
+		}
+		sb.WriteString(" -- " + cmd.Description)
+		if !cmd.availableIn(user.DialogStatus) {
+			sb.WriteString(" " + msgTemplates["help_after_setup"])
+		}
+	}
+	return sb.String()
+}
+
+// Publish sets command menu shown by telegram clients. Admin-only commands are not published.
+func (r *Registry) Publish(bot messenger.Messenger) error {
+	botCommands := []messenger.BotCommand{}
+	for _, cmd := range r.commands {
+		if cmd.adminOnly() {
+			continue
+		}
+		description := cmd.Description
+		if cmd.Args != "" {
+			description = cmd.Args + " " + description
+		}
+		botCommands = append(botCommands, messenger.BotCommand{
+			Command:     cmd.Name,
+			Description: description,
+		})
+	}
+	return bot.SetCommands(botCommands)
+}
+
+// Dispatch runs command from the message.
+// Returns false if the message is not a registered command, otherwise the command is considered handled,
+// even if user is not allowed to run it (user gets explanation then).
+func (r *Registry) Dispatch(bot messenger.Messenger, msg *tgbotapi.Message, user database.User) bool {
+	cmd, ok := r.Lookup(msg.Command())
+	if !ok {
+		return false
+	}
+	switch {
+	case !cmd.allowedFor(user, r.admins):
+		log.Printf("user %d tried admin command /%s", user.ID, cmd.Name)
+		messenger.Say(bot, msg.Chat.ID, msgTemplates["admin_only"])
+	case !cmd.availableIn(user.DialogStatus):
+		messenger.Say(bot, msg.Chat.ID, msgTemplates["finish_setup"])
+	default:
+		cmd.Handler(msg, user)
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package command_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/database"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func noop(msg *tgbotapi.Message, user database.User) {}
+
+func TestRegistryHelpAndLookup(t *testing.T) {
+	r := command.NewRegistry()
+	r.MustRegister(command.Command{Name: "help", Description: "print this message", Handler: noop})
+	r.MustRegister(command.Command{Name: "setcontext", Description: "set context", Args: "<collection>",
+		States: []database.DialogStatus{database.StatusDialog}, Handler: noop})
+	r.MustRegister(command.Command{Name: "ban", Description: "ban user", AdminOnly: true, Handler: noop})
+
+	if err := r.Register(command.Command{Name: "help", Handler: noop}); err == nil {
+		t.Fatal("duplicate command was registered")
+	}
+	if err := r.Register(command.Command{Name: "setContext", Handler: noop}); err == nil {
+		t.Fatal("command with uppercase name was registered")
+	}
+	if _, ok := r.Lookup("setContext"); !ok {
+		t.Fatal("lookup should be case insensitive")
+	}
+
+	help := r.HelpText(database.User{DialogStatus: database.StatusAwaitingKey})
+	if !strings.Contains(help, "/setcontext <collection> -- set context (after setup)") {
+		t.Fatalf("unexpected help:\n%s", help)
+	}
+	if strings.Contains(help, "/ban") {
+		t.Fatalf("admin command is shown to user:\n%s", help)
+	}
+	help = r.HelpText(database.User{Admin: true, DialogStatus: database.StatusDialog})
+	if !strings.Contains(help, "/ban -- ban user") || strings.Contains(help, "(after setup)") {
+		t.Fatalf("unexpected admin help:\n%s", help)
+	}
+}
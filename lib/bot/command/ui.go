@@ -1,31 +1,42 @@
 package command
 
-import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+import (
+	"log"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+)
 
 // Render LLaMA-based Model Menu with Inline Keyboard
 func (c *Commander) RenderModelMenuLAI(chatID int64, modelsList []string) {
-	msg := tgbotapi.NewMessage(chatID, msgTemplates["case1"])
-	buttons := [][]tgbotapi.InlineKeyboardButton{}
+	buttons := [][]messenger.Button{}
 	for _, model := range modelsList {
-		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(model, model),
+		data, err := CallbackData(CallbackModel, model)
+		if err != nil {
+			// model name is too long for a button, it can't be chosen from menu
+			log.Println(err)
+			continue
+		}
+		buttons = append(buttons, messenger.Row(
+			messenger.Button{Text: model, Data: data},
 		))
 	}
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-		buttons...,
-	)
-	c.bot.Send(msg)
+	c.bot.SendText(messenger.Text{
+		ChatID:   chatID,
+		Text:     msgTemplates["case1"],
+		Keyboard: messenger.InlineKeyboard(buttons...),
+	})
 }
 
 // Render Language Menu with Inline Keyboard
 func (c *Commander) RenderLanguage(chatID int64) {
-	msg := tgbotapi.NewMessage(chatID, "Choose a language or send 'Hello' in your desired language.")
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("English", "English"),
-			tgbotapi.NewInlineKeyboardButtonData("Russian", "Russian"),
+	c.bot.SendText(messenger.Text{
+		ChatID: chatID,
+		Text:   "Choose a language or send 'Hello' in your desired language.",
+		Keyboard: messenger.InlineKeyboard(
+			messenger.Row(
+				messenger.Button{Text: "English", Data: CallbackLanguage + ":English"},
+				messenger.Button{Text: "Russian", Data: CallbackLanguage + ":Russian"},
+			),
 		),
-	)
-
-	c.bot.Send(msg)
+	})
 }
@@ -0,0 +1,166 @@
+package command
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	db "github.com/JackBekket/hellper/lib/database"
+)
+
+// usagePeriods are arguments of /usage and /usage_csv with their titles
+var usagePeriods = map[string]string{
+	"today": "today",
+	"week":  "this week",
+	"all":   "all time",
+}
+
+// periodStart returns first day of the period, weeks start on monday (UTC)
+func periodStart(period string, now time.Time) (time.Time, error) {
+	today := db.Day(now)
+	switch period {
+	case "today":
+		return today, nil
+	case "week":
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7), nil
+	case "all":
+		return time.Time{}, nil
+	}
+	return time.Time{}, fmt.Errorf("unknown period %q, use today, week or all", period)
+}
+
+// parsePeriod returns period from command arguments, def if arguments are empty
+func parsePeriod(args, def string) (string, time.Time, error) {
+	period := strings.ToLower(strings.TrimSpace(args))
+	if period == "" {
+		period = def
+	}
+	since, err := periodStart(period, time.Now())
+	return period, since, err
+}
+
+// recordUsage adds records to the ledger, errors are logged
+func (c *Commander) recordUsage(records ...db.UsageRecord) {
+	for _, record := range records {
+		if err := c.usage.AddUsage(record); err != nil {
+			log.Println("could not record usage:", err)
+		}
+	}
+}
+
+// addTurnUsage counts tokens of the last generation of the chat (see db.GetSessionUsage) in quota and ledger
+func (c *Commander) addTurnUsage(chatID int64, model string) {
+	usage := db.GetSessionUsage(chatID)
+	c.limiter.AddTokens(chatID, usage["Total"])
+	c.recordUsage(db.TurnUsage(chatID, model, usage, time.Now())...)
+}
+
+// recordRequest accounts a request without tokens, e.g. image generation or transcription
+func (c *Commander) recordRequest(chatID int64, model, feature string) {
+	c.recordUsage(db.UsageRecord{ChatID: chatID, Day: db.Day(time.Now()), Model: model, Feature: feature, Requests: 1})
+}
+
+// GetUsage sends usage of the chat for the period from arguments (today by default):
+// totals and breakdown by model and feature
+func (c *Commander) GetUsage(chatID int64, args string) {
+	period, since, err := parsePeriod(args, "today")
+	if err != nil {
+		c.send(chatID, err.Error())
+		return
+	}
+	records, err := c.usage.ListUsage(chatID, since)
+	if err != nil {
+		c.send(chatID, "could not read usage: "+err.Error())
+		return
+	}
+
+	type row struct{ model, feature string }
+	rows := []row{}
+	byRow := map[row]db.UsageRecord{}
+	var total db.UsageRecord
+	for _, record := range records {
+		r := row{record.Model, record.Feature}
+		sum, ok := byRow[r]
+		if !ok {
+			rows = append(rows, r)
+		}
+		sum.Requests += record.Requests
+		sum.TotalTokens += record.TotalTokens
+		byRow[r] = sum
+		total.Requests += record.Requests
+		total.PromptTokens += record.PromptTokens
+		total.CompletionTokens += record.CompletionTokens
+		total.TotalTokens += record.TotalTokens
+	}
+
+	user, _ := c.store.Get(chatID)
+	lines := []string{
+		fmt.Sprintf("requests: %d", total.Requests),
+		fmt.Sprintf("promt tokens: %d", total.PromptTokens),
+		fmt.Sprintf("completion tokens: %d", total.CompletionTokens),
+		fmt.Sprintf("total tokens: %d", total.TotalTokens),
+	}
+	for _, r := range rows {
+		model := r.model
+		if model == "" {
+			model = "unknown model"
+		}
+		lines = append(lines, fmt.Sprintf("%s, %s: %d requests, %d tokens", model, r.feature, byRow[r].Requests, byRow[r].TotalTokens))
+	}
+	lines = append(lines, fmt.Sprintf("current session: %d tokens", user.AiSession.Usage["Total"]))
+	c.sendLong(chatID, fmt.Sprintf(msgTemplates["usage_header"], usagePeriods[period]), lines)
+}
+
+// ExportUsage sends usage records of all users for the period from arguments (all time by default) as csv file
+func (c *Commander) ExportUsage(adminID int64, args string) {
+	period, since, err := parsePeriod(args, "all")
+	if err != nil {
+		c.send(adminID, err.Error())
+		return
+	}
+	records, err := c.usage.ListUsage(0, since)
+	if err != nil {
+		c.send(adminID, "could not read usage: "+err.Error())
+		return
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"day", "chat_id", "username", "model", "feature", "requests", "prompt_tokens", "completion_tokens", "total_tokens"})
+	usernames := map[int64]string{}
+	for _, record := range records {
+		username, ok := usernames[record.ChatID]
+		if !ok {
+			user, _ := c.store.Get(record.ChatID)
+			username = user.Username
+			usernames[record.ChatID] = username
+		}
+		w.Write([]string{
+			record.Day.Format(time.DateOnly),
+			strconv.FormatInt(record.ChatID, 10),
+			username,
+			record.Model,
+			record.Feature,
+			strconv.Itoa(record.Requests),
+			strconv.Itoa(record.PromptTokens),
+			strconv.Itoa(record.CompletionTokens),
+			strconv.Itoa(record.TotalTokens),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		c.send(adminID, "could not write csv: "+err.Error())
+		return
+	}
+
+	name := fmt.Sprintf("usage-%s-%s.csv", period, time.Now().UTC().Format(time.DateOnly))
+	if err := c.bot.SendDocument(adminID, messenger.File{Name: name, Reader: &buf}); err != nil {
+		log.Println("could not send usage csv:", err)
+		c.send(adminID, "could not send csv: "+err.Error())
+	}
+}
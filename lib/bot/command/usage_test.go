@@ -0,0 +1,67 @@
+package command_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+)
+
+func TestUsageReport(t *testing.T) {
+	fake := messenger.NewFake("hellper_bot")
+	store := database.NewMemoryStore()
+	comm := command.NewCommander(fake, store, context.Background(), config.Default())
+	store.Save(database.User{ID: 1, Username: "alice", DialogStatus: database.StatusDialog, AiSession: database.AiSession{
+		Usage: map[string]int{"Total": 300},
+	}})
+
+	now := time.Now()
+	turn := map[string]int{"Promt": 100, "Completion": 50, "Total": 150, "ToolCalls": 1}
+	for _, at := range []time.Time{now, now.AddDate(0, 0, -30)} {
+		for _, record := range database.TurnUsage(1, "tiger-gemma", turn, at) {
+			store.AddUsage(record)
+		}
+	}
+	store.AddUsage(database.UsageRecord{ChatID: 2, Day: now, Model: "stablediffusion", Feature: database.FeatureImage, Requests: 1})
+
+	comm.GetUsage(1, "")
+	comm.GetUsage(1, "all")
+	comm.GetUsage(1, "year")
+	messages := fake.Messages(1)
+	if len(messages) != 3 {
+		t.Fatalf("expected two reports and an error, got %+v", messages)
+	}
+	today, all := messages[0].Text, messages[1].Text
+	for _, want := range []string{"Your usage today:", "total tokens: 150", "tiger-gemma, chat: 1 requests, 150 tokens", "tiger-gemma, rag: 1 requests", "current session: 300 tokens"} {
+		if !strings.Contains(today, want) {
+			t.Errorf("report of today must contain %q:\n%s", want, today)
+		}
+	}
+	if !strings.Contains(all, "all time") || !strings.Contains(all, "total tokens: 300") {
+		t.Errorf("unexpected all time report:\n%s", all)
+	}
+	if strings.Contains(today, "stablediffusion") {
+		t.Error("usage of other chats must not be shown")
+	}
+	if !strings.Contains(messages[2].Text, "unknown period") {
+		t.Errorf("unexpected reply to wrong period: %q", messages[2].Text)
+	}
+
+	comm.ExportUsage(10, "today")
+	export := fake.Messages(10)
+	if len(export) != 1 || export[0].Kind != "document" {
+		t.Fatalf("expected csv document, got %+v", export)
+	}
+	lines := strings.Split(strings.TrimSpace(string(export[0].File)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "day,chat_id,username") {
+		t.Fatalf("expected header and 3 records of today, got %q", lines)
+	}
+	if !strings.Contains(lines[1], ",1,alice,tiger-gemma,chat,1,100,50,150") {
+		t.Errorf("unexpected record %q", lines[1])
+	}
+}
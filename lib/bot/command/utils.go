@@ -1,6 +1,9 @@
 package command
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,57 +15,49 @@ import (
 	"path/filepath"
 
 	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
 	db "github.com/JackBekket/hellper/lib/database"
 	"github.com/JackBekket/hellper/lib/embeddings"
+	"github.com/JackBekket/hellper/lib/langchain"
 	"github.com/JackBekket/hellper/lib/localai"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/joho/godotenv"
 )
 
 
 func (c *Commander) HelpCommandMessage(updateMessage *tgbotapi.Message)  {
 	chatID := updateMessage.Chat.ID
-	user := db.UsersMap[chatID]
-	msg := tgbotapi.NewMessage(user.ID, msgTemplates["help_command"])
-	c.bot.Send(msg)
+	user, _ := c.store.Get(chatID)
+	c.send(user.ID, c.commands.HelpText(user))
 }
 
 func (c *Commander) SearchDocuments(chatID int64, promt string, maxResults int) {
-	
-	_ = godotenv.Load()
 
-	conn_pg_link := os.Getenv("PG_LINK")
-	base_url := os.Getenv("AI_BASEURL")
-	db_conn := conn_pg_link
-	user := db.UsersMap[chatID]
+	db_conn := c.cfg.DocumentsURL()
+	user, _ := c.store.Get(chatID)
+	base_url := c.AI(user).Endpoint
 	api_token := user.AiSession.GptKey
-	store,err := embeddings.GetVectorStore(base_url,api_token,db_conn)
+	store,err := embeddings.GetVectorStore(base_url,api_token,db_conn,langchain.HTTPClient(base_url))
 	if err != nil {
 		//return nil, err
-		msg := tgbotapi.NewMessage(user.ID, "error occured: " + err.Error())
-		c.bot.Send(msg)
+		c.send(user.ID, "error occured: " + err.Error())
 	}
 
 
 	results, err := embeddings.SemanticSearch(promt,maxResults,store)
 	if err != nil {
 		//return nil, err
-		msg := tgbotapi.NewMessage(user.ID, "error occured: " + err.Error())
-		c.bot.Send(msg)
+		c.send(user.ID, "error occured: " + err.Error())
 	}
 
 	for i, result := range results {
 		content := result.PageContent
-		msg := tgbotapi.NewMessage(user.ID, "result number: " + fmt.Sprint(i))
-		c.bot.Send(msg)
-		msg = tgbotapi.NewMessage(user.ID, "page content: " + content)
-		c.bot.Send(msg)
+		c.send(user.ID, "result number: " + fmt.Sprint(i))
+		c.send(user.ID, "page content: " + content)
 
 		score := result.Score
 		score_string := fmt.Sprintf("%f", score)
 
-		msg = tgbotapi.NewMessage(user.ID, "score: " + score_string)
-		c.bot.Send(msg)
+		c.send(user.ID, "score: " + score_string)
 	}
 
 }
@@ -71,11 +66,12 @@ func (c *Commander) SearchDocuments(chatID int64, promt string, maxResults int)
 // TODO: OBSOLETE
 // Retrival-Augmented Generation
 func (c *Commander) RAG(chatID int64, promt string, maxResults int) {
-	user := db.UsersMap[chatID]
-	_ = godotenv.Load()
+	user, _ := c.store.Get(chatID)
+	if err := c.limiter.AllowRequest(chatID); err != nil {
+		c.send(chatID, err.Error())
+		return
+	}
 
-	//conn_pg_link := os.Getenv("PG_LINK")
-	//base_url := os.Getenv("AI_BASEURL")
 	//db_conn := conn_pg_link
 	//api_token := user.AiSession.GptKey
 	//store := user.VectorStore
@@ -83,8 +79,7 @@ func (c *Commander) RAG(chatID int64, promt string, maxResults int) {
 	/*
 	if err != nil {
 		//return nil, err
-		msg := tgbotapi.NewMessage(user.ID, "error occured when getting store: " + err.Error())
-		c.bot.Send(msg)
+		c.send(user.ID, "error occured when getting store: " + err.Error())
 	}
 		*/
 
@@ -92,41 +87,39 @@ func (c *Commander) RAG(chatID int64, promt string, maxResults int) {
 	// TODO: Refactor to better readability, remove unused code
 	// TODO: Superagents
 	//result, err := embeddings.Rag(base_url,api_token,promt,maxResults,store)
-	llm := agent.CreateGenericLLM()
+	llm := agent.CreateGenericLLM(c.cfg.AI.Endpoint, c.cfg.AdminKey())
+	llm.CallbacksHandler = langchain.NewChainCallbackHandler(chatID, nil)
+	db.UpdateSessionUsage(chatID, nil)
 	result := agent.OneShotRun(promt, llm)
+	c.addTurnUsage(chatID, agent.GenericModel)
 	/*
 	if err != nil {
-		msg := tgbotapi.NewMessage(user.ID, "error occured when calling RAG: " + err.Error())
-		c.bot.Send(msg)
+		c.send(user.ID, "error occured when calling RAG: " + err.Error())
 	}
 	*/
-	msg := tgbotapi.NewMessage(user.ID, result)
-	c.bot.Send(msg)
+	c.send(user.ID, result)
 }
 
-
-// Get usage for user 
-func (c *Commander) GetUsage(chatID int64)  {
-	user := db.UsersMap[chatID]
-	log.Println("user", user)
-	promt_tokens := user.AiSession.Usage["Promt"]
-	completion_tokens := user.AiSession.Usage["Completion"]
-	total_tokens := user.AiSession.Usage["Total"]
-
-	pt_str := fmt.Sprint(promt_tokens)
-	ct_str := fmt.Sprint(completion_tokens)
-	tt_str := fmt.Sprint(total_tokens)
-
-	msg := tgbotapi.NewMessage(user.ID, "Promt tokens: " + pt_str)
-	c.bot.Send(msg)
-	msg = tgbotapi.NewMessage(user.ID, "Completion tokens: " + ct_str)
-	c.bot.Send(msg)
-	msg = tgbotapi.NewMessage(user.ID, "Total tokens: " + tt_str)
-	c.bot.Send(msg)
+// Instruct generates answer to the prompt with the model of the user, without agent and history
+func (c *Commander) Instruct(chatID int64, promt string) {
+	user, _ := c.store.Get(chatID)
+	if err := c.limiter.AllowRequest(chatID); err != nil {
+		c.send(chatID, err.Error())
+		return
+	}
+	network := "local"
+	if user.Network == db.ProviderOpenAI {
+		network = "openai"
+	}
+	result, err := langchain.GenerateContentInstruction(chatID, c.Endpoint(user), promt, user.AiSession.GptModel, user.AiSession.GptKey, network)
+	c.addTurnUsage(chatID, user.AiSession.GptModel)
+	if err != nil {
+		c.send(chatID, "error: "+err.Error())
+		return
+	}
+	c.send(chatID, result)
 }
 
-
-
 func (c *Commander) SendMediaHelper(chatID int64) {
 
 		// Send helper video error
@@ -157,43 +150,43 @@ func (c *Commander) SendMediaHelper(chatID int64) {
 	  defer videoFile.Close()
 	
 	  // Create a new video message
-	  videoMsg := tgbotapi.NewVideo(chatID, tgbotapi.FileReader{
+	  videoMsg := messenger.File{
 		Name: randomFile.Name(),
 		Reader: videoFile,
-		//Size: -1, // Let the tgbotapi package determine the size
-	  })
+	  }
 	
 	  // Send the video message
-	  _, err = c.bot.Send(videoMsg)
+	  err = c.bot.SendVideo(chatID, videoMsg)
 	  if err != nil {
 		log.Println("Could not send video message:", err)
 	  }
 
 }
 
-func sendImage(bot *tgbotapi.BotAPI, chatID int64, path string) {
+// sendImage downloads generated image with client and sends it to the chat
+func sendImage(bot messenger.Messenger, chatID int64, path string, auth string, client *http.Client) error {
 
-	auth := os.Getenv("OPENAI_API_KEY")
-
-	fileName, err := getImage(path, auth)
+	fileName, err := getImage(path, auth, client)
 	if err != nil {
-		fmt.Errorf("getImageFail: %w", err)
+		return fmt.Errorf("getImageFail: %w", err)
 	}
 	filePath := filepath.Join("tmp", "generated", "images", fileName)
+	defer DeleteFile(filePath)
 	photoBytes, err := os.ReadFile(filePath)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	photoFile := messenger.File{
+		Name:   "picture",
+		Reader: bytes.NewReader(photoBytes),
 	}
-	photoFileBytes := tgbotapi.FileBytes{
-		Name:  "picture",
-		Bytes: photoBytes,
+	if err := bot.SendPhoto(chatID, photoFile); err != nil {
+		return fmt.Errorf("could not send image: %w", err)
 	}
-	bot.Send(tgbotapi.NewPhoto(int64(chatID), photoFileBytes))
-	DeleteFile(filePath)
+	return nil
 }
 
-func getImage(imageURL, authHeader string) (string, error) {
-	client := &http.Client{}
+func getImage(imageURL, authHeader string, client *http.Client) (string, error) {
 	req, err := http.NewRequest("GET", imageURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create GET request: %w", err)
@@ -212,6 +205,9 @@ func getImage(imageURL, authHeader string) (string, error) {
 	fileName := transformURL(imageURL)
 
 	dir := filepath.Join("tmp", "generated", "images")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
 	filePath := filepath.Join(dir, fileName)
 	file, err := os.Create(filePath)
 	if err != nil {
@@ -241,27 +237,44 @@ func transformURL(inputURL string) string {
 }
 
 
-// stable diffusion
-func (c *Commander) GenerateNewImageLAI_SD(promt, url string, chatID int64, bot *tgbotapi.BotAPI) {
-	size := "256x256"
-	model := os.Getenv("IMAGE_GENERATION_MODEL")
-	if model == "" {
-		model = "stablediffusion"
+// GenerateNewImageLAI_SD generates image (stable diffusion on LocalAI) with image generation service of the user provider and sends it to the chat
+func (c *Commander) GenerateNewImageLAI_SD(promt string, chatID int64) {
+	if err := c.generateImage(chatID, promt, "256x256"); err != nil {
+		var quotaErr *QuotaError
+		if errors.As(err, &quotaErr) {
+			c.send(chatID, err.Error())
+			return
+		}
+		log.Println(err)
+	}
+}
+
+// ImageSender lets the dialog agent send images to the chat with generate_image tool, quota and usage are counted like for /image
+func (c *Commander) ImageSender(chatID int64) agent.ImageSender {
+	return func(ctx context.Context, prompt, size string) error {
+		return c.generateImage(chatID, prompt, size)
 	}
-	urlSuffix := os.Getenv("IMAGE_GENERATION_SUFFIX")
-	if urlSuffix == "" {
-		urlSuffix = "/v1/images/generations"
+}
+
+// generateImage checks quota of images, generates image and sends it to the chat
+func (c *Commander) generateImage(chatID int64, prompt, size string) error {
+	if err := c.limiter.AllowImage(chatID); err != nil {
+		return err
 	}
-	url += urlSuffix
+	user, _ := c.store.Get(chatID)
+	ai := c.AI(user)
+	service := ai.ImageGeneration
 
-	filepath, err := localai.GenerateImageStableDiffusion(promt, size, url, model)
+	// the image is downloaded with the auth header, so url returned by own provider of the user can't be private either
+	client := langchain.HTTPClient(ai.Endpoint)
+	imageURL, err := localai.GenerateImageStableDiffusion(prompt, size, ai.URL(service), service.Model, ai.APIKey, client)
 	if err != nil {
-		//return nil, err
-		log.Println(err)
+		return fmt.Errorf("generating image: %w", err)
 	}
-	log.Println("url_path: ", filepath)
+	c.recordRequest(chatID, service.Model, db.FeatureImage)
+	log.Println("url_path: ", imageURL)
 
-	sendImage(bot, chatID, filepath)
+	return sendImage(c.bot, chatID, imageURL, ai.APIKey, client)
 }
 
 
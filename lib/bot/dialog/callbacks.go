@@ -0,0 +1,15 @@
+package dialog
+
+import (
+	"github.com/JackBekket/hellper/lib/bot/command"
+)
+
+// registerCallbacks fills commander callback router with inline keyboard handlers
+func registerCallbacks(comm command.Commander) {
+	callbacks := comm.Callbacks()
+
+	callbacks.Handle(command.CallbackModel, comm.HandleModelChoose)
+	callbacks.Handle(command.CallbackAccess, comm.HandleAccessDecision)
+	callbacks.Handle(command.CallbackLanguage, comm.ConnectingToAiWithLanguage)
+	callbacks.Handle(command.CallbackProvider, comm.HandleProviderChoose)
+}
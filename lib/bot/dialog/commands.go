@@ -0,0 +1,247 @@
+package dialog
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commands which need ai session to be set up
+var dialogOnly = []database.DialogStatus{database.StatusDialog}
+
+// registerCommands fills commander registry with bot commands, order of registration is the order in /help
+func registerCommands(bot messenger.Messenger, comm command.Commander) {
+	commands := comm.Commands()
+
+	commands.MustRegister(command.Command{
+		Name:        "start",
+		Description: "start the bot, /start <invite code> if bot is invite-only",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.Start(msg, user)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "help",
+		Description: "print this message",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.HelpCommandMessage(msg)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "restart",
+		Description: "restart session (if you want to switch between local-ai and openai chatGPT)",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			messenger.Say(bot, user.ID, "Restarting session..., type any key")
+			comm.DeleteUser(user.ID)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "image",
+		Description: "generate image",
+		Args:        "[prompt]",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			messenger.Say(bot, user.ID, "Image link generation...")
+			promt := msg.CommandArguments()
+			log.Printf("Command /image arg: %s\n", promt)
+			if promt == "" {
+				promt = "evangelion, neon, anime"
+			}
+			comm.GenerateNewImageLAI_SD(promt, msg.Chat.ID)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "search_doc",
+		Description: "searching documents",
+		Args:        "<query>",
+		States:      dialogOnly,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.SearchDocuments(msg.Chat.ID, msg.CommandArguments(), 3)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "rag",
+		Description: "process Retrival-Augmented Generation",
+		Args:        "<prompt>",
+		States:      dialogOnly,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.RAG(msg.Chat.ID, msg.CommandArguments(), 1)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "instruct",
+		Description: "use system promt template instead of langchain (higher priority, see examples)",
+		Args:        "<prompt>",
+		States:      dialogOnly,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			// this is calling local-ai within base template (and without langhain injections)
+			comm.Instruct(msg.Chat.ID, msg.CommandArguments())
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "usage",
+		Description: "show your usage by model and feature",
+		Args:        "[today|week|all]",
+		States:      dialogOnly,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.GetUsage(msg.Chat.ID, msg.CommandArguments())
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "helper",
+		Description: "send a video with usage examples",
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.SendMediaHelper(msg.Chat.ID)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "provider",
+		Description: "show or switch ai provider, add own endpoint profiles",
+		Args:        "[add <name> <localai|openai> <endpoint|-> [key|-] [model] | remove <name> | use <name>]",
+		States:      []database.DialogStatus{database.StatusAwaitingKey, database.StatusDialog},
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			if strings.HasPrefix(msg.CommandArguments(), "add") {
+				// don't leave the key in chat history
+				bot.Delete(msg.Chat.ID, msg.MessageID)
+			}
+			comm.ManageProviders(msg.Chat.ID, msg.Chat.ID, msg.CommandArguments())
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "setcontext",
+		Description: "use documents collection as context for answers",
+		Args:        "<collection>",
+		States:      dialogOnly,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			name := msg.CommandArguments()
+			log.Println("comnmand set context")
+			log.Println("argument: ", name)
+			log.Println("user:", user)
+			endpoint := comm.AI(user).Endpoint
+			if err := user.SetContext(name, endpoint, comm.Config().Database.URL, langchain.HTTPClient(endpoint)); err == nil {
+				comm.UpdateUser(user.ID, func(u *database.User) {
+					u.VectorStore = user.VectorStore
+				})
+			}
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "clearcontext",
+		Description: "stop using documents collection",
+		States:      dialogOnly,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.UpdateUser(user.ID, func(u *database.User) {
+				u.ClearContext()
+			})
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "apikey",
+		Description: "issue a key for the OpenAI compatible http api",
+		States:      dialogOnly,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.IssueAPIKey(user.ID)
+		},
+	})
+
+	// admin commands, hidden from /help and command menu of other users
+	commands.MustRegister(command.Command{
+		Name:        "users",
+		Description: "list users with their model and dialog status",
+		Permission:  command.PermUsers,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.ListUsers(msg.Chat.ID)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "ban",
+		Description: "ignore messages of the user",
+		Args:        "<chat id>",
+		Permission:  command.PermBan,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.SetBanned(msg.Chat.ID, msg.CommandArguments(), true)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "unban",
+		Description: "allow banned user to use the bot again",
+		Args:        "<chat id>",
+		Permission:  command.PermBan,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.SetBanned(msg.Chat.ID, msg.CommandArguments(), false)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "reset",
+		Description: "reset session of the user",
+		Args:        "<chat id>",
+		Permission:  command.PermReset,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.ResetUser(msg.Chat.ID, msg.CommandArguments())
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "broadcast",
+		Description: "send a message to all users",
+		Args:        "<message>",
+		Permission:  command.PermBroadcast,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			// sending is rate limited, don't block other updates
+			go comm.Broadcast(msg.Chat.ID, msg.CommandArguments())
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "invite",
+		Description: "create invite link, 1 use by default, 0 for unlimited",
+		Args:        "[uses]",
+		Permission:  command.PermApprove,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.CreateInvite(msg.Chat.ID, msg.CommandArguments())
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "stats",
+		Description: "show token usage of all users",
+		Args:        "[today|week|all]",
+		Permission:  command.PermStats,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.Stats(msg.Chat.ID, msg.CommandArguments())
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "provider_for",
+		Description: "manage providers of the user, arguments are the same as of /provider",
+		Args:        "<chat id> [add ... | remove <name> | use <name>]",
+		Permission:  command.PermProviders,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			id, args, _ := strings.Cut(strings.TrimSpace(msg.CommandArguments()), " ")
+			chatID, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				messenger.Say(bot, msg.Chat.ID, "chat id must be a number, e.g. /provider_for 123456789 use default")
+				return
+			}
+			if strings.HasPrefix(strings.TrimSpace(args), "add") {
+				bot.Delete(msg.Chat.ID, msg.MessageID)
+			}
+			comm.ManageProviders(msg.Chat.ID, chatID, args)
+		},
+	})
+	commands.MustRegister(command.Command{
+		Name:        "usage_csv",
+		Description: "export usage of all users as csv",
+		Args:        "[today|week|all]",
+		Permission:  command.PermStats,
+		Handler: func(msg *tgbotapi.Message, user database.User) {
+			comm.ExportUsage(msg.Chat.ID, msg.CommandArguments())
+		},
+	})
+
+	if err := commands.Publish(bot); err != nil {
+		log.Println("could not publish bot commands:", err)
+	}
+}
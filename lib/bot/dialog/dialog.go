@@ -1,18 +1,21 @@
 package dialog
 
 import (
+	"errors"
 	"log"
-	"os"
 	"regexp"
 	"strings"
 
 	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
 	"github.com/JackBekket/hellper/lib/database"
-	"github.com/JackBekket/hellper/lib/langchain"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-func HandleUpdates(updates <-chan tgbotapi.Update, bot *tgbotapi.BotAPI, comm command.Commander) {
+func HandleUpdates(updates <-chan tgbotapi.Update, bot messenger.Messenger, comm command.Commander) {
+	states := newOnboardingStateMachine(comm)
+	registerCommands(bot, comm)
+	registerCallbacks(comm)
 
 	for update := range updates {
 		if update.CallbackQuery == nil {
@@ -21,85 +24,45 @@ func HandleUpdates(updates <-chan tgbotapi.Update, bot *tgbotapi.BotAPI, comm co
 			if update.Message.Chat.ID < 0 {
 				group = true
 			}
-			if group && !strings.Contains(update.Message.Text, bot.Self.UserName) && update.Message.Voice == nil && update.Message.Photo == nil && update.Message.Command() == "" {
+			if group && !strings.Contains(update.Message.Text, bot.BotUsername()) && update.Message.Voice == nil && update.Message.Photo == nil && update.Message.Command() == "" {
 				continue
 			}
 
-			if group && update.Message.Photo != nil && !strings.Contains(update.Message.Caption, bot.Self.UserName) {
+			if group && update.Message.Photo != nil && !strings.Contains(update.Message.Caption, bot.BotUsername()) {
 				continue
 			} else {
-				re := regexp.MustCompile(`@?` + regexp.QuoteMeta(bot.Self.UserName))
+				re := regexp.MustCompile(`@?` + regexp.QuoteMeta(bot.BotUsername()))
 				update.Message.Caption = re.ReplaceAllString(update.Message.Caption, "")
 				update.Message.Caption = strings.TrimSpace(update.Message.Caption)
 			}
 
 			chatID := int64(update.Message.Chat.ID)
-			db := comm.GetUsersDb()
-			user, ok := db[int64(chatID)]
+			user, err := comm.FindUser(chatID)
+			if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+				// unknown user would be created in place of the stored one
+				log.Printf("dropping update of chat %d: %v\n", chatID, err)
+				continue
+			}
+			ok := err == nil
 			if !ok {
-				//comm.CheckAdmin(adminData, update.Message)
-				comm.AddNewUserToMap(update.Message)
+				// admins from config skip key entry
+				comm.CheckAdmin(update.Message)
+			}
+			if ok && user.Banned {
+				log.Printf("ignoring message from banned user %d\n", chatID)
+				continue
 			}
-			ai_endpoint := os.Getenv("AI_ENDPOINT")
-
 			if ok {
 				//chatID = int64(chatID)
 
-				switch update.Message.Command() {
-
-				case "image":
-					msg := tgbotapi.NewMessage(user.ID, "Image link generation...")
-					bot.Send(msg)
-					baseUrl := os.Getenv("AI_ENDPOINT")
-					promt := update.Message.CommandArguments()
-					log.Printf("Command /image arg: %s\n", promt)
-					if promt == "" {
-						comm.GenerateNewImageLAI_SD("evangelion, neon, anime", baseUrl, chatID, bot)
-					} else {
-						comm.GenerateNewImageLAI_SD(promt, baseUrl, chatID, bot)
+				// commands are consumed here and never reach the dialog, unknown commands are ignored
+				if update.Message.IsCommand() {
+					// pending user can only send invite code
+					if user.DialogStatus == database.StatusPending && update.Message.Command() != "start" {
+						comm.PendingResponse(update.Message)
+						continue
 					}
-					//go openaibot.StartImageSequence(c.bot, updateMessage, chatID, promt, c.ctx)
-
-					//TODO: Consider adding continue to all other command options, since Hellper actively tries to answer on commands after their execution x)
-					continue
-				case "restart":
-					msg := tgbotapi.NewMessage(user.ID, "Restarting session..., type any key")
-					bot.Send(msg)
-					userDb := database.UsersMap
-					delete(userDb, user.ID)
-				case "help":
-					comm.HelpCommandMessage(update.Message)
-				case "search_doc":
-					promt := update.Message.CommandArguments()
-					comm.SearchDocuments(chatID, promt, 3)
-				case "rag":
-					promt := update.Message.CommandArguments()
-					comm.RAG(chatID, promt, 1)
-				case "instruct":
-					// this is calling local-ai within base template (and without langhain injections)
-					promt := update.Message.CommandArguments()
-					model_name := user.AiSession.GptModel
-					api_token := user.AiSession.GptKey
-					langchain.GenerateContentInstruction(user.AiSession.Base_url, promt, model_name, api_token, user.Network)
-				case "usage":
-					comm.GetUsage(chatID)
-				case "helper":
-					comm.SendMediaHelper(chatID)
-				case "setContext":
-					name := update.Message.CommandArguments()
-					userDb := database.UsersMap
-					user := userDb[chatID]
-					log.Println("comnmand set context")
-					log.Println("argument: ", name)
-					log.Println("user:", user)
-					user.SetContext(name)
-
-					//continue
-				case "clearContext":
-					user := comm.GetUser(chatID)
-					user.ClearContext()
-				case "":
-				default:
+					comm.Commands().Dispatch(bot, update.Message, user)
 					continue
 				}
 
@@ -119,29 +82,16 @@ func HandleUpdates(updates <-chan tgbotapi.Update, bot *tgbotapi.BotAPI, comm co
 					log.Println(user.ID)
 					log.Println(user.Username)
 
-					if group && update.Message.Voice != nil && user.DialogStatus != 6 {
+					if group && update.Message.Voice != nil && user.DialogStatus != database.StatusDialog {
 						continue
 					}
 					if update.Message.Text != "" {
-						re := regexp.MustCompile(`@?` + regexp.QuoteMeta(bot.Self.UserName))
+						re := regexp.MustCompile(`@?` + regexp.QuoteMeta(bot.BotUsername()))
 						update.Message.Text = re.ReplaceAllString(update.Message.Text, "")
 					}
-					switch user.DialogStatus {
-					// first check for user status, (for a new user status 0 is set automatically),
-					// then user reply for the first bot message is logged to a database as name AND user status is updated
-					case 0:
-						fallthrough
-					case 1:
-						fallthrough
-					case 2:
-						comm.InputYourAPIKey(update.Message)
-					case 3:
-						comm.ChooseModel(update.Message, ai_endpoint)
-					case 4, 5:
-						comm.WrongResponse(update.Message)
-					case 6:
-						comm.DialogSequence(update.Message, ai_endpoint)
-
+					// first check for user status, then route message to the handler of this onboarding/dialog step
+					if err := states.HandleMessage(user.DialogStatus, update.Message); err != nil {
+						log.Println(err)
 					}
 
 				}
@@ -150,17 +100,17 @@ func HandleUpdates(updates <-chan tgbotapi.Update, bot *tgbotapi.BotAPI, comm co
 
 		} else {
 			//here goes the callback logic for inlines
-			chatID := int64(update.CallbackQuery.Message.Chat.ID)
-			db := comm.GetUsersDb()
-			user := db[int64(chatID)]
-			ai_endpoint := os.Getenv("AI_ENDPOINT")
-
-			switch user.DialogStatus {
-			case 4:
-				comm.HandleModelChoose(update.CallbackQuery)
-			case 5:
-				comm.ConnectingToAiWithLanguage(update.CallbackQuery, ai_endpoint)
+			if update.CallbackQuery.Message != nil {
+				user, err := comm.FindUser(update.CallbackQuery.Message.Chat.ID)
+				if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+					log.Printf("dropping callback of chat %d: %v\n", update.CallbackQuery.Message.Chat.ID, err)
+					continue
+				}
+				if err == nil && user.Banned {
+					continue
+				}
 			}
+			comm.Callbacks().Route(bot, update.CallbackQuery)
 		}
 	} // end of main func
 }
@@ -0,0 +1,51 @@
+package dialog
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	"github.com/JackBekket/hellper/lib/database"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// brokenStore fails to read users like postgres does when connection is lost
+type brokenStore struct {
+	*database.MemoryStore
+}
+
+func (brokenStore) Find(id int64) (database.User, error) {
+	return database.User{}, errors.New("conn closed")
+}
+
+func (brokenStore) Get(id int64) (database.User, bool) {
+	return database.User{}, false
+}
+
+func TestUpdateIsDroppedWhenUserCantBeRead(t *testing.T) {
+	store := brokenStore{database.NewMemoryStore()}
+	key := database.AiSession{GptKey: "key", OwnKey: "key", GptModel: "llama"}
+	store.Save(database.User{ID: 1, Username: "alice", DialogStatus: database.StatusDialog, AiSession: key})
+
+	fake := messenger.NewFake("hellper_bot")
+	comm := command.NewCommander(fake, store, context.Background(), config.Default())
+	updates := make(chan tgbotapi.Update, 1)
+	updates <- tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 1, Type: "private"},
+		From: &tgbotapi.User{ID: 1, UserName: "alice"},
+		Text: "hello",
+	}}
+	close(updates)
+	HandleUpdates(updates, fake, *comm)
+
+	user, _ := store.MemoryStore.Get(1)
+	if user.DialogStatus != database.StatusDialog || user.AiSession.GptKey != "key" {
+		t.Errorf("stored user must be kept, got %+v", user)
+	}
+	if messages := fake.Messages(1); len(messages) != 0 {
+		t.Errorf("update must be dropped, got %+v", messages)
+	}
+}
@@ -0,0 +1,64 @@
+package dialog
+
+import (
+	"fmt"
+
+	"github.com/JackBekket/hellper/lib/bot/command"
+	"github.com/JackBekket/hellper/lib/database"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// StateHandlers process messages of users who are in a particular dialog status.
+// Nil handler means messages are not expected in the status.
+// Inline buttons are routed by command.CallbackRouter, see callbacks.go
+type StateHandlers struct {
+	OnMessage func(msg *tgbotapi.Message)
+}
+
+// StateMachine dispatches updates by user dialog status.
+// Transitions between statuses are declared in database package, handlers change status through Commander.ChangeDialogStatus.
+type StateMachine struct {
+	states map[database.DialogStatus]StateHandlers
+}
+
+func NewStateMachine() *StateMachine {
+	return &StateMachine{
+		states: make(map[database.DialogStatus]StateHandlers),
+	}
+}
+
+// On registers handlers for the status, registering the same status twice replaces handlers.
+func (m *StateMachine) On(status database.DialogStatus, handlers StateHandlers) {
+	m.states[status] = handlers
+}
+
+// HandleMessage runs message handler of the status, returns error if status doesn't expect messages.
+func (m *StateMachine) HandleMessage(status database.DialogStatus, msg *tgbotapi.Message) error {
+	handlers := m.states[status]
+	if handlers.OnMessage == nil {
+		return fmt.Errorf("no message handler for dialog status %s", status)
+	}
+	handlers.OnMessage(msg)
+	return nil
+}
+
+// newOnboardingStateMachine describes onboarding and dialog steps of the bot
+func newOnboardingStateMachine(comm command.Commander) *StateMachine {
+	m := NewStateMachine()
+
+	// for a new user status is set automatically, then user reply to the first bot message leads to key request
+	askKey := StateHandlers{OnMessage: comm.InputYourAPIKey}
+	m.On(database.StatusNew, askKey)
+	m.On(database.StatusStarted, askKey)
+	m.On(database.StatusAuthorized, askKey)
+
+	// provider buttons are handled by registerCallbacks, typed text is a key
+	m.On(database.StatusAwaitingKey, StateHandlers{OnMessage: comm.ChooseModel})
+	// waiting for admin approval or invite, see command.AddNewUserToMap
+	m.On(database.StatusPending, StateHandlers{OnMessage: comm.PendingResponse})
+	// waiting for inline buttons, see registerCallbacks
+	m.On(database.StatusAwaitingModel, StateHandlers{OnMessage: comm.WrongResponse})
+	m.On(database.StatusAwaitingLanguage, StateHandlers{OnMessage: comm.WrongResponse})
+	m.On(database.StatusDialog, StateHandlers{OnMessage: comm.DialogSequence})
+	return m
+}
@@ -0,0 +1,189 @@
+package messenger
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// FakeMessage is a message recorded by Fake, edits change Text in place.
+type FakeMessage struct {
+	ID        int
+	ChatID    int64
+	Text      string
+	ParseMode ParseMode
+	Keyboard  *Keyboard
+	// Kind is "text", "photo", "video" or "document"
+	Kind    string
+	File    []byte
+	Deleted bool
+}
+
+// Fake is in-memory Messenger for tests and for non-telegram frontends.
+type Fake struct {
+	Username string
+	// Files served by DownloadFile, by file id
+	Files map[string][]byte
+	// FailMarkdown makes markdown messages fail like broken markdown does in telegram
+	FailMarkdown bool
+	// OnSend is called for every new message, e.g. to print it in terminal
+	OnSend func(msg FakeMessage)
+
+	mu       sync.Mutex
+	messages []*FakeMessage
+	answers  map[string]string
+	commands []BotCommand
+}
+
+func NewFake(username string) *Fake {
+	return &Fake{
+		Username: username,
+		Files:    make(map[string][]byte),
+		answers:  make(map[string]string),
+	}
+}
+
+func (f *Fake) add(msg *FakeMessage) (int, error) {
+	if f.FailMarkdown && msg.ParseMode == ModeMarkdown {
+		return 0, fmt.Errorf("can't parse entities")
+	}
+	f.mu.Lock()
+	msg.ID = len(f.messages) + 1
+	f.messages = append(f.messages, msg)
+	onSend := f.OnSend
+	f.mu.Unlock()
+
+	if onSend != nil {
+		onSend(*msg)
+	}
+	return msg.ID, nil
+}
+
+func (f *Fake) SendText(msg Text) (int, error) {
+	return f.add(&FakeMessage{
+		ChatID:    msg.ChatID,
+		Text:      msg.Text,
+		ParseMode: msg.ParseMode,
+		Keyboard:  msg.Keyboard,
+		Kind:      "text",
+	})
+}
+
+func (f *Fake) find(chatID int64, messageID int) (*FakeMessage, error) {
+	if messageID < 1 || messageID > len(f.messages) || f.messages[messageID-1].ChatID != chatID {
+		return nil, fmt.Errorf("message %d not found in chat %d", messageID, chatID)
+	}
+	msg := f.messages[messageID-1]
+	if msg.Deleted {
+		return nil, fmt.Errorf("message %d is deleted", messageID)
+	}
+	return msg, nil
+}
+
+func (f *Fake) EditText(chatID int64, messageID int, text string, mode ParseMode) error {
+	if f.FailMarkdown && mode == ModeMarkdown {
+		return fmt.Errorf("can't parse entities")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg, err := f.find(chatID, messageID)
+	if err != nil {
+		return err
+	}
+	msg.Text = text
+	msg.ParseMode = mode
+	return nil
+}
+
+func (f *Fake) Delete(chatID int64, messageID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg, err := f.find(chatID, messageID)
+	if err != nil {
+		return err
+	}
+	msg.Deleted = true
+	return nil
+}
+
+func (f *Fake) sendFile(kind string, chatID int64, file File) error {
+	content, err := io.ReadAll(file.Reader)
+	if err != nil {
+		return err
+	}
+	_, err = f.add(&FakeMessage{
+		ChatID: chatID,
+		Text:   file.Caption,
+		Kind:   kind,
+		File:   content,
+	})
+	return err
+}
+
+func (f *Fake) SendPhoto(chatID int64, file File) error {
+	return f.sendFile("photo", chatID, file)
+}
+
+func (f *Fake) SendVideo(chatID int64, file File) error {
+	return f.sendFile("video", chatID, file)
+}
+
+func (f *Fake) SendDocument(chatID int64, file File) error {
+	return f.sendFile("document", chatID, file)
+}
+
+func (f *Fake) DownloadFile(fileID string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	content, ok := f.Files[fileID]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", fileID)
+	}
+	return content, nil
+}
+
+func (f *Fake) AnswerCallback(callbackID string, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.answers[callbackID] = text
+	return nil
+}
+
+func (f *Fake) SetCommands(commands []BotCommand) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append([]BotCommand(nil), commands...)
+	return nil
+}
+
+func (f *Fake) BotUsername() string {
+	return f.Username
+}
+
+// Messages returns copies of not deleted messages sent to the chat
+func (f *Fake) Messages(chatID int64) []FakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	messages := []FakeMessage{}
+	for _, msg := range f.messages {
+		if msg.ChatID == chatID && !msg.Deleted {
+			messages = append(messages, *msg)
+		}
+	}
+	return messages
+}
+
+// Answer returns text of callback answer, ok is false if callback was not answered
+func (f *Fake) Answer(callbackID string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	text, ok := f.answers[callbackID]
+	return text, ok
+}
+
+// Commands returns commands set by SetCommands
+func (f *Fake) Commands() []BotCommand {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]BotCommand(nil), f.commands...)
+}
@@ -0,0 +1,89 @@
+// Package messenger hides chat transport (telegram) behind a small interface,
+// so dialog logic can be tested with Fake or reused with another frontend.
+package messenger
+
+import (
+	"io"
+	"log"
+)
+
+type ParseMode string
+
+const (
+	ModePlain    ParseMode = ""
+	ModeMarkdown ParseMode = "Markdown"
+)
+
+// Button of a keyboard. Inline buttons send Data as callback query, reply buttons send Text as a message.
+type Button struct {
+	Text string
+	Data string
+}
+
+type Keyboard struct {
+	Rows [][]Button
+	// Inline keyboard is attached to the message, otherwise it's a one time reply keyboard
+	Inline bool
+}
+
+// InlineKeyboard creates keyboard attached to the message
+func InlineKeyboard(rows ...[]Button) *Keyboard {
+	return &Keyboard{Rows: rows, Inline: true}
+}
+
+// ReplyKeyboard creates one time keyboard which replaces user's keyboard
+func ReplyKeyboard(rows ...[]Button) *Keyboard {
+	return &Keyboard{Rows: rows}
+}
+
+func Row(buttons ...Button) []Button {
+	return buttons
+}
+
+// Text is an outgoing text message
+type Text struct {
+	ChatID    int64
+	Text      string
+	ParseMode ParseMode
+	Keyboard  *Keyboard
+}
+
+// File is an outgoing photo, video or document
+type File struct {
+	Name   string
+	Reader io.Reader
+	// Caption is optional text under the file
+	Caption string
+}
+
+// BotCommand is an entry of commands menu shown by clients
+type BotCommand struct {
+	Command     string
+	Description string
+}
+
+// Messenger sends messages to chats and reads files sent by users.
+// Incoming updates are still telegram structures, transports other than telegram have to convert their events.
+type Messenger interface {
+	// SendText sends message and returns its id, which can be used for EditText and Delete
+	SendText(msg Text) (int, error)
+	EditText(chatID int64, messageID int, text string, mode ParseMode) error
+	Delete(chatID int64, messageID int) error
+	SendPhoto(chatID int64, file File) error
+	SendVideo(chatID int64, file File) error
+	SendDocument(chatID int64, file File) error
+	// DownloadFile returns content of a file sent by user
+	DownloadFile(fileID string) ([]byte, error)
+	// AnswerCallback acknowledges inline button press, text is shown as a notification if not empty
+	AnswerCallback(callbackID string, text string) error
+	SetCommands(commands []BotCommand) error
+	// BotUsername returns username of the bot without '@'
+	BotUsername() string
+}
+
+// Say sends plain text and logs error, for messages which can be lost without consequences.
+func Say(m Messenger, chatID int64, text string) {
+	if _, err := m.SendText(Text{ChatID: chatID, Text: text}); err != nil {
+		log.Println("could not send message:", err)
+	}
+}
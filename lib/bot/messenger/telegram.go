@@ -0,0 +1,131 @@
+package messenger
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram is Messenger backed by telegram bot api
+type Telegram struct {
+	bot *tgbotapi.BotAPI
+}
+
+func NewTelegram(bot *tgbotapi.BotAPI) *Telegram {
+	return &Telegram{bot: bot}
+}
+
+// Bot returns underlying bot api, e.g. to receive updates
+func (t *Telegram) Bot() *tgbotapi.BotAPI {
+	return t.bot
+}
+
+func (t *Telegram) SendText(msg Text) (int, error) {
+	m := tgbotapi.NewMessage(msg.ChatID, msg.Text)
+	m.ParseMode = string(msg.ParseMode)
+	if msg.Keyboard != nil {
+		m.ReplyMarkup = telegramKeyboard(msg.Keyboard)
+	}
+	sent, err := t.bot.Send(m)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+func telegramKeyboard(k *Keyboard) interface{} {
+	if k.Inline {
+		rows := [][]tgbotapi.InlineKeyboardButton{}
+		for _, row := range k.Rows {
+			buttons := []tgbotapi.InlineKeyboardButton{}
+			for _, b := range row {
+				buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(b.Text, b.Data))
+			}
+			rows = append(rows, buttons)
+		}
+		return tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	rows := [][]tgbotapi.KeyboardButton{}
+	for _, row := range k.Rows {
+		buttons := []tgbotapi.KeyboardButton{}
+		for _, b := range row {
+			buttons = append(buttons, tgbotapi.NewKeyboardButton(b.Text))
+		}
+		rows = append(rows, buttons)
+	}
+	return tgbotapi.NewOneTimeReplyKeyboard(rows...)
+}
+
+func (t *Telegram) EditText(chatID int64, messageID int, text string, mode ParseMode) error {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ParseMode = string(mode)
+	_, err := t.bot.Send(edit)
+	return err
+}
+
+func (t *Telegram) Delete(chatID int64, messageID int) error {
+	// deleteMessage returns bool, so Request is used instead of Send
+	_, err := t.bot.Request(tgbotapi.NewDeleteMessage(chatID, messageID))
+	return err
+}
+
+func (t *Telegram) SendPhoto(chatID int64, file File) error {
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileReader{Name: file.Name, Reader: file.Reader})
+	photo.Caption = file.Caption
+	_, err := t.bot.Send(photo)
+	return err
+}
+
+func (t *Telegram) SendVideo(chatID int64, file File) error {
+	video := tgbotapi.NewVideo(chatID, tgbotapi.FileReader{Name: file.Name, Reader: file.Reader})
+	video.Caption = file.Caption
+	_, err := t.bot.Send(video)
+	return err
+}
+
+func (t *Telegram) SendDocument(chatID int64, file File) error {
+	document := tgbotapi.NewDocument(chatID, tgbotapi.FileReader{Name: file.Name, Reader: file.Reader})
+	document.Caption = file.Caption
+	_, err := t.bot.Send(document)
+	return err
+}
+
+func (t *Telegram) DownloadFile(fileID string) ([]byte, error) {
+	// Telegram serves files via the URL like https://api.telegram.org/file/bot<token>/<path>
+	fileURL, err := t.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get file info: %w", err)
+	}
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not download file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not download file, status code: %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (t *Telegram) AnswerCallback(callbackID string, text string) error {
+	_, err := t.bot.Request(tgbotapi.NewCallback(callbackID, text))
+	return err
+}
+
+func (t *Telegram) SetCommands(commands []BotCommand) error {
+	botCommands := []tgbotapi.BotCommand{}
+	for _, cmd := range commands {
+		botCommands = append(botCommands, tgbotapi.BotCommand{
+			Command:     cmd.Command,
+			Description: cmd.Description,
+		})
+	}
+	_, err := t.bot.Request(tgbotapi.NewSetMyCommands(botCommands...))
+	return err
+}
+
+func (t *Telegram) BotUsername() string {
+	return t.bot.Self.UserName
+}
@@ -0,0 +1,100 @@
+package messenger
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegram sends secret token of the webhook in this header
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+type WebhookConfig struct {
+	// URL is public https url of the webhook, its path is served by WebhookHandler
+	URL string
+	// Secret is checked in every request, so nobody except telegram can push updates
+	Secret string
+	// CertFile is a self-signed certificate uploaded to telegram, leave empty behind reverse proxy with a valid certificate
+	CertFile string
+}
+
+// Path returns path of webhook url, handler should be registered on it
+func (cfg WebhookConfig) Path() (string, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("webhook url must be https, got %q", cfg.URL)
+	}
+	if u.Path == "" {
+		return "/", nil
+	}
+	return u.Path, nil
+}
+
+// SetWebhook tells telegram to send updates to the webhook instead of long polling.
+// telegram-bot-api v5.5.1 doesn't know about secret_token, so request is made directly.
+func (t *Telegram) SetWebhook(cfg WebhookConfig) error {
+	params := tgbotapi.Params{}
+	params["url"] = cfg.URL
+	params.AddNonEmpty("secret_token", cfg.Secret)
+
+	var resp *tgbotapi.APIResponse
+	var err error
+	if cfg.CertFile != "" {
+		resp, err = t.bot.UploadFiles("setWebhook", params, []tgbotapi.RequestFile{{
+			Name: "certificate",
+			Data: tgbotapi.FilePath(cfg.CertFile),
+		}})
+	} else {
+		resp, err = t.bot.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return fmt.Errorf("setWebhook: %w", err)
+	}
+	if !resp.Ok {
+		return fmt.Errorf("setWebhook: %s", resp.Description)
+	}
+	return nil
+}
+
+// DeleteWebhook switches bot back to long polling, getUpdates doesn't work while webhook is set.
+// Pending updates are kept.
+func (t *Telegram) DeleteWebhook() error {
+	_, err := t.bot.Request(tgbotapi.DeleteWebhookConfig{})
+	return err
+}
+
+// WebhookHandler receives updates from telegram and puts them into the channel.
+// Response is sent after the update is taken from the channel, so telegram retries updates lost on crash.
+func WebhookHandler(secret string, updates chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		got := r.Header.Get(webhookSecretHeader)
+		if secret != "" && subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			log.Println("webhook: request with wrong secret token from", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		var update tgbotapi.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+		select {
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			// telegram gave up waiting, it will send the update again
+		}
+	})
+}
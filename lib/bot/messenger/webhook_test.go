@@ -0,0 +1,47 @@
+package messenger_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestWebhookHandlerChecksSecret(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	handler := messenger.WebhookHandler("s3cret", updates)
+	body := `{"update_id":7,"message":{"message_id":1,"chat":{"id":42},"text":"hi"}}`
+
+	req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(body))
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", "wrong")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || len(updates) != 0 {
+		t.Fatalf("request with wrong secret: status %d, %d updates", rec.Code, len(updates))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(body))
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", "s3cret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	update := <-updates
+	if update.UpdateID != 7 || update.Message.Text != "hi" {
+		t.Fatalf("unexpected update %+v", update)
+	}
+}
+
+func TestWebhookConfigPath(t *testing.T) {
+	path, err := messenger.WebhookConfig{URL: "https://bot.example.com/telegram/webhook"}.Path()
+	if err != nil || path != "/telegram/webhook" {
+		t.Fatalf("unexpected path %q, err %v", path, err)
+	}
+	if _, err := (messenger.WebhookConfig{URL: "http://bot.example.com/hook"}).Path(); err == nil {
+		t.Fatal("plain http webhook url should be rejected")
+	}
+}
@@ -0,0 +1,580 @@
+// Package config loads settings of the bot once at startup.
+//
+// Settings are read from optional YAML file (-config flag or CONFIG_FILE) and then from environment
+// (.env is loaded too), so env variables override the file. See config.example.yaml and .envExample.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Telegram Telegram `yaml:"telegram"`
+	AI       AI       `yaml:"ai"`
+	Database Database `yaml:"database"`
+	HTTP     HTTP     `yaml:"http"`
+	Admins   Admins   `yaml:"admins"`
+	Access   Access   `yaml:"access"`
+	Quotas   Quotas   `yaml:"quotas"`
+	Search   Search   `yaml:"search"`
+	Fetch    Fetch    `yaml:"fetch"`
+}
+
+type Telegram struct {
+	Token string `yaml:"token"`
+	// UpdatesMode is "polling" or "webhook"
+	UpdatesMode   string `yaml:"updates_mode"`
+	WebhookURL    string `yaml:"webhook_url"`
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+type AI struct {
+	// Endpoint is LocalAI (or any OpenAI compatible) url, empty means openai
+	Endpoint string `yaml:"endpoint"`
+	// APIKey is the key of the bot itself, used for images, transcription and document search
+	APIKey string `yaml:"api_key"`
+	// GenerationWorkers is how many generations LocalAI node serves at once, others wait in queue
+	GenerationWorkers int `yaml:"generation_workers"`
+	// AgentMaxIterations is how many rounds of tool calls the agent can make before it has to answer
+	AgentMaxIterations int `yaml:"agent_max_iterations"`
+
+	ImageGeneration  Service `yaml:"image_generation"`
+	ImageRecognition Service `yaml:"image_recognition"`
+	VoiceRecognition Service `yaml:"voice_recognition"`
+
+	// Providers are shared endpoint profiles users can pick during onboarding or with /provider
+	Providers []Provider `yaml:"providers"`
+
+	// Failover lists endpoints which serve the same models as Endpoint, dialogs move to them while Endpoint is down
+	Failover Failover `yaml:"failover"`
+	// AllowPrivateProviders allows own providers of users on loopback and private network addresses,
+	// they are refused otherwise so users can't reach services next to the bot. Endpoints from config are always allowed.
+	AllowPrivateProviders bool `yaml:"allow_private_providers"`
+}
+
+// Failover is a pool of LocalAI endpoints, the first one is AI.Endpoint
+type Failover struct {
+	// Endpoints are tried in order after AI.Endpoint
+	Endpoints []string `yaml:"endpoints"`
+	// Retries is how many times a failed generation is repeated, every retry goes to the next endpoint serving the model
+	Retries int `yaml:"retries"`
+	// Backoff is delay before the first retry, it doubles with every next one
+	Backoff time.Duration `yaml:"backoff"`
+	// HealthInterval is how often /v1/models of every endpoint is checked
+	HealthInterval time.Duration `yaml:"health_interval"`
+}
+
+// Provider is a named endpoint profile, the same as database.Provider
+type Provider struct {
+	Name string `yaml:"name"`
+	// Type is localai or openai
+	Type string `yaml:"type"`
+	// Endpoint is empty for openai
+	Endpoint string `yaml:"endpoint"`
+	// Key is used instead of the key of the user, user is asked for a key if empty
+	Key string `yaml:"key"`
+	// Model is chosen right away, user picks a model from the menu if empty
+	Model string `yaml:"model"`
+}
+
+// OpenAI returns settings of openai api, they are used for users who switched to openai provider
+func OpenAI(key string) AI {
+	return AI{
+		Endpoint:         "https://api.openai.com",
+		APIKey:           key,
+		ImageGeneration:  Service{Model: "dall-e-2", Suffix: "/v1/images/generations"},
+		ImageRecognition: Service{Model: "gpt-4o-mini", Suffix: "/v1/chat/completions"},
+		VoiceRecognition: Service{Model: "whisper-1", Suffix: "/v1/audio/transcriptions"},
+	}
+}
+
+// DefaultProvider is name of the profile made of ai settings
+const DefaultProvider = "default"
+
+// Service is a model served on its own path of the endpoint
+type Service struct {
+	Model  string `yaml:"model"`
+	Suffix string `yaml:"suffix"`
+}
+
+// URL returns full url of the service
+func (a AI) URL(s Service) string {
+	return a.Endpoint + s.Suffix
+}
+
+type Database struct {
+	// URL is postgres with pgvector, it keeps users and embeddings. Users are kept in memory if empty.
+	URL string `yaml:"url"`
+	// DocumentsURL is a database searched by /search_doc, URL is used if empty
+	DocumentsURL string `yaml:"documents_url"`
+}
+
+type HTTP struct {
+	Addr string `yaml:"addr"`
+	// set both to serve https without reverse proxy
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+}
+
+// access modes
+const (
+	// anyone can use the bot
+	AccessOpen = "open"
+	// chats from the allowlist and users with invite pass, others wait for admin approval
+	AccessAllowlist = "allowlist"
+	// only users with invite pass, others are asked for an invite
+	AccessInvite = "invite"
+)
+
+type Access struct {
+	Mode      string  `yaml:"mode"`
+	Allowlist []int64 `yaml:"allowlist"`
+}
+
+// Quota limits usage of one chat, 0 means unlimited. Days are counted in UTC.
+type Quota struct {
+	TokensPerDay      int `yaml:"tokens_per_day"`
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	ImagesPerDay      int `yaml:"images_per_day"`
+}
+
+type Quotas struct {
+	// Default is quota of users who are not admins
+	Default Quota `yaml:"default"`
+	// Roles are quotas of admins by role, admins without quota of their role are not limited
+	Roles map[string]Quota `yaml:"roles"`
+	// Users override default and role quota of single chats
+	Users map[int64]Quota `yaml:"users"`
+}
+
+// For returns quota of the chat, role is empty for users who are not admins
+func (q Quotas) For(chatID int64, role string) Quota {
+	if quota, ok := q.Users[chatID]; ok {
+		return quota
+	}
+	if role == "" {
+		return q.Default
+	}
+	return q.Roles[role]
+}
+
+// Search is web search backend of the agent
+type Search struct {
+	// Provider is duckduckgo (default), searxng or off
+	Provider string `yaml:"provider"`
+	// SearxNGURL is url of SearxNG instance with json format enabled
+	SearxNGURL string `yaml:"searxng_url"`
+	// Results is how many results of a search are given to the model
+	Results int `yaml:"results"`
+}
+
+// Fetch limits fetch_url tool of the agent
+type Fetch struct {
+	// MaxBytes is the largest page or file downloaded
+	MaxBytes int `yaml:"max_bytes"`
+	// MaxChars is how much text of a page the model reads at once, longer pages are summarized in parts
+	MaxChars int `yaml:"max_chars"`
+	// AllowPrivate allows urls of loopback and private network addresses, e.g. services next to the bot
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+// roles of admins, permissions of each role are defined by command package
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+var roles = []string{RoleAdmin, RoleModerator}
+
+type Admins struct {
+	// Key is given to admins without own key instead of asking for it, AI.APIKey is used if empty
+	Key  string  `yaml:"key"`
+	List []Admin `yaml:"list"`
+}
+
+type Admin struct {
+	// ID is telegram chat id
+	ID int64 `yaml:"id"`
+	// Role is admin (default) or moderator
+	Role string `yaml:"role"`
+	Key  string `yaml:"key"`
+}
+
+// Default returns config with defaults for everything that has one
+func Default() *Config {
+	return &Config{
+		Telegram: Telegram{UpdatesMode: "polling"},
+		Access:   Access{Mode: AccessOpen},
+		AI: AI{
+			GenerationWorkers:  2,
+			AgentMaxIterations: 5,
+			Failover:           Failover{Retries: 2, Backoff: time.Second, HealthInterval: 30 * time.Second},
+			ImageGeneration:    Service{Model: "stablediffusion", Suffix: "/v1/images/generations"},
+			ImageRecognition:   Service{Model: "bunny-llama-3-8b-v", Suffix: "/v1/chat/completions"},
+			VoiceRecognition:   Service{Model: "whisper-1", Suffix: "/v1/audio/transcriptions"},
+		},
+		HTTP:   HTTP{Addr: ":8085"},
+		Search: Search{Provider: "duckduckgo", Results: 3},
+		Fetch:  Fetch{MaxBytes: 5 << 20, MaxChars: 12000},
+	}
+}
+
+// Load reads config file at path (CONFIG_FILE if path is empty, no file if both are empty),
+// applies env variables on top of it and validates the result.
+func Load(path string) (*Config, error) {
+	_ = godotenv.Load()
+
+	cfg := Default()
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides settings with env variables which are set
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	vars := map[string]*string{
+		"TG_KEY":                   &c.Telegram.Token,
+		"UPDATES_MODE":             &c.Telegram.UpdatesMode,
+		"WEBHOOK_URL":              &c.Telegram.WebhookURL,
+		"WEBHOOK_SECRET":           &c.Telegram.WebhookSecret,
+		"AI_ENDPOINT":              &c.AI.Endpoint,
+		"OPENAI_API_KEY":           &c.AI.APIKey,
+		"IMAGE_GENERATION_MODEL":   &c.AI.ImageGeneration.Model,
+		"IMAGE_GENERATION_SUFFIX":  &c.AI.ImageGeneration.Suffix,
+		"IMAGE_RECOGNITION_MODEL":  &c.AI.ImageRecognition.Model,
+		"IMAGE_RECOGNITION_SUFFIX": &c.AI.ImageRecognition.Suffix,
+		"VOICE_RECOGNITION_MODEL":  &c.AI.VoiceRecognition.Model,
+		"VOICE_RECOGNITION_SUFFIX": &c.AI.VoiceRecognition.Suffix,
+		"EMBEDDINGS_DB_URL":        &c.Database.URL,
+		"PG_LINK":                  &c.Database.DocumentsURL,
+		"HTTP_ADDR":                &c.HTTP.Addr,
+		"TLS_CERT_FILE":            &c.HTTP.TLSCertFile,
+		"TLS_KEY_FILE":             &c.HTTP.TLSKeyFile,
+		"ADMIN_KEY":                &c.Admins.Key,
+		"ACCESS_MODE":              &c.Access.Mode,
+		"SEARCH_PROVIDER":          &c.Search.Provider,
+		"SEARXNG_URL":              &c.Search.SearxNGURL,
+	}
+	for name, field := range vars {
+		// empty variables from .envExample mean "not set"
+		if value, ok := lookup(name); ok && value != "" {
+			*field = value
+		}
+	}
+
+	var errs []error
+	if value, ok := lookup("AI_FAILOVER_ENDPOINTS"); ok && value != "" {
+		for _, endpoint := range strings.Split(value, ",") {
+			c.AI.Failover.Endpoints = append(c.AI.Failover.Endpoints, strings.TrimSpace(endpoint))
+		}
+	}
+	if value, ok := lookup("AI_FAILOVER_RETRIES"); ok && value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("AI_FAILOVER_RETRIES must be a number, got %q", value))
+		}
+		c.AI.Failover.Retries = retries
+	}
+	if value, ok := lookup("GENERATION_WORKERS"); ok && value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("GENERATION_WORKERS must be a number, got %q", value))
+		}
+		c.AI.GenerationWorkers = workers
+	}
+	if value, ok := lookup("AGENT_MAX_ITERATIONS"); ok && value != "" {
+		iterations, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("AGENT_MAX_ITERATIONS must be a number, got %q", value))
+		}
+		c.AI.AgentMaxIterations = iterations
+	}
+	// ADMINS=id[:role],... is added to the list from file, ADMIN_ID is kept for old .env files
+	admins := []string{}
+	if value, ok := lookup("ADMIN_ID"); ok && value != "" {
+		admins = append(admins, value)
+	}
+	if value, ok := lookup("ADMINS"); ok && value != "" {
+		admins = append(admins, strings.Split(value, ",")...)
+	}
+	if value, ok := lookup("ACCESS_ALLOWLIST"); ok && value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(entry), 0, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("ACCESS_ALLOWLIST must be telegram chat ids separated by comma, got %q", entry))
+				continue
+			}
+			c.Access.Allowlist = append(c.Access.Allowlist, id)
+		}
+	}
+	if value, ok := lookup("SEARCH_RESULTS"); ok && value != "" {
+		results, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SEARCH_RESULTS must be a number, got %q", value))
+		}
+		c.Search.Results = results
+	}
+	fetch := map[string]*int{
+		"FETCH_MAX_BYTES": &c.Fetch.MaxBytes,
+		"FETCH_MAX_CHARS": &c.Fetch.MaxChars,
+	}
+	for name, field := range fetch {
+		if value, ok := lookup(name); ok && value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number, got %q", name, value))
+				continue
+			}
+			*field = n
+		}
+	}
+	if value, ok := lookup("FETCH_ALLOW_PRIVATE"); ok && value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("FETCH_ALLOW_PRIVATE must be true or false, got %q", value))
+		}
+		c.Fetch.AllowPrivate = allow
+	}
+	if value, ok := lookup("AI_ALLOW_PRIVATE_PROVIDERS"); ok && value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("AI_ALLOW_PRIVATE_PROVIDERS must be true or false, got %q", value))
+		}
+		c.AI.AllowPrivateProviders = allow
+	}
+	quotas := map[string]*int{
+		"QUOTA_TOKENS_PER_DAY":      &c.Quotas.Default.TokensPerDay,
+		"QUOTA_REQUESTS_PER_MINUTE": &c.Quotas.Default.RequestsPerMinute,
+		"QUOTA_IMAGES_PER_DAY":      &c.Quotas.Default.ImagesPerDay,
+	}
+	for name, field := range quotas {
+		if value, ok := lookup(name); ok && value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number, got %q", name, value))
+				continue
+			}
+			*field = n
+		}
+	}
+	for _, entry := range admins {
+		admin, err := parseAdmin(entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.Admins.List = append(c.Admins.List, admin)
+	}
+	return errors.Join(errs...)
+}
+
+// parseAdmin parses "id" or "id:role" from env
+func parseAdmin(entry string) (Admin, error) {
+	id, role, _ := strings.Cut(strings.TrimSpace(entry), ":")
+	admin := Admin{Role: role}
+	var err error
+	admin.ID, err = strconv.ParseInt(id, 0, 64)
+	if err != nil {
+		return admin, fmt.Errorf("ADMINS (ADMIN_ID) must be telegram chat ids like 123:moderator, got %q", entry)
+	}
+	return admin, nil
+}
+
+// Validate checks settings used by every frontend and sets default role of admins, all problems are reported at once
+func (c *Config) Validate() error {
+	var errs []error
+	if c.AI.GenerationWorkers < 1 {
+		errs = append(errs, fmt.Errorf("ai.generation_workers (GENERATION_WORKERS) must be at least 1"))
+	}
+	if c.AI.AgentMaxIterations < 1 {
+		errs = append(errs, fmt.Errorf("ai.agent_max_iterations (AGENT_MAX_ITERATIONS) must be at least 1"))
+	}
+	if c.AI.Endpoint != "" {
+		if u, err := url.Parse(c.AI.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("ai.endpoint (AI_ENDPOINT) must be an url like http://localhost:8080, got %q", c.AI.Endpoint))
+		}
+	}
+	errs = append(errs, c.AI.Failover.validate(c.AI.Endpoint)...)
+	if (c.HTTP.TLSCertFile == "") != (c.HTTP.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("http.tls_cert_file (TLS_CERT_FILE) and http.tls_key_file (TLS_KEY_FILE) must be set together"))
+	}
+	switch c.Access.Mode {
+	case AccessOpen, AccessAllowlist, AccessInvite:
+	default:
+		errs = append(errs, fmt.Errorf("access.mode (ACCESS_MODE) must be open, allowlist or invite, got %q", c.Access.Mode))
+	}
+	seen := map[int64]bool{}
+	for i := range c.Admins.List {
+		admin := &c.Admins.List[i]
+		if admin.Role == "" {
+			admin.Role = RoleAdmin
+		}
+		switch {
+		case admin.ID == 0:
+			errs = append(errs, fmt.Errorf("admins.list[%d]: id is not set", i))
+		case seen[admin.ID]:
+			errs = append(errs, fmt.Errorf("admins.list[%d]: admin %d is listed twice", i, admin.ID))
+		}
+		if !slices.Contains(roles, admin.Role) {
+			errs = append(errs, fmt.Errorf("admins.list[%d]: unknown role %q, use one of %s", i, admin.Role, strings.Join(roles, ", ")))
+		}
+		seen[admin.ID] = true
+	}
+	errs = append(errs, c.Quotas.validate()...)
+	switch c.Search.Provider {
+	case "duckduckgo", "off":
+	case "searxng":
+		if u, err := url.Parse(c.Search.SearxNGURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("search.searxng_url (SEARXNG_URL) must be an url of searxng instance, got %q", c.Search.SearxNGURL))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("search.provider (SEARCH_PROVIDER) must be duckduckgo, searxng or off, got %q", c.Search.Provider))
+	}
+	if c.Search.Results < 1 || c.Search.Results > 10 {
+		errs = append(errs, fmt.Errorf("search.results (SEARCH_RESULTS) must be from 1 to 10"))
+	}
+	if c.Fetch.MaxBytes < 1 {
+		errs = append(errs, fmt.Errorf("fetch.max_bytes (FETCH_MAX_BYTES) must be positive"))
+	}
+	if c.Fetch.MaxChars < 1000 {
+		errs = append(errs, fmt.Errorf("fetch.max_chars (FETCH_MAX_CHARS) must be at least 1000"))
+	}
+	names := map[string]bool{}
+	for i, p := range c.AI.Providers {
+		switch {
+		case p.Name == "" || p.Name == DefaultProvider:
+			errs = append(errs, fmt.Errorf("ai.providers[%d]: name must be set and can't be %q", i, DefaultProvider))
+		case names[p.Name]:
+			errs = append(errs, fmt.Errorf("ai.providers[%d]: provider %q is listed twice", i, p.Name))
+		}
+		names[p.Name] = true
+		switch p.Type {
+		case "localai":
+			if u, err := url.Parse(p.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("ai.providers[%d]: localai endpoint must be an url, got %q", i, p.Endpoint))
+			}
+		case "openai":
+		default:
+			errs = append(errs, fmt.Errorf("ai.providers[%d]: type must be localai or openai, got %q", i, p.Type))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f Failover) validate(endpoint string) []error {
+	var errs []error
+	if len(f.Endpoints) > 0 && endpoint == "" {
+		errs = append(errs, fmt.Errorf("ai.failover.endpoints (AI_FAILOVER_ENDPOINTS) need ai.endpoint, openai has no failover"))
+	}
+	for i, e := range f.Endpoints {
+		if u, err := url.Parse(e); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("ai.failover.endpoints[%d]: must be an url, got %q", i, e))
+		}
+	}
+	if f.Retries < 0 {
+		errs = append(errs, fmt.Errorf("ai.failover.retries (AI_FAILOVER_RETRIES) can't be negative"))
+	}
+	if f.Backoff < 0 {
+		errs = append(errs, fmt.Errorf("ai.failover.backoff can't be negative"))
+	}
+	if f.HealthInterval <= 0 {
+		errs = append(errs, fmt.Errorf("ai.failover.health_interval must be positive, e.g. 30s"))
+	}
+	return errs
+}
+
+func (q Quotas) validate() []error {
+	var errs []error
+	check := func(name string, quota Quota) {
+		if quota.TokensPerDay < 0 || quota.RequestsPerMinute < 0 || quota.ImagesPerDay < 0 {
+			errs = append(errs, fmt.Errorf("%s: limits can't be negative, use 0 for unlimited", name))
+		}
+	}
+	check("quotas.default", q.Default)
+	for role, quota := range q.Roles {
+		if !slices.Contains(roles, role) {
+			errs = append(errs, fmt.Errorf("quotas.roles: unknown role %q, use one of %s", role, strings.Join(roles, ", ")))
+		}
+		check("quotas.roles."+role, quota)
+	}
+	for id, quota := range q.Users {
+		check(fmt.Sprintf("quotas.users.%d", id), quota)
+	}
+	return errs
+}
+
+// webhookSecret is the format of secret_token telegram accepts in setWebhook
+var webhookSecret = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// ValidateTelegram checks settings needed by the bot, cli and tests don't need them
+func (c *Config) ValidateTelegram() error {
+	var errs []error
+	if c.Telegram.Token == "" {
+		errs = append(errs, fmt.Errorf("telegram.token (TG_KEY) is not set"))
+	}
+	switch c.Telegram.UpdatesMode {
+	case "polling":
+	case "webhook":
+		if u, err := url.Parse(c.Telegram.WebhookURL); err != nil || u.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("telegram.webhook_url (WEBHOOK_URL) must be https url, got %q", c.Telegram.WebhookURL))
+		}
+		// without secret anyone who knows the url can post updates as any user
+		if !webhookSecret.MatchString(c.Telegram.WebhookSecret) {
+			errs = append(errs, fmt.Errorf("telegram.webhook_secret (WEBHOOK_SECRET) must be 1-256 characters of A-Z, a-z, 0-9, _ and -"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("telegram.updates_mode (UPDATES_MODE) must be polling or webhook, got %q", c.Telegram.UpdatesMode))
+	}
+	return errors.Join(errs...)
+}
+
+// AdminKey returns key given to admins without own key
+func (c *Config) AdminKey() string {
+	if c.Admins.Key != "" {
+		return c.Admins.Key
+	}
+	return c.AI.APIKey
+}
+
+// KeyOf returns key given to the admin
+func (c *Config) KeyOf(admin Admin) string {
+	if admin.Key != "" {
+		return admin.Key
+	}
+	return c.AdminKey()
+}
+
+// DocumentsURL returns database searched by /search_doc
+func (c *Config) DocumentsURL() string {
+	if c.Database.DocumentsURL != "" {
+		return c.Database.DocumentsURL
+	}
+	return c.Database.URL
+}
@@ -0,0 +1,338 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLoadFileAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hellper.yaml")
+	file := `
+telegram:
+  token: file-token
+ai:
+  endpoint: http://localai:8080
+  generation_workers: 4
+  image_generation:
+    model: sd-file
+database:
+  url: postgresql://file
+`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TG_KEY", "env-token")
+	t.Setenv("OPENAI_API_KEY", "env-key")
+	// empty variable doesn't override the file
+	t.Setenv("EMBEDDINGS_DB_URL", "")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Telegram.Token != "env-token" {
+		t.Errorf("env must override file, token = %q", cfg.Telegram.Token)
+	}
+	if cfg.AI.Endpoint != "http://localai:8080" || cfg.AI.GenerationWorkers != 4 {
+		t.Errorf("file settings are lost: %+v", cfg.AI)
+	}
+	if cfg.AI.ImageGeneration != (Service{Model: "sd-file", Suffix: "/v1/images/generations"}) {
+		t.Errorf("defaults must be kept for settings missing in file, got %+v", cfg.AI.ImageGeneration)
+	}
+	if cfg.AI.URL(cfg.AI.ImageGeneration) != "http://localai:8080/v1/images/generations" {
+		t.Errorf("unexpected service url %q", cfg.AI.URL(cfg.AI.ImageGeneration))
+	}
+	if cfg.Database.URL != "postgresql://file" || cfg.DocumentsURL() != "postgresql://file" {
+		t.Errorf("unexpected database config %+v", cfg.Database)
+	}
+	if cfg.AdminKey() != "env-key" {
+		t.Errorf("admin key must default to api key, got %q", cfg.AdminKey())
+	}
+}
+
+func TestInvalidEnv(t *testing.T) {
+	env := map[string]string{
+		"GENERATION_WORKERS":         "two",
+		"ADMIN_ID":                   "@admin",
+		"AGENT_MAX_ITERATIONS":       "many",
+		"AI_ALLOW_PRIVATE_PROVIDERS": "sure",
+	}
+	err := Default().applyEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for name := range env {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error must mention %s: %v", name, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("defaults must be valid: %v", err)
+	}
+	if err := cfg.ValidateTelegram(); err == nil || !strings.Contains(err.Error(), "TG_KEY") {
+		t.Errorf("missing token must be reported, got %v", err)
+	}
+
+	cfg.AI.Endpoint = "localhost:8080"
+	cfg.HTTP.TLSCertFile = "cert.pem"
+	cfg.AI.AgentMaxIterations = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"AI_ENDPOINT", "TLS_KEY_FILE", "AGENT_MAX_ITERATIONS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error must mention %s: %v", want, err)
+		}
+	}
+
+	cfg = Default()
+	cfg.Telegram.Token = "token"
+	cfg.Telegram.UpdatesMode = "webhook"
+	cfg.Telegram.WebhookURL = "http://example.com/hook"
+	if err := cfg.ValidateTelegram(); err == nil || !strings.Contains(err.Error(), "WEBHOOK_URL") {
+		t.Errorf("plain http webhook must be rejected, got %v", err)
+	}
+
+	cfg.Telegram.WebhookURL = "https://example.com/hook"
+	for secret, valid := range map[string]bool{
+		"":                       false,
+		"has space":              false,
+		"ünicode":                false,
+		strings.Repeat("a", 257): false,
+		"s3cret_-X":              true,
+		strings.Repeat("a", 256): true,
+	} {
+		cfg.Telegram.WebhookSecret = secret
+		err := cfg.ValidateTelegram()
+		if valid && err != nil {
+			t.Errorf("secret %q must be accepted, got %v", secret, err)
+		}
+		if !valid && (err == nil || !strings.Contains(err.Error(), "WEBHOOK_SECRET")) {
+			t.Errorf("secret %q must be rejected, got %v", secret, err)
+		}
+	}
+}
+
+func TestAdmins(t *testing.T) {
+	cfg := Default()
+	cfg.Admins.List = []Admin{{ID: 1, Key: "own"}}
+	env := map[string]string{
+		"ADMIN_ID": "2",
+		"ADMINS":   "3:moderator, 4",
+	}
+	err := cfg.applyEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := []Admin{
+		{ID: 1, Role: RoleAdmin, Key: "own"},
+		{ID: 2, Role: RoleAdmin},
+		{ID: 3, Role: RoleModerator},
+		{ID: 4, Role: RoleAdmin},
+	}
+	if len(cfg.Admins.List) != len(want) {
+		t.Fatalf("unexpected admins %+v", cfg.Admins.List)
+	}
+	for i := range want {
+		if cfg.Admins.List[i] != want[i] {
+			t.Errorf("admin %d = %+v, want %+v", i, cfg.Admins.List[i], want[i])
+		}
+	}
+
+	cfg.Admins.List = append(cfg.Admins.List, Admin{ID: 3}, Admin{ID: 5, Role: "owner"})
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "listed twice") || !strings.Contains(err.Error(), `unknown role "owner"`) {
+		t.Fatalf("expected duplicate and role errors, got %v", err)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	file := `
+quotas:
+  default:
+    tokens_per_day: 1000
+    requests_per_minute: 5
+  roles:
+    moderator:
+      images_per_day: 20
+  users:
+    42:
+      tokens_per_day: 50000
+`
+	cfg := Default()
+	if err := yaml.Unmarshal([]byte(file), cfg); err != nil {
+		t.Fatal(err)
+	}
+	err := cfg.applyEnv(func(name string) (string, bool) {
+		if name == "QUOTA_IMAGES_PER_DAY" {
+			return "3", true
+		}
+		return "", false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		chatID int64
+		role   string
+		want   Quota
+	}{
+		{1, "", Quota{TokensPerDay: 1000, RequestsPerMinute: 5, ImagesPerDay: 3}},
+		{2, RoleModerator, Quota{ImagesPerDay: 20}},
+		// admins without role quota are not limited
+		{3, RoleAdmin, Quota{}},
+		{42, "", Quota{TokensPerDay: 50000}},
+	}
+	for _, c := range cases {
+		if got := cfg.Quotas.For(c.chatID, c.role); got != c.want {
+			t.Errorf("quota of %d (%q) = %+v, want %+v", c.chatID, c.role, got, c.want)
+		}
+	}
+
+	cfg.Quotas.Default.TokensPerDay = -1
+	cfg.Quotas.Roles["owner"] = Quota{}
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "negative") || !strings.Contains(err.Error(), `unknown role "owner"`) {
+		t.Fatalf("expected negative limit and role errors, got %v", err)
+	}
+}
+
+func TestProviders(t *testing.T) {
+	cfg := Default()
+	cfg.AI.Providers = []Provider{
+		{Name: "team", Type: "localai", Endpoint: "http://worker:8080"},
+		{Name: "openai", Type: "openai", Key: "sk-shared"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.AI.Providers = append(cfg.AI.Providers,
+		Provider{Name: "team", Type: "localai", Endpoint: "worker"},
+		Provider{Name: DefaultProvider, Type: "anthropic"},
+	)
+	err := cfg.Validate()
+	for _, want := range []string{"listed twice", "must be an url", `can't be "default"`, "type must be localai or openai"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error must mention %q, got %v", want, err)
+		}
+	}
+
+	cfg = Default()
+	env := map[string]string{"AI_ALLOW_PRIVATE_PROVIDERS": "true"}
+	if err := cfg.applyEnv(func(name string) (string, bool) { v, ok := env[name]; return v, ok }); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.AI.AllowPrivateProviders {
+		t.Error("private providers must be allowed")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	cfg := Default()
+	file := `
+ai:
+  endpoint: http://head:8080
+  failover:
+    endpoints: [http://worker-1:8080]
+    backoff: 250ms
+`
+	if err := yaml.Unmarshal([]byte(file), cfg); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"AI_FAILOVER_ENDPOINTS": "http://worker-2:8080, http://worker-3:8080", "AI_FAILOVER_RETRIES": "3"}
+	if err := cfg.applyEnv(func(name string) (string, bool) { v, ok := env[name]; return v, ok }); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	f := cfg.AI.Failover
+	if len(f.Endpoints) != 3 || f.Endpoints[2] != "http://worker-3:8080" || f.Retries != 3 {
+		t.Errorf("env endpoints must be added to the file ones: %+v", f)
+	}
+	if f.Backoff != 250*time.Millisecond || f.HealthInterval != 30*time.Second {
+		t.Errorf("unexpected durations: %+v", f)
+	}
+
+	cfg.AI.Endpoint = ""
+	cfg.AI.Failover.Endpoints = append(cfg.AI.Failover.Endpoints, "worker")
+	cfg.AI.Failover.HealthInterval = 0
+	err := cfg.Validate()
+	for _, want := range []string{"need ai.endpoint", "must be an url", "health_interval"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error must mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	cfg := Default()
+	env := map[string]string{"SEARCH_PROVIDER": "searxng", "SEARXNG_URL": "http://searxng:8080", "SEARCH_RESULTS": "5"}
+	if err := cfg.applyEnv(func(name string) (string, bool) { v, ok := env[name]; return v, ok }); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Search != (Search{Provider: "searxng", SearxNGURL: "http://searxng:8080", Results: 5}) {
+		t.Errorf("unexpected search %+v", cfg.Search)
+	}
+
+	cfg.Search.SearxNGURL = ""
+	cfg.Search.Results = 0
+	err := cfg.Validate()
+	for _, want := range []string{"SEARXNG_URL", "SEARCH_RESULTS"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error must mention %q, got %v", want, err)
+		}
+	}
+	cfg.Search = Search{Provider: "google", Results: 3}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "search.provider") {
+		t.Errorf("unknown provider must be rejected, got %v", err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	cfg := Default()
+	env := map[string]string{"FETCH_MAX_BYTES": "1048576", "FETCH_MAX_CHARS": "8000", "FETCH_ALLOW_PRIVATE": "true"}
+	if err := cfg.applyEnv(func(name string) (string, bool) { v, ok := env[name]; return v, ok }); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Fetch != (Fetch{MaxBytes: 1 << 20, MaxChars: 8000, AllowPrivate: true}) {
+		t.Errorf("unexpected fetch %+v", cfg.Fetch)
+	}
+
+	env = map[string]string{"FETCH_MAX_CHARS": "many", "FETCH_ALLOW_PRIVATE": "sure"}
+	err := Default().applyEnv(func(name string) (string, bool) { v, ok := env[name]; return v, ok })
+	for _, want := range []string{"FETCH_MAX_CHARS", "FETCH_ALLOW_PRIVATE"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error must mention %q, got %v", want, err)
+		}
+	}
+	cfg.Fetch.MaxChars = 100
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "fetch.max_chars") {
+		t.Errorf("too small max_chars must be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ConversationCodecVersion is written into every encoded conversation.
+// Bump it (and keep decoding of older versions) whenever the encoded layout changes.
+//
+// Version 0 is the legacy text-only array written by the first postgres store.
+const ConversationCodecVersion = 1
+
+// part types of encoded messages
+const (
+	partText         = "text"
+	partImageURL     = "image_url"
+	partBinary       = "binary"
+	partToolCall     = "tool_call"
+	partToolResponse = "tool_response"
+)
+
+type encodedConversation struct {
+	Version  int              `json:"version"`
+	Messages []encodedMessage `json:"messages"`
+}
+
+type encodedMessage struct {
+	Role  string        `json:"role"`
+	Parts []encodedPart `json:"parts"`
+}
+
+type encodedPart struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image_url
+	URL    string `json:"url,omitempty"`
+	Detail string `json:"detail,omitempty"`
+
+	// binary, data is base64 in json
+	MIMEType string `json:"mime_type,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+
+	// tool_call and tool_response
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	ToolType   string           `json:"tool_type,omitempty"`
+	Function   *encodedFunction `json:"function,omitempty"`
+	Name       string           `json:"name,omitempty"`
+	Content    string           `json:"content,omitempty"`
+}
+
+type encodedFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// EncodeConversation serializes conversation buffer with all part types, so it can be stored or sent to another bot instance.
+func EncodeConversation(buffer []llms.MessageContent) ([]byte, error) {
+	conversation := encodedConversation{
+		Version:  ConversationCodecVersion,
+		Messages: make([]encodedMessage, 0, len(buffer)),
+	}
+	for i, msg := range buffer {
+		encoded := encodedMessage{
+			Role:  string(msg.Role),
+			Parts: make([]encodedPart, 0, len(msg.Parts)),
+		}
+		for _, part := range msg.Parts {
+			p, err := encodePart(part)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			encoded.Parts = append(encoded.Parts, p)
+		}
+		conversation.Messages = append(conversation.Messages, encoded)
+	}
+	return json.Marshal(conversation)
+}
+
+// DecodeConversation restores conversation buffer written by EncodeConversation (or by legacy text-only store).
+func DecodeConversation(data []byte) ([]llms.MessageContent, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return []llms.MessageContent{}, nil
+	}
+	if data[0] == '[' {
+		return decodeLegacyThread(data)
+	}
+
+	var conversation encodedConversation
+	if err := json.Unmarshal(data, &conversation); err != nil {
+		return nil, err
+	}
+	if conversation.Version != ConversationCodecVersion {
+		return nil, fmt.Errorf("unsupported conversation version %d", conversation.Version)
+	}
+
+	buffer := make([]llms.MessageContent, 0, len(conversation.Messages))
+	for i, encoded := range conversation.Messages {
+		msg := llms.MessageContent{
+			Role:  llms.ChatMessageType(encoded.Role),
+			Parts: make([]llms.ContentPart, 0, len(encoded.Parts)),
+		}
+		for _, p := range encoded.Parts {
+			part, err := decodePart(p)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %w", i, err)
+			}
+			msg.Parts = append(msg.Parts, part)
+		}
+		buffer = append(buffer, msg)
+	}
+	return buffer, nil
+}
+
+func encodePart(part llms.ContentPart) (encodedPart, error) {
+	switch p := part.(type) {
+	case llms.TextContent:
+		return encodedPart{Type: partText, Text: p.Text}, nil
+	case llms.ImageURLContent:
+		return encodedPart{Type: partImageURL, URL: p.URL, Detail: p.Detail}, nil
+	case llms.BinaryContent:
+		return encodedPart{Type: partBinary, MIMEType: p.MIMEType, Data: p.Data}, nil
+	case llms.ToolCall:
+		encoded := encodedPart{Type: partToolCall, ToolCallID: p.ID, ToolType: p.Type}
+		if p.FunctionCall != nil {
+			encoded.Function = &encodedFunction{
+				Name:      p.FunctionCall.Name,
+				Arguments: p.FunctionCall.Arguments,
+			}
+		}
+		return encoded, nil
+	case llms.ToolCallResponse:
+		return encodedPart{Type: partToolResponse, ToolCallID: p.ToolCallID, Name: p.Name, Content: p.Content}, nil
+	default:
+		return encodedPart{}, fmt.Errorf("unsupported content part %T", part)
+	}
+}
+
+func decodePart(p encodedPart) (llms.ContentPart, error) {
+	switch p.Type {
+	case partText:
+		return llms.TextContent{Text: p.Text}, nil
+	case partImageURL:
+		return llms.ImageURLContent{URL: p.URL, Detail: p.Detail}, nil
+	case partBinary:
+		return llms.BinaryContent{MIMEType: p.MIMEType, Data: p.Data}, nil
+	case partToolCall:
+		toolCall := llms.ToolCall{ID: p.ToolCallID, Type: p.ToolType}
+		if p.Function != nil {
+			toolCall.FunctionCall = &llms.FunctionCall{
+				Name:      p.Function.Name,
+				Arguments: p.Function.Arguments,
+			}
+		}
+		return toolCall, nil
+	case partToolResponse:
+		return llms.ToolCallResponse{ToolCallID: p.ToolCallID, Name: p.Name, Content: p.Content}, nil
+	default:
+		return nil, fmt.Errorf("unknown content part type %q", p.Type)
+	}
+}
+
+// legacyMessage is a version 0 text-only message.
+type legacyMessage struct {
+	Role string   `json:"role"`
+	Text []string `json:"text"`
+}
+
+func decodeLegacyThread(data []byte) ([]llms.MessageContent, error) {
+	var messages []legacyMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	buffer := make([]llms.MessageContent, 0, len(messages))
+	for _, legacy := range messages {
+		buffer = append(buffer, llms.TextParts(llms.ChatMessageType(legacy.Role), legacy.Text...))
+	}
+	return buffer, nil
+}
+
+// MarshalJSON makes ChatSessionGraph exportable with the conversation codec.
+func (g ChatSessionGraph) MarshalJSON() ([]byte, error) {
+	return EncodeConversation(g.ConversationBuffer)
+}
+
+// UnmarshalJSON restores ChatSessionGraph written by MarshalJSON.
+func (g *ChatSessionGraph) UnmarshalJSON(data []byte) error {
+	buffer, err := DecodeConversation(data)
+	if err != nil {
+		return err
+	}
+	g.ConversationBuffer = buffer
+	return nil
+}
@@ -0,0 +1,93 @@
+package database_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/database"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestConversationRoundTrip(t *testing.T) {
+	buffer := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "You are helpful agent"),
+		{
+			Role: llms.ChatMessageTypeHuman,
+			Parts: []llms.ContentPart{
+				llms.TextPart("What's in the image?"),
+				llms.ImageURLWithDetailPart("https://example.com/cat.png", "low"),
+				llms.BinaryPart("image/png", []byte{0x89, 0x50, 0x4e, 0x47}),
+			},
+		},
+		{
+			Role: llms.ChatMessageTypeAI,
+			Parts: []llms.ContentPart{
+				llms.TextPart(""),
+				llms.ToolCall{
+					ID:   "call_1",
+					Type: "function",
+					FunctionCall: &llms.FunctionCall{
+						Name:      "semanticSearch",
+						Arguments: `{"query":"embeddings","collection":"Hellper"}`,
+					},
+				},
+				llms.ToolCall{ID: "call_2", Type: "function"},
+			},
+		},
+		{
+			Role: llms.ChatMessageTypeTool,
+			Parts: []llms.ContentPart{
+				llms.ToolCallResponse{ToolCallID: "call_1", Name: "semanticSearch", Content: "embeddings package loads docs"},
+			},
+		},
+		llms.TextParts(llms.ChatMessageTypeAI, "It loads documents into pgvector."),
+	}
+
+	data, err := database.EncodeConversation(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := database.DecodeConversation(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buffer, decoded) {
+		t.Fatalf("round trip mismatch:\nwant %#v\ngot  %#v", buffer, decoded)
+	}
+
+	// ChatSessionGraph goes through the same codec
+	graph := database.ChatSessionGraph{ConversationBuffer: buffer}
+	raw, err := json.Marshal(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored database.ChatSessionGraph
+	if err := json.Unmarshal(raw, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buffer, restored.ConversationBuffer) {
+		t.Fatalf("graph round trip mismatch")
+	}
+}
+
+func TestDecodeLegacyThread(t *testing.T) {
+	legacy := []byte(`[{"role":"human","text":["hi"]},{"role":"ai","text":["hello"]}]`)
+	decoded, err := database.DecodeConversation(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "hi"),
+		llms.TextParts(llms.ChatMessageTypeAI, "hello"),
+	}
+	if !reflect.DeepEqual(want, decoded) {
+		t.Fatalf("want %#v, got %#v", want, decoded)
+	}
+}
+
+func TestDecodeUnknownVersion(t *testing.T) {
+	if _, err := database.DecodeConversation([]byte(`{"version":99,"messages":[]}`)); err == nil {
+		t.Fatal("expected error for unknown version")
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import "fmt"
+
+// DialogStatus is a step of the user onboarding/dialog state machine.
+// Values are stored in database, never renumber existing statuses.
+type DialogStatus int8
+
+const (
+	// new user, greeting was sent
+	StatusNew DialogStatus = 0
+	// reserved by old onboarding, handled the same way as StatusNew
+	StatusStarted DialogStatus = 1
+	// admin with key preset in config, models menu is sent right away
+	StatusAuthorized DialogStatus = 2
+	// asked for api key, next text message is the key
+	StatusAwaitingKey DialogStatus = 3
+	// models menu is shown, waiting for inline button
+	StatusAwaitingModel DialogStatus = 4
+	// language menu is shown, waiting for inline button
+	StatusAwaitingLanguage DialogStatus = 5
+	// session is set up, every message goes to the agent
+	StatusDialog DialogStatus = 6
+	// new user waiting for admin approval or invite code (access mode is not open)
+	StatusPending DialogStatus = 7
+)
+
+var statusNames = map[DialogStatus]string{
+	StatusNew:              "new",
+	StatusStarted:          "started",
+	StatusAuthorized:       "authorized",
+	StatusAwaitingKey:      "awaiting_key",
+	StatusAwaitingModel:    "awaiting_model",
+	StatusAwaitingLanguage: "awaiting_language",
+	StatusDialog:           "dialog",
+	StatusPending:          "pending",
+}
+
+// transitions declares which statuses can follow each status.
+// Add new onboarding step here and register its handlers in dialog package.
+var transitions = map[DialogStatus][]DialogStatus{
+	StatusNew:              {StatusAwaitingKey},
+	StatusStarted:          {StatusAwaitingKey},
+	StatusAuthorized:       {StatusAwaitingKey, StatusAwaitingModel},
+	StatusAwaitingKey:      {StatusAwaitingModel},
+	StatusAwaitingModel:    {StatusAwaitingLanguage},
+	StatusAwaitingLanguage: {StatusDialog},
+	StatusDialog:           {StatusDialog, StatusAwaitingModel, StatusAwaitingKey},
+	StatusPending:          {StatusNew},
+}
+
+func (s DialogStatus) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int8(s))
+}
+
+// CanTransitionTo reports whether next status is declared as a successor of s.
+func (s DialogStatus) CanTransitionTo(next DialogStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidTransitionError is returned when status change is not declared in transitions.
+type InvalidTransitionError struct {
+	From DialogStatus
+	To   DialogStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("invalid dialog status transition %s -> %s", e.From, e.To)
+}
+
+// SetDialogStatus moves user to the next status if transition is allowed.
+func (u *User) SetDialogStatus(next DialogStatus) error {
+	if !u.DialogStatus.CanTransitionTo(next) {
+		return &InvalidTransitionError{From: u.DialogStatus, To: next}
+	}
+	u.DialogStatus = next
+	return nil
+}
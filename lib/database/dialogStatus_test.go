@@ -0,0 +1,70 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/database"
+)
+
+func TestDialogStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to database.DialogStatus
+		allowed  bool
+	}{
+		{database.StatusNew, database.StatusAwaitingKey, true},
+		{database.StatusStarted, database.StatusAwaitingKey, true},
+		{database.StatusAuthorized, database.StatusAwaitingKey, true},
+		{database.StatusAuthorized, database.StatusAwaitingModel, true},
+		{database.StatusAwaitingKey, database.StatusAwaitingModel, true},
+		{database.StatusAwaitingModel, database.StatusAwaitingLanguage, true},
+		{database.StatusAwaitingLanguage, database.StatusDialog, true},
+		{database.StatusDialog, database.StatusDialog, true},
+		{database.StatusDialog, database.StatusAwaitingModel, true},
+		{database.StatusDialog, database.StatusAwaitingKey, true},
+		{database.StatusPending, database.StatusNew, true},
+
+		// onboarding steps can't be skipped
+		{database.StatusNew, database.StatusDialog, false},
+		{database.StatusNew, database.StatusAwaitingModel, false},
+		{database.StatusAwaitingKey, database.StatusDialog, false},
+		{database.StatusAwaitingModel, database.StatusDialog, false},
+		// and can't go back to the start
+		{database.StatusDialog, database.StatusNew, false},
+		{database.StatusAwaitingLanguage, database.StatusAwaitingKey, false},
+		// pending user is let in only through StatusNew
+		{database.StatusPending, database.StatusAwaitingKey, false},
+		{database.StatusPending, database.StatusDialog, false},
+		{database.StatusNew, database.StatusPending, false},
+		{database.StatusDialog, database.StatusPending, false},
+		// unknown statuses have no transitions
+		{database.DialogStatus(42), database.StatusNew, false},
+		{database.StatusNew, database.DialogStatus(42), false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransitionTo(tt.to); got != tt.allowed {
+			t.Errorf("%s -> %s: allowed %v, want %v", tt.from, tt.to, got, tt.allowed)
+		}
+
+		user := database.User{ID: 1, DialogStatus: tt.from}
+		err := user.SetDialogStatus(tt.to)
+		if tt.allowed {
+			if err != nil || user.DialogStatus != tt.to {
+				t.Errorf("%s -> %s: status %s, error %v", tt.from, tt.to, user.DialogStatus, err)
+			}
+			continue
+		}
+		var invalid *database.InvalidTransitionError
+		if !errors.As(err, &invalid) || invalid.From != tt.from || invalid.To != tt.to {
+			t.Errorf("%s -> %s: expected InvalidTransitionError, got %v", tt.from, tt.to, err)
+		}
+		if user.DialogStatus != tt.from {
+			t.Errorf("%s -> %s: rejected transition changed status to %s", tt.from, tt.to, user.DialogStatus)
+		}
+	}
+
+	err := &database.InvalidTransitionError{From: database.StatusNew, To: database.DialogStatus(42)}
+	if err.Error() != "invalid dialog status transition new -> unknown(42)" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInviteNotFound is returned by UseInvite for unknown code
+	ErrInviteNotFound = errors.New("invite not found")
+	// ErrInviteUsedUp is returned by UseInvite when single-use code is already used
+	ErrInviteUsedUp = errors.New("invite is already used")
+)
+
+// Invite lets a new user skip admin approval, it's sent as t.me/<bot>?start=<code> link.
+type Invite struct {
+	Code string
+	// MaxUses is 1 for single-use code, 0 for unlimited
+	MaxUses   int
+	Uses      int
+	CreatedBy int64
+	CreatedAt time.Time
+}
+
+// InviteStore keeps invite codes and chats let in by admins or invites. Both MemoryStore and PostgresStore implement it.
+//
+// Approvals are kept apart from users, so user deleted by /restart or /reset doesn't wait for approval again.
+type InviteStore interface {
+	// SaveInvite stores new invite, code must be unique.
+	SaveInvite(invite Invite) error
+	// UseInvite atomically counts one use of the code and returns the invite after it.
+	UseInvite(code string) (Invite, error)
+	// ListInvites returns all invites.
+	ListInvites() ([]Invite, error)
+	// Approve remembers that the chat was let in, approving it again is not an error.
+	Approve(chatID int64) error
+	// Approved reports whether the chat was let in before.
+	Approved(chatID int64) (bool, error)
+}
+
+func (inv Invite) usedUp() bool {
+	return inv.MaxUses > 0 && inv.Uses >= inv.MaxUses
+}
+
+func (s *MemoryStore) SaveInvite(invite Invite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.invites[invite.Code]; ok {
+		return fmt.Errorf("invite %q already exists", invite.Code)
+	}
+	s.invites[invite.Code] = invite
+	return nil
+}
+
+func (s *MemoryStore) UseInvite(code string) (Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invite, ok := s.invites[code]
+	if !ok {
+		return Invite{}, ErrInviteNotFound
+	}
+	if invite.usedUp() {
+		return invite, ErrInviteUsedUp
+	}
+	invite.Uses++
+	s.invites[code] = invite
+	return invite, nil
+}
+
+func (s *MemoryStore) ListInvites() ([]Invite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	invites := make([]Invite, 0, len(s.invites))
+	for _, invite := range s.invites {
+		invites = append(invites, invite)
+	}
+	return invites, nil
+}
+
+func (s *MemoryStore) Approve(chatID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.approved[chatID] = true
+	return nil
+}
+
+func (s *MemoryStore) Approved(chatID int64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.approved[chatID], nil
+}
+
+func (s *PostgresStore) SaveInvite(invite Invite) error {
+	_, err := s.pool.Exec(context.Background(),
+		`INSERT INTO hellper_invites (code, max_uses, uses, created_by, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		invite.Code, invite.MaxUses, invite.Uses, invite.CreatedBy, invite.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("save invite: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) UseInvite(code string) (Invite, error) {
+	ctx := context.Background()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return Invite{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var invite Invite
+	err = tx.QueryRow(ctx, `SELECT code, max_uses, uses, created_by, created_at FROM hellper_invites WHERE code = $1 FOR UPDATE`, code).
+		Scan(&invite.Code, &invite.MaxUses, &invite.Uses, &invite.CreatedBy, &invite.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Invite{}, ErrInviteNotFound
+	}
+	if err != nil {
+		return Invite{}, err
+	}
+	if invite.usedUp() {
+		return invite, ErrInviteUsedUp
+	}
+	invite.Uses++
+	if _, err := tx.Exec(ctx, `UPDATE hellper_invites SET uses = $2 WHERE code = $1`, code, invite.Uses); err != nil {
+		return Invite{}, err
+	}
+	return invite, tx.Commit(ctx)
+}
+
+func (s *PostgresStore) ListInvites() ([]Invite, error) {
+	rows, err := s.pool.Query(context.Background(), `SELECT code, max_uses, uses, created_by, created_at FROM hellper_invites ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []Invite{}
+	for rows.Next() {
+		var invite Invite
+		if err := rows.Scan(&invite.Code, &invite.MaxUses, &invite.Uses, &invite.CreatedBy, &invite.CreatedAt); err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+func (s *PostgresStore) Approve(chatID int64) error {
+	_, err := s.pool.Exec(context.Background(), `INSERT INTO hellper_approvals (chat_id) VALUES ($1) ON CONFLICT (chat_id) DO NOTHING`, chatID)
+	if err != nil {
+		return fmt.Errorf("approve chat %d: %w", chatID, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Approved(chatID int64) (bool, error) {
+	var approved bool
+	err := s.pool.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM hellper_approvals WHERE chat_id = $1)`, chatID).Scan(&approved)
+	return approved, err
+}
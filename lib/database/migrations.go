@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrations are applied in order, index+1 is a schema version.
+// Never edit already released migration, append a new one instead.
+var migrations = []string{
+	// 1: users
+	`CREATE TABLE IF NOT EXISTS hellper_users (
+		id            BIGINT PRIMARY KEY,
+		username      TEXT NOT NULL DEFAULT '',
+		dialog_status SMALLINT NOT NULL DEFAULT 0,
+		admin         BOOLEAN NOT NULL DEFAULT FALSE,
+		network       TEXT NOT NULL DEFAULT '',
+		topics        JSONB NOT NULL DEFAULT '[]',
+		gpt_key       TEXT NOT NULL DEFAULT '',
+		gpt_model     TEXT NOT NULL DEFAULT '',
+		ai_type       SMALLINT NOT NULL DEFAULT 0,
+		base_url      TEXT NOT NULL DEFAULT '',
+		usage         JSONB NOT NULL DEFAULT '{}',
+		dialog_thread JSONB NOT NULL DEFAULT '[]',
+		updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	// 2: keys of the http api, NULL when not issued
+	`ALTER TABLE hellper_users ADD COLUMN IF NOT EXISTS api_key TEXT UNIQUE`,
+	// 3: users banned by admins
+	`ALTER TABLE hellper_users ADD COLUMN IF NOT EXISTS banned BOOLEAN NOT NULL DEFAULT FALSE`,
+	// 4: invite codes, max_uses 0 is unlimited
+	`CREATE TABLE IF NOT EXISTS hellper_invites (
+		code       TEXT PRIMARY KEY,
+		max_uses   INTEGER NOT NULL DEFAULT 1,
+		uses       INTEGER NOT NULL DEFAULT 0,
+		created_by BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	// 5: usage ledger, one row per chat, day (UTC), model and feature
+	`CREATE TABLE IF NOT EXISTS hellper_usage (
+		chat_id           BIGINT NOT NULL,
+		day               DATE NOT NULL,
+		model             TEXT NOT NULL DEFAULT '',
+		feature           TEXT NOT NULL,
+		requests          INTEGER NOT NULL DEFAULT 0,
+		prompt_tokens     BIGINT NOT NULL DEFAULT 0,
+		completion_tokens BIGINT NOT NULL DEFAULT 0,
+		total_tokens      BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (chat_id, day, model, feature)
+	)`,
+	// 6: provider profiles of users and the selected one, empty provider is the default endpoint from config
+	`ALTER TABLE hellper_users
+		ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS providers JSONB NOT NULL DEFAULT '[]'`,
+	// 7: key entered by the user, kept apart from keys of provider profiles
+	`ALTER TABLE hellper_users ADD COLUMN IF NOT EXISTS own_key TEXT NOT NULL DEFAULT ''`,
+	// 8: users on the default endpoint use their own key
+	`UPDATE hellper_users SET own_key = gpt_key WHERE provider = ''`,
+	// 9: chats let in by admins or invites, rows of users are deleted by /restart and /reset
+	`CREATE TABLE IF NOT EXISTS hellper_approvals (
+		chat_id     BIGINT PRIMARY KEY,
+		approved_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	// 10: users who already passed approval, 7 is StatusPending
+	`INSERT INTO hellper_approvals (chat_id) SELECT id FROM hellper_users WHERE dialog_status <> 7 AND NOT banned ON CONFLICT DO NOTHING`,
+}
+
+// Migrate brings database schema to the latest version.
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS hellper_schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+
+	var current int
+	err = pool.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM hellper_schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		tx, err := pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, migrations[i]); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO hellper_schema_migrations (version) VALUES ($1)`, version); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		log.Println("database migrated to version", version)
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ package database
 // user should be fully functional user class and all operation with user should be placed here (in separate user.go package)
 
 import (
+	"sync"
+
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/vectorstores"
 )
@@ -12,11 +14,17 @@ import (
 type User struct {
 	ID           int64
 	Username     string
-	DialogStatus int8
+	DialogStatus DialogStatus
 	Admin        bool
 	AiSession    AiSession
 	Network      string
 	Topics       []int
+	// APIKey authorizes requests to the http api on behalf of the user, empty if not issued
+	APIKey string
+	// Banned users are ignored by the bot and the http api
+	Banned      bool
+	// Providers are own ai endpoint profiles of the user, see /provider
+	Providers []Provider
 	VectorStore vectorstores.VectorStore
 	//local_ai_pass string
 }
@@ -28,10 +36,15 @@ type SessionUsage struct {
 
 type AiSession struct {
 	GptKey       string
+	// OwnKey is the key user entered during onboarding (or admin key), GptKey returns to it when provider has no own key
+	OwnKey       string
 	GptModel     string
 	AI_Type      int8
 	DialogThread ChatSessionGraph		
 	Base_url     string
+	// Provider is name of selected provider, empty for the default endpoint from config
+	Provider string
+	// Usage is total of the session: tokens ("Promt", "Completion", "Total") and "ToolCalls"
 	Usage        map[string]int
 }
 
@@ -51,23 +64,16 @@ type ChatSessionGraph struct {
 
 }
 
-var UsersMap = make(map[int64]User)
+// UsageMap is a scratch buffer for usage of the current dialog turn, it's filled from llm callbacks.
+// Usage of finished turn is added to session totals (AiSession.Usage, see AddSessionUsage) and to UsageStore.
+// Users themselves are kept in UserStore.
+// It's written from llm callbacks in generation goroutines, so every access goes through usageMu.
 var UsageMap = make(map[int64]SessionUsage)
-
-func AddUser(user User) {
-	UsersMap[user.ID] = user
-}
-
-func UpdateUserUsage(id int64, usage map[string]int) {
-	user, exists := UsersMap[id]
-	if exists {
-		user.AiSession.Usage = usage
-		//UsersMap[id] = user
-	}
-	UsersMap[id] = user
-}
+var usageMu sync.Mutex
 
 func UpdateSessionUsage(id int64, usage map[string]int) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
 	su := UsageMap[id]
 	su.ID = id
 	su.Usage = usage
@@ -76,6 +82,8 @@ func UpdateSessionUsage(id int64, usage map[string]int) {
 }
 
 func GetSessionUsage(id int64) map[string]int {
+	usageMu.Lock()
+	defer usageMu.Unlock()
 	usage := UsageMap[id].Usage
 	return usage
 }
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore keeps users in postgres, so sessions survive bot restarts.
+// VectorStore is not persisted, user have to /setContext again after restart.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore connects to db_link and applies schema migrations.
+func NewPostgresStore(ctx context.Context, db_link string) (*PostgresStore, error) {
+	pool, err := pgxpool.New(ctx, db_link)
+	if err != nil {
+		return nil, err
+	}
+	if err := Migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &PostgresStore{pool: pool}, nil
+}
+
+func (s *PostgresStore) Close() {
+	s.pool.Close()
+}
+
+const userColumns = `id, username, dialog_status, admin, network, topics,
+	gpt_key, gpt_model, ai_type, base_url, usage, dialog_thread, api_key, banned, provider, providers, own_key`
+
+func (s *PostgresStore) Get(id int64) (User, bool) {
+	user, err := s.Find(id)
+	if errors.Is(err, ErrUserNotFound) {
+		return User{}, false
+	}
+	if err != nil {
+		log.Printf("PostgresStore: error reading user %d: %v\n", id, err)
+		return User{}, false
+	}
+	return user, true
+}
+
+func (s *PostgresStore) Find(id int64) (User, error) {
+	row := s.pool.QueryRow(context.Background(), `SELECT `+userColumns+` FROM hellper_users WHERE id = $1`, id)
+	user, err := scanUser(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("read user %d: %w", id, err)
+	}
+	return user, nil
+}
+
+func (s *PostgresStore) Save(user User) error {
+	return saveUser(context.Background(), s.pool, user)
+}
+
+func (s *PostgresStore) Update(id int64, fn func(user *User)) (User, error) {
+	ctx := context.Background()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	row := tx.QueryRow(ctx, `SELECT `+userColumns+` FROM hellper_users WHERE id = $1 FOR UPDATE`, id)
+	user, err := scanUser(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	fn(&user)
+	if err := saveUser(ctx, tx, user); err != nil {
+		return User{}, err
+	}
+	return user, tx.Commit(ctx)
+}
+
+// execer is either pool or transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func saveUser(ctx context.Context, db execer, user User) error {
+	topics, err := json.Marshal(user.Topics)
+	if err != nil {
+		return err
+	}
+	usage, err := json.Marshal(user.AiSession.Usage)
+	if err != nil {
+		return err
+	}
+	thread, err := EncodeConversation(user.AiSession.DialogThread.ConversationBuffer)
+	if err != nil {
+		return err
+	}
+	providers, err := json.Marshal(user.Providers)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, `INSERT INTO hellper_users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		ON CONFLICT (id) DO UPDATE SET
+			username = EXCLUDED.username,
+			dialog_status = EXCLUDED.dialog_status,
+			admin = EXCLUDED.admin,
+			network = EXCLUDED.network,
+			topics = EXCLUDED.topics,
+			gpt_key = EXCLUDED.gpt_key,
+			gpt_model = EXCLUDED.gpt_model,
+			ai_type = EXCLUDED.ai_type,
+			base_url = EXCLUDED.base_url,
+			usage = EXCLUDED.usage,
+			dialog_thread = EXCLUDED.dialog_thread,
+			api_key = EXCLUDED.api_key,
+			banned = EXCLUDED.banned,
+			provider = EXCLUDED.provider,
+			providers = EXCLUDED.providers,
+			own_key = EXCLUDED.own_key,
+			updated_at = now()`,
+		user.ID, user.Username, user.DialogStatus, user.Admin, user.Network, topics,
+		user.AiSession.GptKey, user.AiSession.GptModel, user.AiSession.AI_Type, user.AiSession.Base_url, usage, thread,
+		nullIfEmpty(user.APIKey), user.Banned, user.AiSession.Provider, providers, user.AiSession.OwnKey,
+	)
+	if err != nil {
+		return fmt.Errorf("save user %d: %w", user.ID, err)
+	}
+	return nil
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func (s *PostgresStore) FindByAPIKey(key string) (User, bool) {
+	if key == "" {
+		return User{}, false
+	}
+	row := s.pool.QueryRow(context.Background(), `SELECT `+userColumns+` FROM hellper_users WHERE api_key = $1`, key)
+	user, err := scanUser(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return User{}, false
+	}
+	if err != nil {
+		log.Println("PostgresStore: error finding user by api key:", err)
+		return User{}, false
+	}
+	return user, true
+}
+
+func (s *PostgresStore) Delete(id int64) error {
+	_, err := s.pool.Exec(context.Background(), `DELETE FROM hellper_users WHERE id = $1`, id)
+	return err
+}
+
+func (s *PostgresStore) List() ([]User, error) {
+	rows, err := s.pool.Query(context.Background(), `SELECT `+userColumns+` FROM hellper_users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func scanUser(row pgx.Row) (User, error) {
+	var user User
+	var topics, usage, thread, providers []byte
+	var apiKey *string
+	err := row.Scan(
+		&user.ID, &user.Username, &user.DialogStatus, &user.Admin, &user.Network, &topics,
+		&user.AiSession.GptKey, &user.AiSession.GptModel, &user.AiSession.AI_Type, &user.AiSession.Base_url, &usage, &thread,
+		&apiKey, &user.Banned, &user.AiSession.Provider, &providers, &user.AiSession.OwnKey,
+	)
+	if err != nil {
+		return User{}, err
+	}
+	if apiKey != nil {
+		user.APIKey = *apiKey
+	}
+	if err := json.Unmarshal(topics, &user.Topics); err != nil {
+		return User{}, err
+	}
+	if err := json.Unmarshal(usage, &user.AiSession.Usage); err != nil {
+		return User{}, err
+	}
+	if err := json.Unmarshal(providers, &user.Providers); err != nil {
+		return User{}, err
+	}
+	buffer, err := DecodeConversation(thread)
+	if err != nil {
+		return User{}, err
+	}
+	user.AiSession.DialogThread.ConversationBuffer = buffer
+	return user, nil
+}
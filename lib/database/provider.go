@@ -0,0 +1,107 @@
+package database
+
+import "fmt"
+
+// types of providers, type decides how endpoint, images and transcription are reached
+const (
+	ProviderLocalAI = "localai"
+	ProviderOpenAI  = "openai"
+)
+
+// ai types kept in AiSession.AI_Type
+const (
+	AITypeLocalAI int8 = iota
+	AITypeOpenAI
+)
+
+// Provider is a named ai endpoint profile. Users register own profiles with /provider,
+// shared profiles come from config.
+type Provider struct {
+	Name string
+	// Type is ProviderLocalAI or ProviderOpenAI
+	Type string
+	// Endpoint is url of LocalAI (or any OpenAI compatible) node, empty for openai
+	Endpoint string
+	// Key is used instead of the key entered during onboarding, can be empty
+	Key string
+	// Model is chosen right away, user picks a model from the menu if empty
+	Model string
+}
+
+// Validate checks provider before it's saved
+func (p Provider) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("provider name is empty")
+	}
+	switch p.Type {
+	case ProviderLocalAI:
+		if p.Endpoint == "" {
+			return fmt.Errorf("localai provider %q needs endpoint", p.Name)
+		}
+	case ProviderOpenAI:
+	default:
+		return fmt.Errorf("unknown provider type %q, use %s or %s", p.Type, ProviderLocalAI, ProviderOpenAI)
+	}
+	return nil
+}
+
+// FindProvider returns own provider of the user by name
+func (u User) FindProvider(name string) (Provider, bool) {
+	for _, p := range u.Providers {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Provider{}, false
+}
+
+// SaveProvider adds own provider of the user or replaces one with the same name
+func (u *User) SaveProvider(p Provider) {
+	for i := range u.Providers {
+		if u.Providers[i].Name == p.Name {
+			u.Providers[i] = p
+			return
+		}
+	}
+	u.Providers = append(u.Providers, p)
+}
+
+// RemoveProvider deletes own provider of the user, returns false if there is no such provider
+func (u *User) RemoveProvider(name string) bool {
+	for i := range u.Providers {
+		if u.Providers[i].Name == name {
+			u.Providers = append(u.Providers[:i], u.Providers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// UseProvider switches ai session to the provider. Key of the provider is used, own key of the user if provider has none,
+// so keys of other profiles never go to the endpoint. GptKey is empty if there is no key, user has to enter it.
+// Model is kept if provider doesn't set it. Empty provider switches back to the default endpoint from config.
+func (u *User) UseProvider(p Provider) {
+	u.AiSession.Provider = p.Name
+	u.Network = p.Type
+	u.AiSession.Base_url = p.Endpoint
+	u.AiSession.AI_Type = AITypeLocalAI
+	if p.Type == ProviderOpenAI {
+		u.AiSession.AI_Type = AITypeOpenAI
+	}
+	u.AiSession.GptKey = p.Key
+	if p.Key == "" {
+		u.AiSession.GptKey = u.AiSession.OwnKey
+	}
+	if p.Model != "" {
+		u.AiSession.GptModel = p.Model
+	}
+}
+
+// Endpoint returns ai endpoint of the user, def (from config) if no provider is selected.
+// Empty endpoint means openai.
+func (u User) Endpoint(def string) string {
+	if u.AiSession.Provider == "" {
+		return def
+	}
+	return u.AiSession.Base_url
+}
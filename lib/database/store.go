@@ -0,0 +1,115 @@
+package database
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrUserNotFound is returned by Find and Update when there is no user with such id.
+var ErrUserNotFound = errors.New("user not found")
+
+// UserStore is the place where bot users live between updates.
+// Commander, dialog and langchain packages should go through the store instead of keeping their own copies of users.
+type UserStore interface {
+	// Get returns user by telegram chat id, second value is false if there is no such user
+	// or it can't be read (the error is logged).
+	Get(id int64) (User, bool)
+	// Find is Get which tells missing user (ErrUserNotFound) from failed read,
+	// use it where missing user is created, so a read error doesn't overwrite the stored one.
+	Find(id int64) (User, error)
+	// Save inserts or replaces the user.
+	Save(user User) error
+	// Update atomically applies fn to the stored user and saves the result.
+	// Use it instead of Get+Save when user can be changed concurrently (e.g. by generation goroutines).
+	Update(id int64, fn func(user *User)) (User, error)
+	// Delete removes the user, deleting unknown user is not an error.
+	Delete(id int64) error
+	// List returns all known users.
+	List() ([]User, error)
+	// FindByAPIKey returns user who owns the http api key, second value is false if key is unknown.
+	FindByAPIKey(key string) (User, bool)
+}
+
+// MemoryStore keeps users in process memory, everything is lost on restart.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	users   map[int64]User
+	invites map[string]Invite
+	// chats let in by admins or invites
+	approved map[int64]bool
+	usage    map[usageKey]UsageRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:    make(map[int64]User),
+		invites:  make(map[string]Invite),
+		approved: make(map[int64]bool),
+		usage:    make(map[usageKey]UsageRecord),
+	}
+}
+
+func (s *MemoryStore) Get(id int64) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[id]
+	return user, ok
+}
+
+func (s *MemoryStore) Save(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s *MemoryStore) Find(id int64) (User, error) {
+	user, ok := s.Get(id)
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryStore) Update(id int64, fn func(user *User)) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	fn(&user)
+	s.users[id] = user
+	return user, nil
+}
+
+func (s *MemoryStore) Delete(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, id)
+	return nil
+}
+
+func (s *MemoryStore) FindByAPIKey(key string) (User, bool) {
+	if key == "" {
+		return User{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, user := range s.users {
+		if user.APIKey == key {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *MemoryStore) List() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// features usage is accounted for
+const (
+	FeatureChat          = "chat"
+	FeatureRAG           = "rag"
+	FeatureImage         = "image"
+	FeatureTranscription = "transcription"
+)
+
+// UsageRecord is usage of one feature with one model by a chat during a day (UTC).
+// Records are kept apart from users, so they survive /reset and deletion of the user.
+type UsageRecord struct {
+	ChatID           int64
+	Day              time.Time
+	Model            string
+	Feature          string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// UsageStore is a ledger of usage. Both MemoryStore and PostgresStore implement it.
+type UsageStore interface {
+	// AddUsage adds counters of the record to the record of the same chat, day, model and feature.
+	AddUsage(record UsageRecord) error
+	// ListUsage returns records of the chat since the day, chatID 0 means all chats.
+	// Records are sorted by day, chat, model and feature.
+	ListUsage(chatID int64, since time.Time) ([]UsageRecord, error)
+}
+
+// Day returns start of the day (UTC) usage at t is accounted to
+func Day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// TurnUsage converts usage of a dialog turn (as kept by UpdateSessionUsage) into records:
+// tokens go to chat, tool calls requested by the model go to rag.
+func TurnUsage(chatID int64, model string, usage map[string]int, at time.Time) []UsageRecord {
+	records := []UsageRecord{{
+		ChatID:           chatID,
+		Day:              Day(at),
+		Model:            model,
+		Feature:          FeatureChat,
+		Requests:         1,
+		PromptTokens:     usage["Promt"],
+		CompletionTokens: usage["Completion"],
+		TotalTokens:      usage["Total"],
+	}}
+	if calls := usage["ToolCalls"]; calls > 0 {
+		records = append(records, UsageRecord{ChatID: chatID, Day: Day(at), Model: model, Feature: FeatureRAG, Requests: calls})
+	}
+	return records
+}
+
+// AddSessionUsage returns session totals with usage of a turn added
+func AddSessionUsage(total, turn map[string]int) map[string]int {
+	sum := make(map[string]int, len(total))
+	for k, v := range total {
+		sum[k] += v
+	}
+	for k, v := range turn {
+		sum[k] += v
+	}
+	return sum
+}
+
+type usageKey struct {
+	chatID  int64
+	day     time.Time
+	model   string
+	feature string
+}
+
+func (r UsageRecord) key() usageKey {
+	return usageKey{r.ChatID, Day(r.Day), r.Model, r.Feature}
+}
+
+func (r *UsageRecord) add(other UsageRecord) {
+	r.Requests += other.Requests
+	r.PromptTokens += other.PromptTokens
+	r.CompletionTokens += other.CompletionTokens
+	r.TotalTokens += other.TotalTokens
+}
+
+func sortUsage(records []UsageRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		switch {
+		case !a.Day.Equal(b.Day):
+			return a.Day.Before(b.Day)
+		case a.ChatID != b.ChatID:
+			return a.ChatID < b.ChatID
+		case a.Model != b.Model:
+			return a.Model < b.Model
+		default:
+			return a.Feature < b.Feature
+		}
+	})
+}
+
+func (s *MemoryStore) AddUsage(record UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := record.key()
+	total, ok := s.usage[key]
+	if !ok {
+		total = UsageRecord{ChatID: key.chatID, Day: key.day, Model: key.model, Feature: key.feature}
+	}
+	total.add(record)
+	s.usage[key] = total
+	return nil
+}
+
+func (s *MemoryStore) ListUsage(chatID int64, since time.Time) ([]UsageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := []UsageRecord{}
+	for key, record := range s.usage {
+		if (chatID == 0 || key.chatID == chatID) && !key.day.Before(Day(since)) {
+			records = append(records, record)
+		}
+	}
+	sortUsage(records)
+	return records, nil
+}
+
+func (s *PostgresStore) AddUsage(record UsageRecord) error {
+	_, err := s.pool.Exec(context.Background(),
+		`INSERT INTO hellper_usage (chat_id, day, model, feature, requests, prompt_tokens, completion_tokens, total_tokens)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (chat_id, day, model, feature) DO UPDATE SET
+			requests = hellper_usage.requests + EXCLUDED.requests,
+			prompt_tokens = hellper_usage.prompt_tokens + EXCLUDED.prompt_tokens,
+			completion_tokens = hellper_usage.completion_tokens + EXCLUDED.completion_tokens,
+			total_tokens = hellper_usage.total_tokens + EXCLUDED.total_tokens`,
+		record.ChatID, Day(record.Day), record.Model, record.Feature,
+		record.Requests, record.PromptTokens, record.CompletionTokens, record.TotalTokens,
+	)
+	if err != nil {
+		return fmt.Errorf("add usage: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) ListUsage(chatID int64, since time.Time) ([]UsageRecord, error) {
+	rows, err := s.pool.Query(context.Background(),
+		`SELECT chat_id, day, model, feature, requests, prompt_tokens, completion_tokens, total_tokens FROM hellper_usage
+		WHERE ($1::BIGINT = 0 OR chat_id = $1) AND day >= $2
+		ORDER BY day, chat_id, model, feature`,
+		chatID, Day(since),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []UsageRecord{}
+	for rows.Next() {
+		var r UsageRecord
+		if err := rows.Scan(&r.ChatID, &r.Day, &r.Model, &r.Feature, &r.Requests, &r.PromptTokens, &r.CompletionTokens, &r.TotalTokens); err != nil {
+			return nil, err
+		}
+		r.Day = r.Day.UTC()
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,55 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/database"
+)
+
+func TestUsageLedger(t *testing.T) {
+	store := database.NewMemoryStore()
+	monday := time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)
+
+	turn := map[string]int{"Promt": 100, "Completion": 20, "Total": 120, "ToolCalls": 1}
+	for _, at := range []time.Time{monday, monday.Add(2 * time.Hour), monday.Add(24 * time.Hour)} {
+		for _, record := range database.TurnUsage(1, "tiger-gemma", turn, at) {
+			if err := store.AddUsage(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	store.AddUsage(database.UsageRecord{ChatID: 2, Day: monday, Model: "stablediffusion", Feature: database.FeatureImage, Requests: 1})
+
+	records, err := store.ListUsage(1, monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected chat and rag records of two days, got %+v", records)
+	}
+	first := records[0]
+	if !first.Day.Equal(database.Day(monday)) || first.Feature != database.FeatureChat || first.Requests != 2 || first.TotalTokens != 240 || first.PromptTokens != 200 {
+		t.Errorf("usage of the day must be accumulated, got %+v", first)
+	}
+	if rag := records[1]; rag.Feature != database.FeatureRAG || rag.Requests != 2 || rag.TotalTokens != 0 {
+		t.Errorf("tool calls must go to rag, got %+v", rag)
+	}
+
+	tuesday, _ := store.ListUsage(0, monday.Add(24*time.Hour))
+	if len(tuesday) != 2 || tuesday[0].ChatID != 1 {
+		t.Errorf("records before the day must be skipped, got %+v", tuesday)
+	}
+	all, _ := store.ListUsage(0, time.Time{})
+	if len(all) != 5 {
+		t.Errorf("expected records of all chats, got %+v", all)
+	}
+}
+
+func TestAddSessionUsage(t *testing.T) {
+	total := database.AddSessionUsage(nil, map[string]int{"Total": 10})
+	total = database.AddSessionUsage(total, map[string]int{"Total": 5, "ToolCalls": 1})
+	if total["Total"] != 15 || total["ToolCalls"] != 1 {
+		t.Errorf("session usage must be accumulated, got %v", total)
+	}
+}
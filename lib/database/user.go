@@ -2,23 +2,19 @@ package database
 
 import (
 	"log"
-	"os"
+	"net/http"
 
 	e "github.com/JackBekket/hellper/lib/embeddings"
-	"github.com/joho/godotenv"
 	"github.com/tmc/langchaingo/vectorstores/pgvector"
 )
 
 
-func (u *User) SetContext (collectionName string) error{
+// SetContext connects collection of embeddings db (db_link) to the user, ai_endpoint creates embeddings, client sends requests to it
+func (u *User) SetContext (collectionName, ai_endpoint, db_link string, client *http.Client) error{
 	
-		_ = godotenv.Load()
 		api_token := u.AiSession.GptKey
-		ai_endpoint := os.Getenv("AI_ENDPOINT")
-		//log.Println("ai endpoint is: ", ai_endpoint)
-		db_link := os.Getenv("EMBEDDINGS_DB_URL")
 	
-		vectorStore, err := e.GetVectorStoreWithOptions(ai_endpoint, api_token, db_link, collectionName)
+		vectorStore, err := e.GetVectorStoreWithOptions(ai_endpoint, api_token, db_link, collectionName, client)
 		if err != nil {
 			log.Println("error getting vectorstore")
 			return err
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 
 	"github.com/tmc/langchaingo/embeddings"
 	"github.com/tmc/langchaingo/llms/openai"
@@ -13,43 +14,12 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func LoadEnv() {
-
-}
-
-// Get vector store from db. ai_url is AI url (localhost or openai or docker), api_token is AI token, db_link is database link
-func GetVectorStore(ai_url string, api_token string, db_link string) (vectorstores.VectorStore, error) {
+// Get vector store from db. ai_url is AI url (localhost or openai or docker), api_token is AI token, db_link is database link,
+// client sends requests to ai_url
+func GetVectorStore(ai_url string, api_token string, db_link string, client *http.Client) (vectorstores.VectorStore, error) {
 
 	base_url := ai_url
-
-	//_ = godotenv.Load()
-
-
-	/*
-		host := os.Getenv("PG_HOST")
-		if host == "" {
-			log.Fatal("missing PG_HOST")
-		}
-
-		user := os.Getenv("PG_USER")
-		if user == "" {
-			log.Fatal("missing PG_USER")
-		}
-
-		password := os.Getenv("PG_PASSWORD")
-		if password == "" {
-			log.Fatal("missing PG_PASSWORD")
-		}
-
-		dbName := os.Getenv("PG_DB")
-		if dbName == "" {
-			log.Fatal("missing PG_DB")
-		}
-
-		connURLFormat := "postgres://%s:%s@%s:5432/%s?sslmode=disable"
-
-		pgConnURL := fmt.Sprintf(connURLFormat, user, url.QueryEscape(password), host, dbName)
-	*/
+	// db_link comes from config (database.url / EMBEDDINGS_DB_URL)
 	pgConnURL := db_link
 
 
@@ -71,6 +41,7 @@ func GetVectorStore(ai_url string, api_token string, db_link string) (vectorstor
 		//openai.WithModel("wizard-uncensored-13b"),
 		openai.WithEmbeddingModel("text-embedding-ada-002"),
 		openai.WithToken(api_token),
+		openai.WithHTTPClient(client),
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -108,7 +79,8 @@ func GetVectorStore(ai_url string, api_token string, db_link string) (vectorstor
 	
 }
 
-func GetVectorStoreWithOptions(ai_url string, api_token string, db_link string, name string) (vectorstores.VectorStore, error) {
+// GetVectorStoreWithOptions is GetVectorStore of the collection name
+func GetVectorStoreWithOptions(ai_url string, api_token string, db_link string, name string, client *http.Client) (vectorstores.VectorStore, error) {
 
 	base_url := ai_url
 
@@ -131,6 +103,7 @@ func GetVectorStoreWithOptions(ai_url string, api_token string, db_link string,
 		//openai.WithModel("wizard-uncensored-13b"),
 		openai.WithEmbeddingModel("text-embedding-ada-002"),
 		openai.WithToken(api_token),
+		openai.WithHTTPClient(client),
 	)
 	if err != nil {
 		log.Fatal(err)
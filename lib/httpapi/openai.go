@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// subset of OpenAI chat completions api, enough for common clients and IDE plugins
+
+type chatMessage struct {
+	Role    string      `json:"role"`
+	Content messageText `json:"content"`
+}
+
+// messageText is message content, which is either a string or an array of parts.
+// Only text parts are supported.
+type messageText string
+
+func (t *messageText) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = messageText(s)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of parts")
+	}
+	texts := []string{}
+	for _, part := range parts {
+		if part.Type != "text" {
+			return fmt.Errorf("content part %q is not supported", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	*t = messageText(strings.Join(texts, "\n"))
+	return nil
+}
+
+type chatCompletionRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type chatCompletionChoice struct {
+	Index        int          `json:"index"`
+	Message      *chatMessage `json:"message,omitempty"`
+	Delta        *chatDelta   `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+type chatDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []chatCompletionChoice `json:"choices"`
+}
+
+type model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type modelsResponse struct {
+	Object string  `json:"object"`
+	Data   []model `json:"data"`
+}
+
+type apiError struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+var roles = map[string]llms.ChatMessageType{
+	"system":    llms.ChatMessageTypeSystem,
+	"user":      llms.ChatMessageTypeHuman,
+	"assistant": llms.ChatMessageTypeAI,
+}
+
+// splitPrompt converts request messages into agent history and the prompt (last user message).
+func splitPrompt(messages []chatMessage) ([]llms.MessageContent, string, error) {
+	if len(messages) == 0 {
+		return nil, "", fmt.Errorf("messages are empty")
+	}
+	last := messages[len(messages)-1]
+	if last.Role != "user" {
+		return nil, "", fmt.Errorf("last message must have role user")
+	}
+	history := []llms.MessageContent{}
+	for _, msg := range messages[:len(messages)-1] {
+		role, ok := roles[msg.Role]
+		if !ok {
+			return nil, "", fmt.Errorf("role %q is not supported", msg.Role)
+		}
+		history = append(history, llms.TextParts(role, string(msg.Content)))
+	}
+	return history, string(last.Content), nil
+}
@@ -0,0 +1,274 @@
+// Package httpapi exposes the Hellper agent as OpenAI compatible http api,
+// so tools and IDE plugins can use the same RAG-enabled agent as the telegram bot.
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/config"
+	db "github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// completeFunc runs one turn of the agent, stream (can be nil) receives answer tokens
+type completeFunc func(user db.User, model string, history []llms.MessageContent, prompt string, stream langchain.Streamer) (string, error)
+
+// Limiter checks quotas of users, the bot's command.Limiter implements it
+type Limiter interface {
+	// AllowRequest counts a request, error is returned if the user is out of quota
+	AllowRequest(chatID int64) error
+	// AddTokens counts tokens spent by generation
+	AddTokens(chatID int64, tokens int)
+}
+
+// Admins finds admins from config, their requests go first in the queue. The bot's command.Admins implements it.
+type Admins interface {
+	Get(id int64) (config.Admin, bool)
+}
+
+// Server serves /v1/chat/completions and /v1/models.
+// Requests are authorized with keys issued by /apikey bot command and run with the ai session of key owner.
+type Server struct {
+	store db.UserStore
+	// usage ledger shared with the bot, nil if the store doesn't keep usage
+	usage     db.UsageStore
+	scheduler *langchain.Scheduler
+	// ai_endpoint is used for users without own provider
+	ai_endpoint string
+	// embeddings of the user for semanticSearch tool, settings of the bot are used if nil
+	embeddings func(user db.User) agent.Embeddings
+	// quotas shared with the bot, not checked if nil
+	limiter Limiter
+	// admins of the bot, nobody has priority if nil
+	admins Admins
+
+	complete completeFunc
+	models   func(api_token, ai_endpoint string) []string
+}
+
+// NewServer creates api server, scheduler is shared with the bot so http requests wait in the same queue.
+func NewServer(store db.UserStore, scheduler *langchain.Scheduler, ai_endpoint string) *Server {
+	s := &Server{
+		store:       store,
+		scheduler:   scheduler,
+		ai_endpoint: ai_endpoint,
+		models:      langchain.GetModelsList,
+	}
+	s.usage, _ = store.(db.UsageStore)
+	s.complete = s.continueAgent
+	return s
+}
+
+// UseEmbeddings sets embeddings of the user (endpoint and key of selected provider) for semanticSearch tool
+func (s *Server) UseEmbeddings(embeddings func(user db.User) agent.Embeddings) *Server {
+	s.embeddings = embeddings
+	return s
+}
+
+// UseLimiter makes api requests count in quotas of the bot
+func (s *Server) UseLimiter(limiter Limiter) *Server {
+	s.limiter = limiter
+	return s
+}
+
+// UseAdmins gives requests of admins priority in the queue shared with the bot
+func (s *Server) UseAdmins(admins Admins) *Server {
+	s.admins = admins
+	return s
+}
+
+// Register adds api routes to the mux
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("/v1/models", s.handleModels)
+}
+
+func (s *Server) continueAgent(user db.User, model string, history []llms.MessageContent, prompt string, stream langchain.Streamer) (string, error) {
+	state := &db.ChatSessionGraph{ConversationBuffer: history}
+	// api has no chat to send images to, generate_image tool tells the model so
+	ctx := context.Background()
+	if s.embeddings != nil {
+		ctx = agent.WithEmbeddings(ctx, s.embeddings(user))
+	}
+	_, answer, err := langchain.ContinueAgent(ctx, user.ID, user.AiSession.GptKey, model, user.Endpoint(s.ai_endpoint), prompt, state, stream)
+	usage := db.GetSessionUsage(user.ID)
+	if s.limiter != nil {
+		s.limiter.AddTokens(user.ID, usage["Total"])
+	}
+	if err == nil && s.usage != nil {
+		for _, record := range db.TurnUsage(user.ID, model, usage, time.Now()) {
+			if err := s.usage.AddUsage(record); err != nil {
+				log.Println("httpapi: could not record usage:", err)
+			}
+		}
+	}
+	return answer, err
+}
+
+// authorize finds user by bearer key, writes error response and returns false if request is not authorized
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) (db.User, bool) {
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "missing bearer api key, get one with /apikey bot command")
+		return db.User{}, false
+	}
+	user, ok := s.store.FindByAPIKey(strings.TrimSpace(key))
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid api key")
+		return db.User{}, false
+	}
+	if user.Banned {
+		writeError(w, http.StatusForbidden, "user is banned")
+		return db.User{}, false
+	}
+	if user.DialogStatus != db.StatusDialog {
+		writeError(w, http.StatusForbidden, "finish bot setup (key, model and language) before using the api")
+		return db.User{}, false
+	}
+	return user, true
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	user, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+	resp := modelsResponse{Object: "list", Data: []model{}}
+	for _, id := range s.models(user.AiSession.GptKey, user.Endpoint(s.ai_endpoint)) {
+		resp.Data = append(resp.Data, model{ID: id, Object: "model", OwnedBy: "hellper"})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	user, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+	var req chatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	history, prompt, err := splitPrompt(req.Messages)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	model := req.Model
+	if model == "" {
+		model = user.AiSession.GptModel
+	}
+	if s.limiter != nil {
+		if err := s.limiter.AllowRequest(user.ID); err != nil {
+			writeError(w, http.StatusTooManyRequests, err.Error())
+			return
+		}
+	}
+
+	resp := chatCompletionResponse{
+		ID:      newCompletionID(),
+		Created: time.Now().Unix(),
+		Model:   model,
+	}
+	var stream *sseStream
+	if req.Stream {
+		stream, err = newSSEStream(w, resp)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	answer, err := s.run(r, user, model, history, prompt, stream)
+	if req.Stream {
+		// headers are already sent, the only way to report error is to put it into the stream
+		if err != nil {
+			stream.WriteChunk([]byte("\n" + err.Error()))
+		}
+		stream.Finish()
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	stop := "stop"
+	resp.Object = "chat.completion"
+	resp.Choices = []chatCompletionChoice{{
+		Message:      &chatMessage{Role: "assistant", Content: messageText(answer)},
+		FinishReason: &stop,
+	}}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// run puts generation into the queue shared with the bot and waits for the answer
+func (s *Server) run(r *http.Request, user db.User, model string, history []llms.MessageContent, prompt string, stream *sseStream) (string, error) {
+	var answer string
+	var err error
+	done := make(chan struct{})
+	var streamer langchain.Streamer
+	if stream != nil {
+		streamer = stream
+	}
+	admin := false
+	if s.admins != nil {
+		_, admin = s.admins.Get(user.ID)
+	}
+	s.scheduler.Submit(langchain.Job{
+		ChatID:   user.ID,
+		Priority: admin,
+		Run: func() {
+			defer close(done)
+			if r.Context().Err() != nil {
+				// client is gone while request was waiting in queue
+				err = r.Context().Err()
+				return
+			}
+			answer, err = s.complete(user, model, history, prompt, streamer)
+		},
+	})
+	<-done
+	if err != nil {
+		log.Printf("httpapi: generation for user %d failed: %v\n", user.ID, err)
+	}
+	return answer, err
+}
+
+func newCompletionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("httpapi: could not write response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	var e apiError
+	e.Error.Message = message
+	e.Error.Type = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	writeJSON(w, status, e)
+}
@@ -0,0 +1,214 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/config"
+	db "github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/langchain"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// fakeLimiter allows requests while it has them
+type fakeLimiter struct{ requests int }
+
+func (l *fakeLimiter) AllowRequest(chatID int64) error {
+	if l.requests == 0 {
+		return errors.New("requests quota is used")
+	}
+	l.requests--
+	return nil
+}
+
+func (l *fakeLimiter) AddTokens(chatID int64, tokens int) {}
+
+func newTestServer(t *testing.T, limiter ...Limiter) *httptest.Server {
+	store := db.NewMemoryStore()
+	store.Save(db.User{
+		ID:           42,
+		DialogStatus: db.StatusDialog,
+		APIKey:       "hlp-test",
+		AiSession:    db.AiSession{GptKey: "localai-key", GptModel: "default-model"},
+	})
+	store.Save(db.User{ID: 43, DialogStatus: db.StatusAwaitingKey, APIKey: "hlp-new"})
+	store.Save(db.User{ID: 44, DialogStatus: db.StatusDialog, APIKey: "hlp-banned", Banned: true})
+
+	s := NewServer(store, langchain.NewScheduler(1), "http://localai")
+	s.models = func(api_token, ai_endpoint string) []string {
+		return []string{"default-model", "other-model"}
+	}
+	s.complete = func(user db.User, model string, history []llms.MessageContent, prompt string, stream langchain.Streamer) (string, error) {
+		if user.AiSession.GptKey != "localai-key" || model != "default-model" || len(history) != 1 {
+			t.Errorf("unexpected agent call: key %q, model %q, history %v", user.AiSession.GptKey, model, history)
+		}
+		if stream != nil {
+			stream.WriteChunk([]byte("pong"))
+		}
+		return "pong", nil
+	}
+	if len(limiter) > 0 {
+		s.UseLimiter(limiter[0])
+	}
+	mux := http.NewServeMux()
+	s.Register(mux)
+	return httptest.NewServer(mux)
+}
+
+func post(t *testing.T, url, key, body string) *http.Response {
+	req, _ := http.NewRequest(http.MethodPost, url+"/v1/chat/completions", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+const pingRequest = `{"messages":[{"role":"system","content":"be short"},{"role":"user","content":[{"type":"text","text":"ping"}]}]}`
+
+func TestChatCompletions(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	for key, status := range map[string]int{"": 401, "hlp-wrong": 401, "hlp-new": 403, "hlp-banned": 403} {
+		resp := post(t, srv.URL, key, pingRequest)
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatalf("key %q: expected %d, got %d", key, status, resp.StatusCode)
+		}
+	}
+
+	resp := post(t, srv.URL, "hlp-test", pingRequest)
+	defer resp.Body.Close()
+	var completion chatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatal(err)
+	}
+	if completion.Object != "chat.completion" || completion.Model != "default-model" ||
+		len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "pong" {
+		t.Fatalf("unexpected completion %+v", completion)
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	resp := post(t, srv.URL, "hlp-test", strings.Replace(pingRequest, `{"messages"`, `{"stream":true,"messages"`, 1))
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"delta":{"content":"pong"}`) || !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Fatalf("unexpected stream:\n%s", body)
+	}
+}
+
+func TestChatCompletionsQuota(t *testing.T) {
+	srv := newTestServer(t, &fakeLimiter{requests: 1})
+	defer srv.Close()
+
+	for _, status := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		resp := post(t, srv.URL, "hlp-test", pingRequest)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatalf("expected %d, got %d: %s", status, resp.StatusCode, body)
+		}
+	}
+}
+
+// fakeAdmins are admins from config
+type fakeAdmins []int64
+
+func (a fakeAdmins) Get(id int64) (config.Admin, bool) {
+	for _, admin := range a {
+		if admin == id {
+			return config.Admin{ID: id}, true
+		}
+	}
+	return config.Admin{}, false
+}
+
+func TestAdminsGoFirst(t *testing.T) {
+	store := db.NewMemoryStore()
+	for id, key := range map[int64]string{1: "hlp-busy", 2: "hlp-stale-admin", 3: "hlp-admin"} {
+		// Admin flag of the user row is not a source of admin rights
+		store.Save(db.User{ID: id, DialogStatus: db.StatusDialog, APIKey: key, Admin: id == 2})
+	}
+	scheduler := langchain.NewScheduler(1)
+	s := NewServer(store, scheduler, "http://localai").UseAdmins(fakeAdmins{3})
+	started, release := make(chan struct{}), make(chan struct{})
+	var order []int64
+	s.complete = func(user db.User, model string, history []llms.MessageContent, prompt string, stream langchain.Streamer) (string, error) {
+		order = append(order, user.ID)
+		if user.ID == 1 {
+			close(started)
+			<-release
+		}
+		return "pong", nil
+	}
+	mux := http.NewServeMux()
+	s.Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	request := func(key string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			post(t, srv.URL, key, pingRequest).Body.Close()
+		}()
+	}
+	request("hlp-busy")
+	<-started
+	request("hlp-stale-admin")
+	for scheduler.Len() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	request("hlp-admin")
+	for scheduler.Len() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if len(order) != 3 || order[1] != 3 || order[2] != 2 {
+		t.Errorf("admin from config must go first, order %v", order)
+	}
+}
+
+func TestModels(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer hlp-test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var models modelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		t.Fatal(err)
+	}
+	if len(models.Data) != 2 || models.Data[1].ID != "other-model" {
+		t.Fatalf("unexpected models %+v", models)
+	}
+}
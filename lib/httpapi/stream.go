@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// sseStream sends agent answer as server-sent events in OpenAI chat.completion.chunk format
+type sseStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	chunk   chatCompletionResponse
+}
+
+func newSSEStream(w http.ResponseWriter, resp chatCompletionResponse) (*sseStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming is not supported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	resp.Object = "chat.completion.chunk"
+	s := &sseStream{w: w, flusher: flusher, chunk: resp}
+	s.send(chatDelta{Role: "assistant"}, nil)
+	return s, nil
+}
+
+func (s *sseStream) send(delta chatDelta, finishReason *string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunk.Choices = []chatCompletionChoice{{Delta: &delta, FinishReason: finishReason}}
+	data, _ := json.Marshal(s.chunk)
+	fmt.Fprintf(s.w, "data: %s\n\n", data)
+	s.flusher.Flush()
+}
+
+// Reset is called when llm starts a new generation, text already sent to client can't be taken back
+func (s *sseStream) Reset() {}
+
+func (s *sseStream) WriteChunk(chunk []byte) {
+	s.send(chatDelta{Content: string(chunk)}, nil)
+}
+
+// Finish sends the last chunk and end of stream marker
+func (s *sseStream) Finish() {
+	stop := "stop"
+	s.send(chatDelta{}, &stop)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprint(s.w, "data: [DONE]\n\n")
+	s.flusher.Flush()
+}
@@ -0,0 +1,55 @@
+package langchain
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/config"
+)
+
+var (
+	trustMu sync.RWMutex
+	// trusted are endpoints from config, see TrustEndpoints
+	trusted      = map[string]bool{"": true, endpointKey(config.OpenAI("").Endpoint): true}
+	allowPrivate bool
+)
+
+func endpointKey(endpoint string) string {
+	return strings.TrimRight(endpoint, "/")
+}
+
+// TrustEndpoints sets endpoints from config: the default one, failover endpoints and shared providers.
+// Other endpoints are own providers of users, requests to them can't reach loopback and private network addresses
+// unless ai.AllowPrivateProviders is set. Openai is always trusted.
+func TrustEndpoints(ai config.AI) {
+	trustMu.Lock()
+	defer trustMu.Unlock()
+	trusted = map[string]bool{"": true, endpointKey(config.OpenAI("").Endpoint): true}
+	for _, endpoint := range append([]string{ai.Endpoint}, ai.Failover.Endpoints...) {
+		trusted[endpointKey(endpoint)] = true
+	}
+	for _, p := range ai.Providers {
+		trusted[endpointKey(p.Endpoint)] = true
+	}
+	allowPrivate = ai.AllowPrivateProviders
+}
+
+// Trusted reports whether requests to the endpoint may reach private addresses: it's from config
+// or ai.AllowPrivateProviders is set, see TrustEndpoints
+func Trusted(endpoint string) bool {
+	trustMu.RLock()
+	defer trustMu.RUnlock()
+	return allowPrivate || trusted[endpointKey(endpoint)]
+}
+
+// HTTPClient returns client for requests to the endpoint and urls it returns (e.g. of generated images),
+// empty endpoint means openai. Client of an endpoint which is not Trusted fails to connect
+// to private addresses with agent.ErrPrivateAddress.
+func HTTPClient(endpoint string) *http.Client {
+	if Trusted(endpoint) {
+		return http.DefaultClient
+	}
+	return agent.PublicClient(0)
+}
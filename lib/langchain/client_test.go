@@ -0,0 +1,43 @@
+package langchain
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/config"
+)
+
+func TestHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	defer TrustEndpoints(config.AI{})
+
+	get := func() error {
+		resp, err := HTTPClient(server.URL).Get(server.URL + "/v1/models")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	TrustEndpoints(config.AI{Endpoint: "http://localai:8080"})
+	if err := get(); !errors.Is(err, agent.ErrPrivateAddress) {
+		t.Errorf("own endpoint of user must not reach loopback, got %v", err)
+	}
+	if HTTPClient("") != http.DefaultClient || HTTPClient("https://api.openai.com/") != http.DefaultClient {
+		t.Error("openai must be trusted")
+	}
+
+	TrustEndpoints(config.AI{Providers: []config.Provider{{Name: "team", Type: "localai", Endpoint: server.URL + "/"}}})
+	if err := get(); err != nil {
+		t.Errorf("shared provider from config must be trusted, got %v", err)
+	}
+
+	TrustEndpoints(config.AI{AllowPrivateProviders: true})
+	if err := get(); err != nil {
+		t.Errorf("private providers are allowed, got %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"maps"
 
 	db "github.com/JackBekket/hellper/lib/database"
 	"github.com/tmc/langchaingo/llms"
@@ -12,7 +13,18 @@ import (
 )
 
 
-type ChainCallbackHandler struct{}
+type ChainCallbackHandler struct {
+	// stream receives generated tokens, nil if answer is not streamed
+	stream Streamer
+	// chatID is owner of the session, usage is recorded by db.UpdateSessionUsage unless it's 0
+	chatID int64
+	// usage of all responses of the turn, agent calls llm more than once when it uses tools
+	usage map[string]int
+}
+
+func NewChainCallbackHandler(chatID int64, stream Streamer) *ChainCallbackHandler {
+	return &ChainCallbackHandler{stream: stream, chatID: chatID}
+}
 
 
 
@@ -48,7 +60,9 @@ func (h *ChainCallbackHandler) HandleLLMError(ctx context.Context, err error) {
 
 // HandleLLMGenerateContentStart implements callbacks.Handler.
 func (h *ChainCallbackHandler) HandleLLMGenerateContentStart(ctx context.Context, ms []llms.MessageContent) {
-	//panic("unimplemented")
+	if h.stream != nil {
+		h.stream.Reset()
+	}
 }
 
 // HandleLLMStart implements callbacks.Handler.
@@ -68,7 +82,9 @@ func (h *ChainCallbackHandler) HandleRetrieverStart(ctx context.Context, query s
 
 // HandleStreamingFunc implements callbacks.Handler.
 func (h *ChainCallbackHandler) HandleStreamingFunc(ctx context.Context, chunk []byte) {
-	//panic("unimplemented")
+	if h.stream != nil {
+		h.stream.WriteChunk(chunk)
+	}
 }
 
 // HandleToolEnd implements callbacks.Handler.
@@ -94,26 +110,27 @@ func (h *ChainCallbackHandler) HandleText(ctx context.Context, text string) {
 
 func (h *ChainCallbackHandler) HandleLLMGenerateContentEnd(ctx context.Context, res *llms.ContentResponse) {
 
-	LogResponseContentChoice(ctx,res)	
+	usage := LogResponseContentChoice(ctx,res)
+	if h.chatID == 0 {
+		return
+	}
+	if h.usage == nil {
+		h.usage = make(map[string]int)
+	}
+	for key, tokens := range usage {
+		h.usage[key] += tokens
+	}
+	// copy, the map is still written by next responses of the turn
+	db.UpdateSessionUsage(h.chatID, maps.Clone(h.usage))
 }
 
-func LogResponseContentChoice(ctx context.Context,resp *llms.ContentResponse) {
+// LogResponseContentChoice logs the response and returns its usage: tokens and number of requested tool calls
+func LogResponseContentChoice(ctx context.Context,resp *llms.ContentResponse) map[string]int {
 	//choice *llms.ContentChoice
 	choice := resp.Choices[0]
 	log.Println("Content: ", choice.Content)
 	log.Println("Stop Reason: ", choice.StopReason)
 
-	log.Println("Context: ", ctx)
-	
-	//Get user from context
-	user, ok := ctx.Value("user").(db.User)
-	if !ok {
-	  log.Println("No user in context")
-	  //log.Println
-	  return
-	}
-	//chatID := user.ID
-
 
 
 	// GenerationInfo is a map that could contain complex/nested structures,
@@ -122,7 +139,7 @@ func LogResponseContentChoice(ctx context.Context,resp *llms.ContentResponse) {
 	genInfo, err := json.Marshal(choice.GenerationInfo)
 	if err != nil {
 		log.Println("Error marshaling GenerationInfo: ", err)
-		return
+		return nil
 	}
 	log.Println("Generation Info: ", string(genInfo))
 
@@ -138,26 +155,21 @@ func LogResponseContentChoice(ctx context.Context,resp *llms.ContentResponse) {
 	total_tokens_str := choice.GenerationInfo["TotalTokens"]
 
 
-	// type assertion (string --> int)
+	// type assertion (any --> int), endpoints which don't report usage leave zeros
 	pt, ok := promt_tokens_str.(int)
 	if !ok {
-  	log.Println("Error: value is not a string")
-  	return
+		log.Println("no token usage in the response")
+	}
+	ct, _ := completion_tokens_str.(int)
+	tt, _ := total_tokens_str.(int)
+
+	usage := map[string]int{
+		"Total":      tt,
+		"Promt":      pt,
+		"Completion": ct,
+		// tool calls are accounted as rag usage
+		"ToolCalls": len(choice.ToolCalls),
 	}
-	ct, ok := completion_tokens_str.(int)
-	tt, ok := total_tokens_str.(int)
-	
-		  // Update the user's usage information.
-		  usage := map[string]int{
-			"Total": tt,
-			"Promt": pt,
-			"Completion": ct,
-		  }
-		
-		  // Save the user usage back to the database -- it's will not update user info, but stored it in separate structure to avoide race condition
-		  db.UpdateSessionUsage(user.ID,usage)
-
-
 
 	// Note: Since FuncCall is a pointer to a schema.FunctionCall, ensure you check for nil to avoid panics.
 	if choice.FuncCall != nil {
@@ -167,4 +179,5 @@ func LogResponseContentChoice(ctx context.Context,resp *llms.ContentResponse) {
 	} else {
 		log.Println("No Function Call requested.")
 	}
+	return usage
 }
\ No newline at end of file
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 
+	db "github.com/JackBekket/hellper/lib/database"
 	"github.com/tmc/langchaingo/llms"
 
 	//"github.com/tmc/langchaingo/llms/options"
@@ -20,9 +21,13 @@ import (
 		Below is an instruction that describes a task. Write a response that appropriately completes the request.
 	    Instruction: {{.Input}}
 	    Response:
+
+	Token usage is kept by db.UpdateSessionUsage under chatID.
 */
-func GenerateContentInstruction(base_url string, promt string, model_name string, api_token string, network string, options ...llms.CallOption) (string, error) {
+func GenerateContentInstruction(chatID int64, base_url string, promt string, model_name string, api_token string, network string, options ...llms.CallOption) (string, error) {
 	ctx := context.Background()
+	cb := NewChainCallbackHandler(chatID, nil)
+	db.UpdateSessionUsage(chatID, nil)
 	var result string
 	if network == "local" {
 		llm, err := openai.New(
@@ -31,6 +36,8 @@ func GenerateContentInstruction(base_url string, promt string, model_name string
 			openai.WithBaseURL(base_url),
 			openai.WithModel(model_name),
 			openai.WithAPIVersion("v1"),
+			openai.WithCallback(cb),
+			openai.WithHTTPClient(HTTPClient(base_url)),
 		)
 		if err != nil {
 			log.Fatal(err)
@@ -49,6 +56,7 @@ func GenerateContentInstruction(base_url string, promt string, model_name string
 		llm, err := openai.New(
 			openai.WithToken(api_token),
 			openai.WithModel(model_name),
+			openai.WithCallback(cb),
 		)
 		if err != nil {
 			log.Fatal(err)
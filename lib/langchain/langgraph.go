@@ -1,89 +1,80 @@
 package langchain
 
 import (
+	"context"
+
 	"github.com/JackBekket/hellper/lib/agent"
 	db "github.com/JackBekket/hellper/lib/database"
 
+	"github.com/tmc/langchaingo/llms"
 	//"github.com/tmc/langchaingo/llms/options"
 	"github.com/tmc/langchaingo/llms/openai"
 )
 
 
-func RunNewAgent(api_token string, model_name string, base_url string, user_promt string) (*db.ChatSessionGraph,string ,error) {
-	cb := &ChainCallbackHandler{}
-
+// newLLM creates client of the endpoint, empty base_url means openai.
+// Own endpoints of users can't reach private addresses, see HTTPClient.
+func newLLM(api_token string, model_name string, base_url string, cb *ChainCallbackHandler) (*openai.LLM, error) {
 	if base_url == "" {
-		llm, err := openai.New(
-			openai.WithToken(api_token),
-			openai.WithModel(model_name),
-			openai.WithCallback(cb),
-		)
-		if err != nil {
-			return nil, "error",err
-		}
-		dialog_state, output_text := agent.RunThread(user_promt,*llm)
-		//last_msg := dialog_state[len(dialog_state)-1]
-		
-
-		return &db.ChatSessionGraph{
-			ConversationBuffer: dialog_state,
-		}, output_text ,nil
-	} else {
-		llm, err := openai.New(
+		return openai.New(
 			openai.WithToken(api_token),
 			openai.WithModel(model_name),
-			//openai.WithBaseURL("http://localhost:8080"),
-			openai.WithBaseURL(base_url),
-			openai.WithAPIVersion("v1"),
 			openai.WithCallback(cb),
 		)
-		if err != nil {
-			return nil,"error", err
-		}
-
-		dialog_state, output_text := agent.RunThread(user_promt,*llm)
-		return &db.ChatSessionGraph{
-			ConversationBuffer: dialog_state,
-		}, output_text ,nil
 	}
+	return openai.New(
+		openai.WithToken(api_token),
+		openai.WithModel(model_name),
+		//openai.WithBaseURL("http://localhost:8080"),
+		openai.WithBaseURL(base_url),
+		openai.WithAPIVersion("v1"),
+		openai.WithCallback(cb),
+		openai.WithHTTPClient(HTTPClient(base_url)),
+	)
 }
 
+// runThread runs agent on base_url, endpoints of the pool (see SetEndpointPool) replace it while it's down.
+// Only requests to the model are retried on other endpoints, tools the agent already called are not called again.
+func runThread(ctx context.Context, cb *ChainCallbackHandler, api_token string, model_name string, base_url string, user_prompt string, history ...llms.MessageContent) (*db.ChatSessionGraph, string, error) {
+	llm, err := newLLM(api_token, model_name, base_url, cb)
+	if err != nil {
+		return nil, "error", err
+	}
+	ctx = agent.WithModelFailover(ctx, func(ctx context.Context, call func(model openai.LLM) error) error {
+		return withFailover(ctx, base_url, model_name, func(endpoint string) error {
+			if endpoint == base_url {
+				return call(*llm)
+			}
+			llm, err := newLLM(api_token, model_name, endpoint, cb)
+			if err != nil {
+				return err
+			}
+			return call(*llm)
+		})
+	})
+	dialog_state, output_text, err := agent.RunThread(ctx, user_prompt, *llm, history...)
+	if err != nil {
+		return nil, "error", err
+	}
+	return &db.ChatSessionGraph{
+		ConversationBuffer: dialog_state,
+	}, output_text, nil
+}
 
-func ContinueAgent(api_token string, model_name string, base_url string, user_prompt string,state *db.ChatSessionGraph) (*db.ChatSessionGraph,string ,error)  {
+func RunNewAgent(api_token string, model_name string, base_url string, user_promt string) (*db.ChatSessionGraph,string ,error) {
 	cb := &ChainCallbackHandler{}
-
-	if base_url == "" {
-		llm, err := openai.New(
-			openai.WithToken(api_token),
-			openai.WithModel(model_name),
-			openai.WithCallback(cb),
-		)
-		if err != nil {
-			return nil, "error",err
-		}
-		dialog_state, output_text := agent.RunThread(user_prompt,*llm,state.ConversationBuffer...)
-		
-		return &db.ChatSessionGraph{
-			ConversationBuffer: dialog_state,
-		}, output_text ,nil
-	} else {
-		llm, err := openai.New(
-			openai.WithToken(api_token),
-			openai.WithModel(model_name),
-			//openai.WithBaseURL("http://localhost:8080"),
-			openai.WithBaseURL(base_url),
-			openai.WithAPIVersion("v1"),
-			openai.WithCallback(cb),
-		)
-		if err != nil {
-			return nil,"error", err
-		}
-
-		dialog_state, output_text := agent.RunThread(user_prompt,*llm,state.ConversationBuffer...)
-		return &db.ChatSessionGraph{
-			ConversationBuffer: dialog_state,
-		}, output_text ,nil
-	}
+	return runThread(context.Background(), cb, api_token, model_name, base_url, user_promt)
 }
 
 
+// ContinueAgent runs next turn of the dialog, stream (can be nil) receives answer tokens while they are generated.
+// Token usage of the turn is kept by db.UpdateSessionUsage under chatID.
+// Dialogs on the default endpoint fail over to other endpoints of the pool, ErrEndpointsDown means none of them answered.
+// ctx is passed to agent tools, e.g. agent.WithImageSender lets the agent send images to the chat.
+func ContinueAgent(ctx context.Context, chatID int64, api_token string, model_name string, base_url string, user_prompt string,state *db.ChatSessionGraph, stream Streamer) (*db.ChatSessionGraph,string ,error)  {
+	cb := NewChainCallbackHandler(chatID, stream)
+	// usage of previous turn must not be taken for this one if endpoint doesn't report usage
+	db.UpdateSessionUsage(chatID, nil)
+
+	return runThread(ctx, cb, api_token, model_name, base_url, user_prompt, state.ConversationBuffer...)
+}
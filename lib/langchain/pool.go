@@ -0,0 +1,258 @@
+package langchain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/config"
+)
+
+// ErrEndpointsDown is returned (wrapping the last error) when generation failed on every try,
+// it means the endpoints are unreachable or restarting, not that the dialog is broken.
+var ErrEndpointsDown = errors.New("ai endpoints are unavailable")
+
+// timeout of a single health check
+const healthCheckTimeout = 5 * time.Second
+
+type poolEndpoint struct {
+	url     string
+	checked bool // false until the first health check
+	healthy bool
+	models  map[string]bool
+}
+
+// serves reports whether endpoint can be used for the model
+func (e *poolEndpoint) serves(model string) bool {
+	return e.healthy && (model == "" || e.models[model])
+}
+
+// EndpointPool is the default LocalAI endpoint with its failover endpoints (config.Failover).
+//
+// Every endpoint is checked with /v1/models. Generation goes to the first healthy endpoint serving the model,
+// failed generation is retried with backoff on the next one. Endpoints which failed are tried last,
+// so pool still works if health checks are outdated.
+type EndpointPool struct {
+	client   *http.Client
+	key      string
+	retries  int
+	backoff  time.Duration
+	interval time.Duration
+
+	mu        sync.Mutex
+	endpoints []*poolEndpoint
+}
+
+// NewEndpointPool returns pool of ai.Endpoint and failover endpoints, key is used for health checks.
+// Call Run to check endpoints in background.
+func NewEndpointPool(ai config.AI) *EndpointPool {
+	p := &EndpointPool{
+		client:   &http.Client{Timeout: healthCheckTimeout},
+		key:      ai.APIKey,
+		retries:  ai.Failover.Retries,
+		backoff:  ai.Failover.Backoff,
+		interval: ai.Failover.HealthInterval,
+	}
+	for _, u := range append([]string{ai.Endpoint}, ai.Failover.Endpoints...) {
+		p.endpoints = append(p.endpoints, &poolEndpoint{url: u})
+	}
+	return p
+}
+
+// Run checks endpoints right away and then every health interval until ctx is done
+func (p *EndpointPool) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check requests models of every endpoint and updates their state
+func (p *EndpointPool) Check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range p.endpoints {
+		wg.Add(1)
+		go func(e *poolEndpoint) {
+			defer wg.Done()
+			models, err := p.models(ctx, e.url)
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if err != nil && (e.healthy || !e.checked) {
+				log.Printf("endpoint %s is down: %v\n", e.url, err)
+			} else if err == nil && !e.healthy {
+				log.Printf("endpoint %s is up, %d models\n", e.url, len(models))
+			}
+			e.checked = true
+			e.healthy = err == nil
+			if err == nil {
+				e.models = models
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (p *EndpointPool) models(ctx context.Context, endpoint string) (map[string]bool, error) {
+	urlPath, err := url.JoinPath(endpoint, "v1", "models")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.key)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	modelsResp := OpenAIModelsResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
+		return nil, fmt.Errorf("parsing models: %w", err)
+	}
+	models := map[string]bool{}
+	for _, obj := range modelsResp.Data {
+		models[obj.ID] = true
+	}
+	return models, nil
+}
+
+// Has reports whether endpoint belongs to the pool
+func (p *EndpointPool) Has(endpoint string) bool {
+	for _, e := range p.endpoints {
+		if e.url == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// Candidates returns endpoints to try for the model in order:
+// healthy ones serving the model, not checked yet, and failed ones as the last resort.
+// Healthy endpoints without the model are skipped, unless no endpoint lists the model.
+func (p *EndpointPool) Candidates(model string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var serving, unknown, failed []string
+	for _, e := range p.endpoints {
+		switch {
+		case e.serves(model):
+			serving = append(serving, e.url)
+		case !e.checked:
+			unknown = append(unknown, e.url)
+		case !e.healthy:
+			failed = append(failed, e.url)
+		}
+	}
+	candidates := append(append(serving, unknown...), failed...)
+	if len(candidates) == 0 {
+		// let the endpoint itself report unknown model
+		for _, e := range p.endpoints {
+			candidates = append(candidates, e.url)
+		}
+	}
+	return candidates
+}
+
+// markDown marks endpoint as failed until the next successful health check
+func (p *EndpointPool) markDown(endpoint string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.endpoints {
+		if e.url == endpoint {
+			e.checked = true
+			e.healthy = false
+		}
+	}
+}
+
+// Do runs fn with endpoints serving the model until it succeeds.
+// Errors which can't be fixed by another endpoint (bad request, wrong key) are returned right away,
+// ErrEndpointsDown is returned when all tries failed.
+func (p *EndpointPool) Do(ctx context.Context, model string, fn func(endpoint string) error) error {
+	backoff := p.backoff
+	var err error
+	for try := 0; try <= p.retries; try++ {
+		if try > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		endpoint := p.Candidates(model)[0]
+		if err = fn(endpoint); err == nil {
+			return nil
+		}
+		if !retryable(err) {
+			return err
+		}
+		log.Printf("generation on %s failed (try %d of %d): %v\n", endpoint, try+1, p.retries+1, err)
+		p.markDown(endpoint)
+	}
+	return fmt.Errorf("%w: %w", ErrEndpointsDown, err)
+}
+
+var statusCode = regexp.MustCompile(`status code: (\d{3})`)
+
+// retryable reports whether err is caused by endpoint being unavailable: network errors,
+// 5xx and 404 (model is not loaded on the node) responses
+func retryable(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// openai client reports http errors as text only
+	match := statusCode.FindStringSubmatch(err.Error())
+	if match == nil {
+		return false
+	}
+	code, _ := strconv.Atoi(match[1])
+	return code >= 500 || code == http.StatusNotFound
+}
+
+var (
+	poolMu sync.RWMutex
+	pool   *EndpointPool
+)
+
+// SetEndpointPool makes ContinueAgent and RunNewAgent fail over between endpoints of the pool,
+// requests to endpoints outside of the pool (own providers of users, openai) are not affected
+func SetEndpointPool(p *EndpointPool) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	pool = p
+}
+
+// withFailover runs fn on base_url or, if it's in the endpoint pool, on endpoints of the pool.
+// Retries stop when ctx is done.
+func withFailover(ctx context.Context, base_url, model string, fn func(endpoint string) error) error {
+	poolMu.RLock()
+	p := pool
+	poolMu.RUnlock()
+	if p == nil || base_url == "" || !p.Has(base_url) {
+		return fn(base_url)
+	}
+	return p.Do(ctx, model, fn)
+}
@@ -0,0 +1,233 @@
+package langchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/agent"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
+	db "github.com/JackBekket/hellper/lib/database"
+)
+
+// fakeLocalAI serves models list and answers every chat completion with answer
+func fakeLocalAI(t *testing.T, answer string, models ...string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		data := []string{}
+		for _, m := range models {
+			data = append(data, fmt.Sprintf(`{"id":%q,"object":"model"}`, m))
+		}
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(data, ","))
+	})
+	chat := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":%q}}]}\n\n", answer)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprintf(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":%q},"finish_reason":"stop"}]}`, answer)
+	})
+	// LocalAI serves openai api with and without /v1
+	mux.Handle("/v1/chat/completions", chat)
+	mux.Handle("/chat/completions", chat)
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// downEndpoint returns url nothing listens on
+func downEndpoint(t *testing.T) string {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	return s.URL
+}
+
+func newTestPool(endpoint string, failover ...string) *EndpointPool {
+	return NewEndpointPool(config.AI{
+		Endpoint: endpoint,
+		Failover: config.Failover{Endpoints: failover, Retries: 2, Backoff: time.Millisecond, HealthInterval: time.Minute},
+	})
+}
+
+func TestPoolCandidates(t *testing.T) {
+	head := downEndpoint(t)
+	other := fakeLocalAI(t, "", "llama")
+	worker := fakeLocalAI(t, "", "gemma", "llama")
+	p := newTestPool(head, other.URL, worker.URL)
+
+	if got := p.Candidates("gemma"); got[0] != head || len(got) != 3 {
+		t.Fatalf("endpoints must be tried in config order before health check, got %v", got)
+	}
+	p.Check(context.Background())
+	got := p.Candidates("gemma")
+	if len(got) != 2 || got[0] != worker.URL || got[1] != head {
+		t.Errorf("worker serving the model must go first and down head last, got %v", got)
+	}
+	if got := p.Candidates("mistral"); len(got) != 1 || got[0] != head {
+		t.Errorf("only endpoints in unknown state can serve unlisted model, got %v", got)
+	}
+}
+
+func TestPoolDo(t *testing.T) {
+	p := newTestPool("http://head", "http://worker")
+	tries := []string{}
+	err := p.Do(context.Background(), "llama", func(endpoint string) error {
+		tries = append(tries, endpoint)
+		if endpoint == "http://head" {
+			return errors.New("API returned unexpected status code: 503")
+		}
+		return nil
+	})
+	if err != nil || strings.Join(tries, " ") != "http://head http://worker" {
+		t.Fatalf("must fail over to worker, tries %v, err %v", tries, err)
+	}
+
+	tries = nil
+	err = p.Do(context.Background(), "llama", func(endpoint string) error {
+		tries = append(tries, endpoint)
+		return errors.New("API returned unexpected status code: 400: context is too long")
+	})
+	if err == nil || errors.Is(err, ErrEndpointsDown) || len(tries) != 1 {
+		t.Errorf("bad request must not be retried, tries %v, err %v", tries, err)
+	}
+
+	tries = nil
+	err = p.Do(context.Background(), "llama", func(endpoint string) error {
+		tries = append(tries, endpoint)
+		return refusedErr{}
+	})
+	if !errors.Is(err, ErrEndpointsDown) || len(tries) != 3 {
+		t.Errorf("all retries must be used, tries %v, err %v", tries, err)
+	}
+}
+
+type refusedErr struct{}
+
+func (refusedErr) Error() string   { return "dial tcp: connection refused" }
+func (refusedErr) Timeout() bool   { return false }
+func (refusedErr) Temporary() bool { return true }
+
+func TestContinueAgentFailsOver(t *testing.T) {
+	head := downEndpoint(t)
+	worker := fakeLocalAI(t, "hello from worker", "llama")
+	SetEndpointPool(newTestPool(head, worker.URL))
+	defer SetEndpointPool(nil)
+	TrustEndpoints(config.AI{Endpoint: head, Failover: config.Failover{Endpoints: []string{worker.URL}}})
+	defer TrustEndpoints(config.AI{})
+
+	state, answer, err := ContinueAgent(context.Background(), 1, "key", "llama", head, "hi", &db.ChatSessionGraph{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "hello from worker" || len(state.ConversationBuffer) != 2 {
+		t.Errorf("unexpected answer %q, state %+v", answer, state)
+	}
+
+	// endpoints outside of the pool are not retried
+	_, _, err = ContinueAgent(context.Background(), 1, "key", "llama", downEndpoint(t), "hi", &db.ChatSessionGraph{}, nil)
+	if err == nil || errors.Is(err, ErrEndpointsDown) {
+		t.Errorf("expected plain connection error, got %v", err)
+	}
+}
+
+// drawingLocalAI streams generate_image call until it gets the result of the tool, then answers with answer.
+// down endpoint answers 503 to requests with the result.
+func drawingLocalAI(t *testing.T, answer string, down bool) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		toolResult := strings.Contains(string(body), `"role":"tool"`)
+		if toolResult && down {
+			http.Error(w, "node is restarting", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		if toolResult {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":%q}}]}\n\n", answer)
+		} else {
+			fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_0","type":"function","function":{"name":"generate_image","arguments":"{\"prompt\":\"a cat\"}"}}]}}]}`+"\n\n")
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestFailoverDoesntRepeatTools(t *testing.T) {
+	head := drawingLocalAI(t, "drawn by head", true)
+	worker := drawingLocalAI(t, "drawn by worker", false)
+	SetEndpointPool(newTestPool(head.URL, worker.URL))
+	defer SetEndpointPool(nil)
+	TrustEndpoints(config.AI{Endpoint: head.URL, Failover: config.Failover{Endpoints: []string{worker.URL}}})
+	defer TrustEndpoints(config.AI{})
+
+	sent := 0
+	ctx := agent.WithImageSender(context.Background(), func(ctx context.Context, prompt, size string) error {
+		sent++
+		return nil
+	})
+	_, answer, err := ContinueAgent(ctx, 1, "key", "llama", head.URL, "draw a cat", &db.ChatSessionGraph{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(answer, "drawn by worker") {
+		t.Errorf("worker must finish the turn, got %q", answer)
+	}
+	if sent != 1 {
+		t.Errorf("image must be sent once, sent %d times", sent)
+	}
+}
+
+func TestFailoverStopsWithContext(t *testing.T) {
+	head := downEndpoint(t)
+	SetEndpointPool(NewEndpointPool(config.AI{
+		Endpoint: head,
+		Failover: config.Failover{Retries: 2, Backoff: time.Minute, HealthInterval: time.Minute},
+	}))
+	defer SetEndpointPool(nil)
+	TrustEndpoints(config.AI{Endpoint: head})
+	defer TrustEndpoints(config.AI{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := ContinueAgent(ctx, 1, "key", "llama", head, "hi", &db.ChatSessionGraph{}, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline of the caller, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backoff must stop when context is done")
+	}
+}
+
+func TestErrorMessageKeepsSessionWhileEndpointsAreDown(t *testing.T) {
+	fake := messenger.NewFake("hellper_bot")
+	store := db.NewMemoryStore()
+	user := db.User{ID: 1, DialogStatus: db.StatusDialog}
+	store.Save(user)
+
+	errorMessage(fmt.Errorf("%w: %w", ErrEndpointsDown, refusedErr{}), fake, store, user)
+	if _, ok := store.Get(1); !ok {
+		t.Fatal("user must be kept")
+	}
+	messages := fake.Messages(1)
+	if len(messages) != 1 || !strings.Contains(messages[0].Text, "dialog is kept") {
+		t.Errorf("unexpected messages %+v", messages)
+	}
+}
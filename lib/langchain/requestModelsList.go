@@ -16,7 +16,11 @@ type OpenAIModelsResponse struct {
 	Data []OpenAIDataObject `json:"data"`
 }
 
+// GetModelsList returns models of the endpoint, empty endpoint means openai
 func GetModelsList(api_token, ai_endpoint string) []string {
+	if ai_endpoint == "" {
+		ai_endpoint = "https://api.openai.com"
+	}
 	urlPath, err := url.JoinPath(ai_endpoint, "v1", "models")
 	if err != nil {
 		log.Printf("GetModelsList: error joining path: %v\n", err)
@@ -28,7 +32,7 @@ func GetModelsList(api_token, ai_endpoint string) []string {
 		log.Printf("GetModelsList: error creating request: %v\n", err)
 		return []string{}
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := HTTPClient(ai_endpoint).Do(req)
 	if err != nil {
 		log.Printf("GetModelsList: error doing http request: %v\n", err)
 		return []string{}
@@ -0,0 +1,202 @@
+package langchain
+
+import (
+	"sync"
+)
+
+// Job is a single generation request.
+type Job struct {
+	ChatID int64
+	// Priority jobs (admins) are taken before any other job
+	Priority bool
+	Run      func()
+	// OnPosition is called with 1-based position in queue every time it changes, while job is waiting.
+	OnPosition func(position int)
+	// OnStart is called when job leaves the queue, right before Run
+	OnStart func()
+}
+
+type queuedJob struct {
+	Job
+	position int // last reported position, 0 if not reported yet
+}
+
+// Scheduler runs generation jobs on a fixed number of workers.
+//
+// Jobs of one chat are executed one by one in submission order, chats share workers round-robin,
+// so a user with many messages can't starve others. Priority chats always go first.
+// Position callbacks are delivered from a single goroutine in the order of queue changes.
+type Scheduler struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[int64][]*queuedJob
+	order   []int64 // round-robin order of chats having pending jobs
+	running map[int64]bool
+	idle    int // workers waiting for a job
+	notify  chan []func()
+}
+
+// NewScheduler starts scheduler with given number of workers (at least one).
+func NewScheduler(workers int) *Scheduler {
+	if workers < 1 {
+		workers = 1
+	}
+	s := &Scheduler{
+		pending: make(map[int64][]*queuedJob),
+		running: make(map[int64]bool),
+		notify:  make(chan []func(), 64),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+	go s.notifier()
+	return s
+}
+
+// Submit adds job to the queue and returns immediately.
+// Jobs of one chat run in the order of Submit calls, so bot updates must be submitted from a single goroutine (update loop).
+func (s *Scheduler) Submit(job Job) {
+	s.mu.Lock()
+	if _, ok := s.pending[job.ChatID]; !ok {
+		s.order = append(s.order, job.ChatID)
+	}
+	s.pending[job.ChatID] = append(s.pending[job.ChatID], &queuedJob{Job: job})
+	notes := s.positionsLocked()
+	s.cond.Signal()
+	s.mu.Unlock()
+
+	s.send(notes)
+}
+
+// Len returns number of waiting jobs
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, jobs := range s.pending {
+		n += len(jobs)
+	}
+	return n
+}
+
+func (s *Scheduler) worker() {
+	for {
+		s.mu.Lock()
+		job := s.nextLocked()
+		for job == nil {
+			s.idle++
+			s.cond.Wait()
+			s.idle--
+			job = s.nextLocked()
+		}
+		s.running[job.ChatID] = true
+		notes := []func(){}
+		if job.OnStart != nil {
+			notes = append(notes, job.OnStart)
+		}
+		notes = append(notes, s.positionsLocked()...)
+		s.mu.Unlock()
+
+		s.send(notes)
+		job.Run()
+
+		s.mu.Lock()
+		delete(s.running, job.ChatID)
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// nextLocked removes and returns the first runnable job, nil if there is nothing to run
+func (s *Scheduler) nextLocked() *queuedJob {
+	for _, chatID := range s.linearLocked() {
+		if s.running[chatID] {
+			continue
+		}
+		jobs := s.pending[chatID]
+		job := jobs[0]
+		if len(jobs) == 1 {
+			delete(s.pending, chatID)
+			s.removeFromOrderLocked(chatID)
+		} else {
+			s.pending[chatID] = jobs[1:]
+			// chat was served, move it to the end of round-robin
+			s.removeFromOrderLocked(chatID)
+			s.order = append(s.order, chatID)
+		}
+		return job
+	}
+	return nil
+}
+
+func (s *Scheduler) removeFromOrderLocked(chatID int64) {
+	for i, id := range s.order {
+		if id == chatID {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// linearLocked returns chats in the order their head jobs would be taken: priority chats first, then round-robin order.
+func (s *Scheduler) linearLocked() []int64 {
+	chats := make([]int64, 0, len(s.order))
+	for _, chatID := range s.order {
+		if s.pending[chatID][0].Priority {
+			chats = append(chats, chatID)
+		}
+	}
+	for _, chatID := range s.order {
+		if !s.pending[chatID][0].Priority {
+			chats = append(chats, chatID)
+		}
+	}
+	return chats
+}
+
+// positionsLocked estimates position of every waiting job and returns callbacks for changed ones.
+// Jobs are ordered by rounds: first job of every chat, then second job of every chat and so on.
+// Jobs which are about to be taken by idle workers are not reported, so users don't see queue message for nothing.
+func (s *Scheduler) positionsLocked() []func() {
+	notes := []func(){}
+	chats := s.linearLocked()
+	position := 0
+	for round := 0; ; round++ {
+		found := false
+		for _, chatID := range chats {
+			jobs := s.pending[chatID]
+			if round >= len(jobs) {
+				continue
+			}
+			found = true
+			position++
+			job := jobs[round]
+			if round == 0 && position <= s.idle && !s.running[chatID] {
+				continue
+			}
+			if job.position != position && job.OnPosition != nil {
+				job.position = position
+				callback, pos := job.OnPosition, position
+				notes = append(notes, func() { callback(pos) })
+			}
+		}
+		if !found {
+			return notes
+		}
+	}
+}
+
+func (s *Scheduler) send(notes []func()) {
+	if len(notes) > 0 {
+		s.notify <- notes
+	}
+}
+
+func (s *Scheduler) notifier() {
+	for notes := range s.notify {
+		for _, note := range notes {
+			note()
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package langchain_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JackBekket/hellper/lib/langchain"
+)
+
+func TestSchedulerKeepsChatOrderAndWorkerLimit(t *testing.T) {
+	s := langchain.NewScheduler(2)
+
+	var running, maxRunning int32
+	var mu sync.Mutex
+	got := map[int64][]int{}
+	var wg sync.WaitGroup
+
+	for i := 0; i < 5; i++ {
+		for chatID := int64(1); chatID <= 3; chatID++ {
+			i, chatID := i, chatID
+			wg.Add(1)
+			s.Submit(langchain.Job{
+				ChatID: chatID,
+				Run: func() {
+					defer wg.Done()
+					n := atomic.AddInt32(&running, 1)
+					for {
+						m := atomic.LoadInt32(&maxRunning)
+						if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+							break
+						}
+					}
+					time.Sleep(5 * time.Millisecond)
+					mu.Lock()
+					got[chatID] = append(got[chatID], i)
+					mu.Unlock()
+					atomic.AddInt32(&running, -1)
+				},
+			})
+		}
+	}
+	wg.Wait()
+
+	if maxRunning > 2 {
+		t.Fatalf("expected at most 2 concurrent jobs, got %d", maxRunning)
+	}
+	for chatID, order := range got {
+		for i, v := range order {
+			if v != i {
+				t.Fatalf("chat %d jobs out of order: %v", chatID, order)
+			}
+		}
+	}
+}
+
+func TestSchedulerPriorityAndPositions(t *testing.T) {
+	s := langchain.NewScheduler(1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	s.Submit(langchain.Job{ChatID: 1, Run: func() {
+		close(started)
+		<-release
+	}})
+	<-started
+
+	var mu sync.Mutex
+	order := []int64{}
+	positions := map[int64][]int{}
+	done := make(chan struct{}, 3)
+	lastStarted := make(chan struct{})
+	submit := func(chatID int64, priority bool) {
+		s.Submit(langchain.Job{
+			ChatID:   chatID,
+			Priority: priority,
+			Run: func() {
+				mu.Lock()
+				order = append(order, chatID)
+				mu.Unlock()
+				done <- struct{}{}
+			},
+			OnPosition: func(position int) {
+				mu.Lock()
+				positions[chatID] = append(positions[chatID], position)
+				mu.Unlock()
+			},
+			OnStart: func() {
+				// notifications are ordered, so every position of chat 3 is delivered before its start
+				if chatID == 3 {
+					close(lastStarted)
+				}
+			},
+		})
+	}
+	submit(2, false)
+	submit(3, false)
+	submit(4, true)
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	<-lastStarted
+
+	mu.Lock()
+	defer mu.Unlock()
+	if order[0] != 4 || order[1] != 2 || order[2] != 3 {
+		t.Fatalf("unexpected order %v", order)
+	}
+	// chat 3 was #2, then pushed to #3 by admin, then moved up as queue drained
+	want := []int{2, 3, 2, 1}
+	if len(positions[3]) != len(want) {
+		t.Fatalf("unexpected positions for chat 3: %v", positions[3])
+	}
+	for i := range want {
+		if positions[3][i] != want[i] {
+			t.Fatalf("unexpected positions for chat 3: %v", positions[3])
+		}
+	}
+}
@@ -4,29 +4,28 @@ package langchain
 
 import (
 	"context"
+	"errors"
 	"log"
-	"sync"
 
+	"github.com/JackBekket/hellper/lib/bot/messenger"
 	db "github.com/JackBekket/hellper/lib/database"
-
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-var mu = sync.Mutex{}
-
 type contextKey string
 
 const UserKey contextKey = "user"
 
+// SetupSequenceWithKey makes the first turn in the chosen language and moves user to db.StatusDialog.
+// While endpoints are down (ErrEndpointsDown) user stays in db.StatusAwaitingLanguage and the error is returned,
+// so the caller can show the language menu again. Other errors reset the session (see errorMessage).
 func SetupSequenceWithKey(
-	bot *tgbotapi.BotAPI,
+	bot messenger.Messenger,
+	store db.UserStore,
 	user db.User,
 	language string,
 	ctx context.Context,
 	ai_endpoint string,
-) {
-	mu.Lock()
-	defer mu.Unlock()
+) error {
 	chatID := user.ID
 	gptKey := user.AiSession.GptKey
 	log.Println("user GPT key from session: ", gptKey)
@@ -34,52 +33,33 @@ func SetupSequenceWithKey(
 	//log.Println("user network from session: ", u_network)
 	log.Println("user model from session: ", user.AiSession.GptModel)
 
+	languageCode := 0
 	switch language {
 	case "English":
-		response, probe, err := tryLanguage(user, "", 1, ai_endpoint)
-		if err != nil {
-			errorMessage(err, bot, user)
-		} else {
-
-			msg := tgbotapi.NewMessage(chatID, response)
-			bot.Send(msg)
-			user.DialogStatus = 6
-			user.AiSession.DialogThread = *probe
-			usage := db.GetSessionUsage(user.ID)
-			user.AiSession.Usage = usage
-			//log.Println(user.AiSession.Usage)
-			db.UsersMap[chatID] = user
-		}
+		languageCode = 1
 	case "Russian":
-		response, probe, err := tryLanguage(user, "", 2, ai_endpoint)
-		if err != nil {
-			errorMessage(err, bot, user)
-		} else {
-			msg := tgbotapi.NewMessage(chatID, response)
-			bot.Send(msg)
-			user.AiSession.DialogThread = *probe
-			user.DialogStatus = 6
-			usage := db.GetSessionUsage(user.ID)
-			user.AiSession.Usage = usage
-			log.Println(user.AiSession.Usage)
-			db.UsersMap[chatID] = user
-		}
-	default:
-		response, probe, err := tryLanguage(user, language, 0, ai_endpoint)
-		if err != nil {
-			errorMessage(err, bot, user)
-		} else {
-			msg := tgbotapi.NewMessage(chatID, response)
-			bot.Send(msg)
-			user.AiSession.DialogThread = *probe
-			user.DialogStatus = 6
-			usage := db.GetSessionUsage(user.ID)
-			user.AiSession.Usage = usage
-			//log.Println(user.AiSession.Usage)
-			db.UsersMap[chatID] = user
-		}
+		languageCode = 2
+	}
+	response, probe, err := tryLanguage(user, language, languageCode, ai_endpoint)
+	if errors.Is(err, ErrEndpointsDown) {
+		log.Println("error :", err)
+		messenger.Say(bot, chatID, "AI endpoints are unavailable right now, please choose a language again in a minute.")
+		return err
+	}
+	if err != nil {
+		errorMessage(err, bot, store, user)
+		return err
 	}
 
+	messenger.Say(bot, chatID, response)
+	updateUser(store, chatID, func(u *db.User) {
+		if err := u.SetDialogStatus(db.StatusDialog); err != nil {
+			log.Println(err)
+		}
+		u.AiSession.DialogThread = *probe
+		u.AiSession.Usage = db.GetSessionUsage(chatID)
+	})
+	return nil
 }
 
 // LanguageCode: 0 - default, 1 - Russian, 2 - English
@@ -4,6 +4,7 @@ package langchain
 
 import (
 	"context"
+	"errors"
 	"log"
 	"math/rand"
 	"os"
@@ -11,8 +12,8 @@ import (
 
 	"io/fs"
 
+	"github.com/JackBekket/hellper/lib/bot/messenger"
 	db "github.com/JackBekket/hellper/lib/database"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	//TODO: investigate why meme videos with helper are not sent by this func!
 	// Notifies the user that an error occurred while creating the request.
@@ -21,12 +22,15 @@ import (
 	"sort"
 )
 
-func errorMessage(err error, bot *tgbotapi.BotAPI, user db.User) {
+func errorMessage(err error, bot messenger.Messenger, store db.UserStore, user db.User) {
 	log.Println("error :", err)
-	msg := tgbotapi.NewMessage(user.ID, err.Error())
-	bot.Send(msg)
-	msg = tgbotapi.NewMessage(user.ID, "an error has occured. In order to proceed we need to recreate client and initialize new session")
-	bot.Send(msg)
+	if errors.Is(err, ErrEndpointsDown) {
+		// endpoints are restarting, session is fine and will work once they are back
+		messenger.Say(bot, user.ID, "AI endpoints are unavailable right now, please repeat your message in a minute. Your dialog is kept.")
+		return
+	}
+	messenger.Say(bot, user.ID, err.Error())
+	messenger.Say(bot, user.ID, "an error has occured. In order to proceed we need to recreate client and initialize new session")
 
 	// Send helper video error
 	// Get a list of all files in the media directory
@@ -63,29 +67,26 @@ func errorMessage(err error, bot *tgbotapi.BotAPI, user db.User) {
 	defer videoFile.Close()
 
 	// Create a new video message
-	videoMsg := tgbotapi.NewVideo(user.ID, tgbotapi.FileReader{
+	videoMsg := messenger.File{
 		Name:   randomFile.Name(),
 		Reader: videoFile,
-		//Size: -1, // Let the tgbotapi package determine the size
-	})
+	}
 
 	// Send the video message
-	_, err = bot.Send(videoMsg)
+	err = bot.SendVideo(user.ID, videoMsg)
 	if err != nil {
 		log.Println("Could not send video message:", err)
 	}
 
-	userDb := db.UsersMap
-	delete(userDb, user.ID)
+	if err := store.Delete(user.ID); err != nil {
+		log.Println("error deleting user:", err)
+	}
 
 }
 
 
-func StartDialogSequence(bot *tgbotapi.BotAPI, chatID int64, promt string, ctx context.Context, ai_endpoint string) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	user := db.UsersMap[chatID]
+func StartDialogSequence(bot messenger.Messenger, store db.UserStore, chatID int64, promt string, ctx context.Context, ai_endpoint string) {
+	user, _ := store.Get(chatID)
 
 	gptModel := user.AiSession.GptModel
 	log.Printf(
@@ -98,20 +99,16 @@ func StartDialogSequence(bot *tgbotapi.BotAPI, chatID int64, promt string, ctx c
 
 	thread := user.AiSession.DialogThread
 
-	post_session, resp, err := ContinueAgent(api_key, gptModel, base_url, promt, &thread)
+	stream := NewMessageStream(bot, chatID)
+	post_session, resp, err := ContinueAgent(ctx, chatID, api_key, gptModel, base_url, promt, &thread, stream)
 	if err != nil {
-		errorMessage(err, bot, user)
+		errorMessage(err, bot, store, user)
 	} else {
 
 		log.Println("AI response: ", resp)
-		msg := tgbotapi.NewMessage(chatID, resp)
-		msg.ParseMode = "MARKDOWN"
-		bot.Send(msg)
+		// graph reached END, replace streamed preview with formatted answer
+		stream.Finish(resp)
 
-		user.DialogStatus = 6
-		usage := db.GetSessionUsage(user.ID)
-		user.AiSession.Usage = usage
-		//db.UsersMap[chatID] = user
 
 		//log.Println(history)
 		total_turns := len(thread.ConversationBuffer)
@@ -124,12 +121,24 @@ func StartDialogSequence(bot *tgbotapi.BotAPI, chatID int64, promt string, ctx c
 			}
 		*/
 
-		user.AiSession.DialogThread = *post_session
-		db.UsersMap[chatID] = user
+		// user could be changed (or deleted by /restart) while we were generating, so update only dialog fields
+		updateUser(store, chatID, func(u *db.User) {
+			if err := u.SetDialogStatus(db.StatusDialog); err != nil {
+				log.Println(err)
+			}
+			u.AiSession.DialogThread = *post_session
+			u.AiSession.Usage = db.AddSessionUsage(u.AiSession.Usage, db.GetSessionUsage(chatID))
+		})
 	}
 
 }
 
+func updateUser(store db.UserStore, chatID int64, fn func(u *db.User)) {
+	if _, err := store.Update(chatID, fn); err != nil {
+		log.Println("error updating user:", err)
+	}
+}
+
 /*
 func LogResponse(resp *llms.ContentResponse) {
 	log.Println("full response obj log: ", resp)
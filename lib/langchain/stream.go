@@ -0,0 +1,140 @@
+package langchain
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+)
+
+// telegram rejects messages longer than this (in utf-16 units, but runes are close enough for us)
+const telegramMessageLimit = 4096
+
+// how often streamed message can be edited, telegram starts to throttle bots editing faster than ~1 time per second
+const streamEditInterval = 1500 * time.Millisecond
+
+// Streamer receives llm output while it's generated.
+type Streamer interface {
+	// Reset is called when a new llm generation starts (e.g. after a tool call)
+	Reset()
+	WriteChunk(chunk []byte)
+}
+
+// MessageStream shows llm output while it's generated by editing a single chat message.
+// Chunks come from ChainCallbackHandler.HandleStreamingFunc, the final answer is set by Finish.
+type MessageStream struct {
+	bot    messenger.Messenger
+	chatID int64
+
+	mu        sync.Mutex
+	text      strings.Builder
+	messageID int
+	lastEdit  time.Time
+	shown     string
+}
+
+func NewMessageStream(bot messenger.Messenger, chatID int64) *MessageStream {
+	return &MessageStream{
+		bot:    bot,
+		chatID: chatID,
+	}
+}
+
+// Reset drops buffered text, already shown preview stays until the next edit.
+func (s *MessageStream) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.text.Reset()
+}
+
+// WriteChunk appends chunk and updates telegram message if enough time passed since the last edit.
+func (s *MessageStream) WriteChunk(chunk []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.text.Write(chunk)
+	if time.Since(s.lastEdit) < streamEditInterval {
+		return
+	}
+	s.flushLocked()
+}
+
+func (s *MessageStream) flushLocked() {
+	preview := strings.TrimSpace(s.text.String())
+	if preview == "" {
+		return
+	}
+	if utf8.RuneCountInString(preview) > telegramMessageLimit {
+		// rest of the text will be sent by Finish
+		preview = string([]rune(preview)[:telegramMessageLimit-1]) + "…"
+	}
+	if preview == s.shown {
+		return
+	}
+	s.lastEdit = time.Now()
+
+	if s.messageID == 0 {
+		sent, err := s.bot.SendText(messenger.Text{ChatID: s.chatID, Text: preview})
+		if err != nil {
+			log.Println("stream: could not send message:", err)
+			return
+		}
+		s.messageID = sent
+	} else {
+		err := s.bot.EditText(s.chatID, s.messageID, preview, messenger.ModePlain)
+		if err != nil {
+			log.Println("stream: could not edit message:", err)
+			return
+		}
+	}
+	s.shown = preview
+}
+
+// Finish replaces streamed preview with the final text formatted as markdown.
+// If nothing was streamed (e.g. endpoint doesn't support streaming) the text is sent as a new message.
+func (s *MessageStream) Finish(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := splitMessage(text, telegramMessageLimit)
+	first := parts[0]
+	if s.messageID == 0 {
+		s.sendMarkdown(first)
+	} else {
+		if err := s.bot.EditText(s.chatID, s.messageID, first, messenger.ModeMarkdown); err != nil {
+			// most likely broken markdown, keep plain text then
+			log.Println("stream: could not apply markdown:", err)
+			if first != s.shown {
+				s.bot.EditText(s.chatID, s.messageID, first, messenger.ModePlain)
+			}
+		}
+	}
+	for _, part := range parts[1:] {
+		s.sendMarkdown(part)
+	}
+	s.shown = text
+}
+
+func (s *MessageStream) sendMarkdown(text string) {
+	if _, err := s.bot.SendText(messenger.Text{ChatID: s.chatID, Text: text, ParseMode: messenger.ModeMarkdown}); err != nil {
+		log.Println("stream: could not send markdown, sending plain text:", err)
+		messenger.Say(s.bot, s.chatID, text)
+	}
+}
+
+// splitMessage cuts text into parts not longer than limit runes, preferring to cut on new lines.
+func splitMessage(text string, limit int) []string {
+	parts := []string{}
+	runes := []rune(text)
+	for len(runes) > limit {
+		cut := limit
+		if nl := strings.LastIndex(string(runes[:limit]), "\n"); nl > 0 {
+			cut = utf8.RuneCountInString(string(runes[:limit])[:nl]) + 1
+		}
+		parts = append(parts, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	return append(parts, string(runes))
+}
@@ -0,0 +1,48 @@
+package langchain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+)
+
+func TestMessageStreamEditsSingleMessage(t *testing.T) {
+	fake := messenger.NewFake("hellper_bot")
+	stream := NewMessageStream(fake, 1)
+
+	stream.WriteChunk([]byte("Hel"))
+	// throttled, shown on Finish
+	stream.WriteChunk([]byte("lo"))
+	stream.Finish("Hello *world*")
+
+	messages := fake.Messages(1)
+	if len(messages) != 1 {
+		t.Fatalf("expected one message, got %d", len(messages))
+	}
+	if messages[0].Text != "Hello *world*" || messages[0].ParseMode != messenger.ModeMarkdown {
+		t.Fatalf("unexpected final message %+v", messages[0])
+	}
+}
+
+func TestMessageStreamFallsBackToPlainText(t *testing.T) {
+	fake := messenger.NewFake("hellper_bot")
+	fake.FailMarkdown = true
+	stream := NewMessageStream(fake, 1)
+
+	long := strings.Repeat("a", telegramMessageLimit) + "\nbroken *markdown"
+	stream.Finish(long)
+
+	messages := fake.Messages(1)
+	if len(messages) != 2 {
+		t.Fatalf("expected long text to be split in two messages, got %d", len(messages))
+	}
+	for _, msg := range messages {
+		if msg.ParseMode != messenger.ModePlain {
+			t.Fatalf("expected plain text fallback, got %+v", msg)
+		}
+	}
+	if messages[1].Text != "\nbroken *markdown" {
+		t.Fatalf("unexpected second part %q", messages[1].Text)
+	}
+}
@@ -1,47 +1,34 @@
 package stt
 
 import (
-	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 
+	"github.com/JackBekket/hellper/lib/bot/messenger"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-func HandleVoiceMessage(updateMessage *tgbotapi.Message, bot tgbotapi.BotAPI) (string, error) {
+func HandleVoiceMessage(updateMessage *tgbotapi.Message, bot messenger.Messenger) (string, error) {
 
 	fileID := updateMessage.Voice.FileID
-	fileURL, err := GetFileURL(fileID, bot)
+	content, err := bot.DownloadFile(fileID)
 	if err != nil {
-		log.Println("Error getting file URL:", err)
+		log.Println("Error downloading the file:", err)
 		return "", err
 	}
 	localFilePath := filepath.Join("tmp", "audio", updateMessage.Voice.FileID+".ogg")
-	err = DownloadFile(fileURL, localFilePath)
+	err = os.WriteFile(localFilePath, content, 0o644)
 	if err != nil {
-		log.Println("Error downloading the file:", err)
+		log.Println("Error saving the file:", err)
 		return "", err
 	}
 
 	return localFilePath, nil
 }
 
-func GetFileURL(fileID string, bot tgbotapi.BotAPI) (string, error) {
-
-	fileConfig := tgbotapi.FileConfig{FileID: fileID}
-	file, err := bot.GetFile(fileConfig)
-	if err != nil {
-		return "", err
-	}
-
-	// Telegram serves files via the URL like this:
-	fileURL := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, file.FilePath)
-	return fileURL, nil
-}
-
 func DownloadFile(url, localFilePath string) error {
 	// Create the file
 	out, err := os.Create(localFilePath)
@@ -61,19 +48,3 @@ func DownloadFile(url, localFilePath string) error {
 	_, err = io.Copy(out, resp.Body)
 	return err
 }
-
-// url, model
-func GetEnvsForSST() (string, string) {
-	url := os.Getenv("AI_ENDPOINT")
-	URLSuffix := os.Getenv("VOICE_RECOGNITION_SUFFIX")
-	if URLSuffix == "" {
-		URLSuffix = "/v1/audio/transcriptions"
-	}
-	url += URLSuffix
-
-	model := os.Getenv("VOICE_RECOGNITION_MODEL")
-	if model == "" {
-		model = "whisper-1"
-	}
-	return url, model
-}
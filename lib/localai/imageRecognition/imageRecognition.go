@@ -2,46 +2,29 @@ package imageRecognition
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os"
 
+	"github.com/JackBekket/hellper/lib/bot/messenger"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-func getEnvsForImgRec() (string, string, string) {
-	url := os.Getenv("AI_ENDPOINT")
-	URLSuffix := os.Getenv("IMAGE_RECOGNITION_SUFFIX")
-	if URLSuffix == "" {
-		URLSuffix = "/v1/chat/completions"
-	}
-	url += URLSuffix
-
-	model := os.Getenv("IMAGE_RECOGNITION_MODEL")
-	if model == "" {
-		model = "bunny-llama-3-8b-v"
-	}
-
-	token := os.Getenv("OPENAI_API_KEY")
-	return url, model, token
-
-}
-
-func RecognizeImage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) (string, error) {
+// RecognizeImage asks vision model served at endpoint url what's in the photo (or caption prompt), client sends the request
+func RecognizeImage(bot messenger.Messenger, msg *tgbotapi.Message, endpoint, model, token string, client *http.Client) (string, error) {
 
 	imgLink, err := handleImageMessage(bot, msg)
 	if err != nil {
 		return "", err
 	}
-	endpoint, model, token := getEnvsForImgRec()
 	prompt := "What's in the image?"
 
 	if msg.Caption != "" {
 		prompt = msg.Caption
 	}
-	response, err := imageRecognitionLAI(endpoint, model, token, imgLink, prompt)
+	response, err := imageRecognitionLAI(client, endpoint, model, token, imgLink, prompt)
 	if err != nil {
 		return "", err
 	}
@@ -49,21 +32,23 @@ func RecognizeImage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) (string, error)
 
 }
 
-func handleImageMessage(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) (string, error) {
+// handleImageMessage downloads the photo and returns it as base64 data url,
+// so the AI node doesn't need access to telegram (and bot token doesn't leak into node logs)
+func handleImageMessage(bot messenger.Messenger, msg *tgbotapi.Message) (string, error) {
 
-	file, err := bot.GetFile(tgbotapi.FileConfig{FileID: msg.Photo[0].FileID})
+	// photo sizes are sorted from the smallest thumbnail to the original
+	photo := msg.Photo[len(msg.Photo)-1]
+	content, err := bot.DownloadFile(photo.FileID)
 	if err != nil {
-		return "", fmt.Errorf("could not get file info: %v", err)
+		return "", fmt.Errorf("could not download image: %v", err)
 	}
 
-	fileURL := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", bot.Token, file.FilePath)
+	dataURL := "data:" + http.DetectContentType(content) + ";base64," + base64.StdEncoding.EncodeToString(content)
 
-	return fileURL, nil
+	return dataURL, nil
 }
 
-func imageRecognitionLAI(url string, model string, token string, imgLink string, prompt string) (string, error) {
-
-	client := &http.Client{}
+func imageRecognitionLAI(client *http.Client, url string, model string, token string, imgLink string, prompt string) (string, error) {
 
 	payload := map[string]interface{}{
 		"model": model,
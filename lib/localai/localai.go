@@ -152,7 +152,9 @@ func GenerateCompletionWithPWD(prompt, modelName string, url string, s_pwd strin
 	}
 }
 
-func GenerateImageStableDiffusion(prompt, size, url, model string) (string, error) {
+// GenerateImageStableDiffusion asks image generation service at url for an image and returns its url,
+// client sends the request (own endpoints of users get one refusing private addresses)
+func GenerateImageStableDiffusion(prompt, size, url, model, key string, client *http.Client) (string, error) {
 	fmt.Println("Request URL:", url)
 	payload := struct {
 		Model  string `json:"model"`
@@ -175,14 +177,12 @@ func GenerateImageStableDiffusion(prompt, size, url, model string) (string, erro
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	// Get the API key from the environment and add it to the Authorization header
-	key := os.Getenv("OPENAI_API_KEY")
+	// Add the API key of the bot to the Authorization header
 	if key == "" {
-		return "", fmt.Errorf("API key not found in environment variables")
+		return "", fmt.Errorf("API key is not set (OPENAI_API_KEY)")
 	}
 	req.Header.Set("Authorization", "Bearer "+key)
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -211,7 +211,8 @@ func GenerateImageStableDiffusion(prompt, size, url, model string) (string, erro
 	return imageURL, nil
 }
 
-func TranscribeWhisper(url, model, path string) (string, error) {
+// TranscribeWhisper sends the audio file at path to transcription service at url with client
+func TranscribeWhisper(url, model, key, path string, client *http.Client) (string, error) {
 
 	file, err := os.Open(path)
 	if err != nil {
@@ -254,9 +255,8 @@ func TranscribeWhisper(url, model, path string) (string, error) {
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.Header.Set("accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
+	req.Header.Set("Authorization", "Bearer "+key)
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Println("Error sending request:", err)
@@ -2,93 +2,130 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
-	"os"
-	"strconv"
+	"net/http"
 
+	"github.com/JackBekket/hellper/lib/agent"
 	"github.com/JackBekket/hellper/lib/bot/command"
 	"github.com/JackBekket/hellper/lib/bot/dialog"
-	"github.com/JackBekket/hellper/lib/bot/env"
+	"github.com/JackBekket/hellper/lib/bot/messenger"
+	"github.com/JackBekket/hellper/lib/config"
 	"github.com/JackBekket/hellper/lib/database"
+	"github.com/JackBekket/hellper/lib/httpapi"
+	"github.com/JackBekket/hellper/lib/langchain"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/joho/godotenv"
 )
 
-/*
-type AdminData struct {
-	ID     int64
-	GPTKey string
-	//localhost_password string
-}
-*/
-
 func main() {
 
-	_ = godotenv.Load()
-	api_token := os.Getenv("OPENAI_API_KEY") // this is not openai key actually, it's local key for localai
-	//conn_pg_link := os.Getenv("PG_LINK")
-
-
-	//token := api_token
-	token := os.Getenv("TG_KEY")
-	log.Println("TG token is: ", token)
-
-	admin_key := api_token
-	admin_id := os.Getenv("ADMIN_ID")
-	id, err := strconv.ParseInt(admin_id, 0, 64)
+	// settings are loaded once, from optional yaml file and env (.env)
+	config_file := flag.String("config", "", "yaml config file, env variables override it (default $CONFIG_FILE)")
+	flag.Parse()
+	cfg, err := config.Load(*config_file)
+	if err == nil {
+		err = cfg.ValidateTelegram()
+	}
 	if err != nil {
-		log.Printf("admin id error parse: %s", admin_id)
+		log.Fatalf("config error:\n%v\n", err)
 	}
-	ai_endpoint := os.Getenv("AI_ENDPOINT")
+	agent.Configure(cfg)
+	// own providers of users can't reach private addresses, endpoints from config can
+	langchain.TrustEndpoints(cfg.AI)
+
+	token := cfg.Telegram.Token
+	ai_endpoint := cfg.AI.Endpoint
 	log.Println("ai endpoint is: ", ai_endpoint)
 
+	// dialogs on the default endpoint are retried and moved to failover endpoints while it's down
+	ctx := context.Background()
+	if ai_endpoint != "" {
+		pool := langchain.NewEndpointPool(cfg.AI)
+		go pool.Run(ctx)
+		langchain.SetEndpointPool(pool)
+		log.Println("failover endpoints: ", cfg.AI.Failover.Endpoints)
+	}
+
 	bot, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
 		log.Fatalf("tg token missing: %v\n", err)
 	}
 
-	adminData := make(map[string]env.AdminData)
-	adminData["ADMIN_ID"] = env.AdminData{
-		ID:     id,
-		GPTKey: admin_key,
-	}
-
 	// init database and commander
-	usersDatabase := database.UsersMap
-	ctx := context.Background()
-	comm := command.NewCommander(bot, usersDatabase, ctx)
+	var usersDatabase database.UserStore
+	db_link := cfg.Database.URL
+	if db_link != "" {
+		pgStore, err := database.NewPostgresStore(ctx, db_link)
+		if err != nil {
+			log.Fatalf("users database error: %v\n", err)
+		}
+		defer pgStore.Close()
+		usersDatabase = pgStore
+		log.Println("users are stored in postgres")
+	} else {
+		usersDatabase = database.NewMemoryStore()
+		log.Println("EMBEDDINGS_DB_URL is not set, users are stored in memory and will be lost on restart")
+	}
+	// LocalAI node can serve only a few generations at once (ai.generation_workers), everything else waits in queue
+	tg := messenger.NewTelegram(bot)
+	comm := command.NewCommander(tg, usersDatabase, ctx, cfg)
 
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	upd_ch := make(chan tgbotapi.Update)
-
-	//updateHandler :=
-	updates := bot.GetUpdatesChan(u)
+	upd_ch := make(chan tgbotapi.Update, 100)
 
 	// handling any incoming updates through channel
-	go dialog.HandleUpdates(upd_ch, bot, *comm)
-
-	//whenever bot gets a new message, check for user id in the database happens, if it's a new user, the entry in the database is created.
-
-	for update := range updates {
-		//inline keyboards logic (it works as a callback)
-		var chatID int64
-		if update.CallbackQuery != nil {
-			chatID = update.CallbackQuery.Message.Chat.ID
-		} else {
-			chatID = update.Message.Chat.ID
+	go dialog.HandleUpdates(upd_ch, tg, *comm)
+
+	// OpenAI compatible api for tools and IDE plugins, shares users and generation queue with the bot
+	mux := http.NewServeMux()
+	httpapi.NewServer(usersDatabase, comm.Scheduler(), ai_endpoint).
+		UseEmbeddings(comm.Embeddings).
+		UseLimiter(comm.Limiter()).
+		UseAdmins(comm.Admins()).
+		Register(mux)
+
+	// updates are received either by long polling (default) or by webhook served on the same port as http api
+	if cfg.Telegram.UpdatesMode == "webhook" {
+		webhook := messenger.WebhookConfig{
+			URL:      cfg.Telegram.WebhookURL,
+			Secret:   cfg.Telegram.WebhookSecret,
+			CertFile: cfg.HTTP.TLSCertFile,
 		}
-		_, ok := usersDatabase[chatID]
-		if !ok {
-			upd_ch <- update
+		path, err := webhook.Path()
+		if err != nil {
+			log.Fatalf("webhook config error: %v\n", err)
 		}
-		if ok {
-			upd_ch <- update
+		mux.Handle(path, messenger.WebhookHandler(webhook.Secret, upd_ch))
+		if err := tg.SetWebhook(webhook); err != nil {
+			log.Fatalf("webhook registration error: %v\n", err)
 		}
+		log.Println("receiving updates by webhook", path)
+	} else {
+		// webhook set by previous run blocks getUpdates
+		if err := tg.DeleteWebhook(); err != nil {
+			log.Println("could not delete webhook:", err)
+		}
+		go func() {
+			u := tgbotapi.NewUpdate(0)
+			u.Timeout = 60
+			//whenever bot gets a new message, check for user id in the database happens, if it's a new user, the entry in the database is created.
+			for update := range bot.GetUpdatesChan(u) {
+				upd_ch <- update
+			}
+		}()
+		log.Println("receiving updates by long polling")
+	}
 
+	http_addr := cfg.HTTP.Addr
+	// with TLS_CERT_FILE and TLS_KEY_FILE bot terminates TLS itself, otherwise it's expected to be behind reverse proxy
+	cert_file, key_file := cfg.HTTP.TLSCertFile, cfg.HTTP.TLSKeyFile
+	log.Println("http server is listening on", http_addr)
+	if cert_file != "" && key_file != "" {
+		err = http.ListenAndServeTLS(http_addr, cert_file, key_file, mux)
+	} else {
+		err = http.ListenAndServe(http_addr, mux)
 	}
+	log.Fatalf("http server error: %v\n", err)
 
 } // end of main func